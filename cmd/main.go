@@ -2,14 +2,25 @@ package main
 
 import (
 	"context"
+	"os"
 	"search-job/internal/auth"
 	"search-job/internal/config"
 	"search-job/internal/expense/service"
+	"search-job/internal/ledger"
 	"search-job/internal/middleware"
+	"search-job/internal/pkg/jwt"
 	"search-job/internal/pkg/logs"
+	"search-job/internal/pkg/migrate"
 	"search-job/internal/pkg/postgres"
+	"search-job/internal/pkg/storage"
+	"search-job/internal/rates"
+	"search-job/internal/recurring"
+	"search-job/internal/session"
+	"search-job/internal/trash"
+	"search-job/migrations"
 
 	"github.com/labstack/echo/v4"
+	echomw "github.com/labstack/echo/v4/middleware"
 )
 
 func main() {
@@ -28,27 +39,142 @@ func main() {
 		logger.Fatal(err)
 	}
 
-	svc := service.NewService(db, logger)
-	authHandler := auth.NewHandler(db)
+	migrator, err := migrate.NewMigrator(db, logger, migrations.FS)
+	if err != nil {
+		logger.Fatal(err)
+	}
+
+	if len(os.Args) > 1 && os.Args[1] == "migrate" {
+		if err := runMigrate(ctx, migrator, os.Args[2:]); err != nil {
+			logger.Fatal(err)
+		}
+		return
+	}
+
+	if cfg.AutoMigrate {
+		if err := migrator.Up(ctx); err != nil {
+			logger.Fatal(err)
+		}
+	}
+
+	if len(os.Args) > 1 && os.Args[1] == "rates" {
+		if err := runRates(ctx, rates.NewRepo(db), os.Args[2:]); err != nil {
+			logger.Fatal(err)
+		}
+		return
+	}
+
+	keys, err := jwt.NewKeyManager(cfg.JWT)
+	if err != nil {
+		logger.Fatal(err)
+	}
+
+	go recurring.NewScheduler(db, logger, cfg.Scheduler.Interval).Run(ctx)
+
+	blobs, err := storage.New(ctx, cfg.Storage)
+	if err != nil {
+		logger.Fatal(err)
+	}
+
+	if cfg.Trash.Retention > 0 {
+		go trash.NewPurger(db, blobs, logger, cfg.Trash.Retention, cfg.Trash.Interval).Run(ctx)
+	}
+
+	svc := service.NewService(db, logger, cfg, blobs)
+	authHandler := auth.NewHandler(db, keys)
 
 	router := echo.New()
+	router.HTTPErrorHandler = middleware.ErrorHandler(logger)
+	router.Use(echomw.RequestID())
+
+	router.GET("/.well-known/jwks.json", authHandler.JWKS)
 
 	auth := router.Group("/api/v1/auth")
 	auth.POST("/register", authHandler.Register)
 	auth.POST("/login", authHandler.Login)
+	auth.POST("/refresh", authHandler.Refresh)
+	auth.POST("/logout", authHandler.Logout)
+
+	api := router.Group("/api/v1",
+		middleware.AuthMiddleware(keys, session.NewRepo(db)),
+		middleware.LedgerMiddleware(ledger.NewRepo(db)),
+	)
 
-	api := router.Group("/api/v1", middleware.AuthMiddleware)
+	api.GET("/users/me", svc.GetProfile)
+	api.PATCH("/users/me", svc.UpdateProfile)
+
+	api.POST("/ledgers", svc.CreateLedger)
+	api.GET("/ledgers", svc.GetLedgers)
+	api.GET("/ledgers/:id", svc.GetLedgerByID)
+	api.PATCH("/ledgers/:id", svc.UpdateLedger)
+	api.GET("/ledgers/:id/members", svc.GetLedgerMembers)
+	api.PATCH("/ledgers/:id/members/:userId", svc.UpdateLedgerMember)
+	api.DELETE("/ledgers/:id/members/:userId", svc.RemoveLedgerMember)
+	api.POST("/ledgers/:id/invitations", svc.CreateLedgerInvitation)
+	api.GET("/ledgers/:id/invitations", svc.GetLedgerInvitations)
+	api.DELETE("/ledgers/:id/invitations/:invitationId", svc.RevokeLedgerInvitation)
+	api.POST("/invitations/accept", svc.AcceptLedgerInvitation)
 
 	api.POST("/categories", svc.CreateCategory)
 	api.GET("/categories", svc.GetCategories)
 	api.PATCH("/categories/:id", svc.UpdateCategory)
 	api.DELETE("/categories/:id", svc.DeleteCategory)
+	api.POST("/categories/:id/restore", svc.RestoreCategory)
+
+	api.POST("/tags", svc.CreateTag)
+	api.GET("/tags", svc.GetTags)
+	api.PATCH("/tags/:id", svc.UpdateTag)
+	api.DELETE("/tags/:id", svc.DeleteTag)
 
 	api.POST("/expenses", svc.CreateExpense)
 	api.GET("/expenses", svc.GetExpenses)
 	api.GET("/expenses/:id", svc.GetExpenseByID)
 	api.PATCH("/expenses/:id", svc.UpdateExpense)
 	api.DELETE("/expenses/:id", svc.DeleteExpense)
+	api.POST("/expenses/:id/restore", svc.RestoreExpense)
+	api.GET("/expenses/:id/history", svc.GetExpenseHistory)
+
+	api.POST("/expenses/:id/attachments", svc.UploadAttachment)
+	api.GET("/expenses/:id/attachments", svc.GetAttachments)
+	api.GET("/expenses/:id/attachments/:attachmentId", svc.DownloadAttachment)
+	api.DELETE("/expenses/:id/attachments/:attachmentId", svc.DeleteAttachment)
+
+	api.POST("/accounts", svc.CreateAccount)
+	api.GET("/accounts", svc.GetAccounts)
+	api.GET("/accounts/:id", svc.GetAccountByID)
+	api.PATCH("/accounts/:id", svc.UpdateAccount)
+	api.DELETE("/accounts/:id", svc.DeleteAccount)
+	api.POST("/transfers", svc.CreateTransfer)
+	api.GET("/transfers", svc.GetTransfers)
+	api.DELETE("/transfers/:id", svc.DeleteTransfer)
+
+	api.GET("/balances", svc.GetBalances)
+	api.POST("/settlements", svc.CreateSettlement)
+	api.GET("/settlements", svc.GetSettlements)
+	api.DELETE("/settlements/:id", svc.DeleteSettlement)
+
+	api.POST("/recurring-expenses", svc.CreateRecurringExpense)
+	api.GET("/recurring-expenses", svc.GetRecurringExpenses)
+	api.GET("/recurring-expenses/:id", svc.GetRecurringExpenseByID)
+	api.PATCH("/recurring-expenses/:id", svc.UpdateRecurringExpense)
+	api.DELETE("/recurring-expenses/:id", svc.DeleteRecurringExpense)
+	api.POST("/recurring-expenses/:id/pause", svc.PauseRecurringExpense)
+	api.POST("/recurring-expenses/:id/resume", svc.ResumeRecurringExpense)
+	api.POST("/recurring-expenses/:id/skip", svc.SkipRecurringOccurrence)
+
+	api.POST("/budgets", svc.CreateBudget)
+	api.GET("/budgets", svc.GetBudgets)
+	api.GET("/budgets/status", svc.GetBudgetsStatus)
+	api.PATCH("/budgets/:id", svc.UpdateBudget)
+	api.DELETE("/budgets/:id", svc.DeleteBudget)
+
+	api.GET("/reports/summary", svc.GetSummary)
+	api.GET("/reports/cash-flow", svc.GetCashFlow)
+
+	api.GET("/trash", svc.GetTrash)
+
+	api.POST("/imports", svc.ImportExpenses)
+	api.GET("/exports/expenses", svc.ExportExpenses)
 
 	router.Logger.Fatal(router.Start(cfg.GetWebPort()))
 }
@@ -0,0 +1,45 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"search-job/internal/models"
+	"search-job/internal/rates"
+	"strings"
+)
+
+// runRates handles `rates load <file>`, where file is either a CSV of
+// date,currency,rate rows or an ECB eurofxref XML document.
+func runRates(ctx context.Context, repo *rates.Repo, args []string) error {
+	if len(args) != 2 || args[0] != "load" {
+		return fmt.Errorf("usage: rates load <file.csv|file.xml>")
+	}
+
+	file, err := os.Open(args[1])
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	var loaded []models.ExchangeRate
+	switch strings.ToLower(filepath.Ext(args[1])) {
+	case ".xml":
+		loaded, err = rates.ParseECB(file)
+	case ".csv":
+		loaded, err = rates.ParseCSV(file)
+	default:
+		return fmt.Errorf("unsupported rates file: %s", args[1])
+	}
+	if err != nil {
+		return err
+	}
+
+	if err := repo.Save(ctx, loaded); err != nil {
+		return err
+	}
+
+	fmt.Printf("loaded %d exchange rates\n", len(loaded))
+	return nil
+}
@@ -0,0 +1,257 @@
+package account
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"search-job/internal/ledger"
+	"search-job/internal/models"
+	"search-job/internal/pkg/apperr"
+	"search-job/internal/pkg/money"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// Account types.
+const (
+	TypeCash    = "cash"
+	TypeCard    = "card"
+	TypeBank    = "bank"
+	TypeSavings = "savings"
+	TypeCredit  = "credit"
+	TypeOther   = "other"
+)
+
+var (
+	ErrNotInLedger      = apperr.Validation("account_not_in_ledger", "account not found in the ledger")
+	ErrDuplicateName    = apperr.Conflict("account_name_taken", "account with this name already exists")
+	ErrCurrencyMismatch = apperr.Validation("account_currency_mismatch", "amount must be in the currency of the account")
+	ErrArchived         = apperr.Validation("account_archived", "account is archived")
+)
+
+func IsValidType(t string) bool {
+	switch t {
+	case TypeCash, TypeCard, TypeBank, TypeSavings, TypeCredit, TypeOther:
+		return true
+	}
+	return false
+}
+
+type Repo struct {
+	db *pgxpool.Pool
+}
+
+func NewRepo(db *pgxpool.Pool) *Repo {
+	return &Repo{db: db}
+}
+
+// Create adds the account to its ledger. ledger.ErrForbidden is returned
+// unless the user may write to the ledger.
+func (r *Repo) Create(ctx context.Context, a *models.Account) error {
+	query := fmt.Sprintf(`
+		INSERT INTO accounts (ledger_id, user_id, name, type, currency, opening_balance, created_at, updated_at)
+		SELECT $1, $2, $3, $4, $5, $6, NOW(), NOW()
+		WHERE %s
+		RETURNING id, created_at, updated_at
+	`, ledger.AccessCondition("$1", "$2", ledger.Write))
+
+	err := r.db.QueryRow(ctx, query,
+		a.LedgerID,
+		a.UserID,
+		a.Name,
+		a.Type,
+		a.OpeningBalance.Currency,
+		a.OpeningBalance.Numeric(),
+	).Scan(&a.ID, &a.CreatedAt, &a.UpdatedAt)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return ledger.ErrForbidden
+	}
+
+	return duplicateName(err)
+}
+
+// GetAll lists the accounts of a ledger the user is a member of with their
+// balances as of asOf. Archived accounts are left out unless asked for.
+func (r *Repo) GetAll(ctx context.Context, ledgerID, userID int64, asOf time.Time, archived bool) ([]models.Account, error) {
+	where := "a.ledger_id = $1 AND " + ledger.AccessCondition("a.ledger_id", "$2", ledger.Read)
+	if !archived {
+		where += " AND a.archived_at IS NULL"
+	}
+
+	query := fmt.Sprintf(`
+		SELECT %s, %s
+		FROM accounts a
+		WHERE %s
+		ORDER BY a.archived_at NULLS FIRST, lower(a.name)
+	`, accountColumns, balanceColumn("$3"), where)
+
+	rows, err := r.db.Query(ctx, query, ledgerID, userID, asOf)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	accounts := []models.Account{}
+	for rows.Next() {
+		var a models.Account
+		if err := scanAccount(rows, &a, asOf); err != nil {
+			return nil, err
+		}
+		accounts = append(accounts, a)
+	}
+
+	return accounts, rows.Err()
+}
+
+// GetByID returns an account of any ledger the user is a member of with
+// its balance as of asOf.
+func (r *Repo) GetByID(ctx context.Context, id, userID int64, asOf time.Time) (*models.Account, error) {
+	query := fmt.Sprintf(`
+		SELECT %s, %s
+		FROM accounts a
+		WHERE a.id = $1 AND %s
+	`, accountColumns, balanceColumn("$3"), ledger.AccessCondition("a.ledger_id", "$2", ledger.Read))
+
+	var a models.Account
+	err := scanAccount(r.db.QueryRow(ctx, query, id, userID, asOf), &a, asOf)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, sql.ErrNoRows
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return &a, nil
+}
+
+// Update renames the account and changes its type, opening balance and
+// archived state. The currency stays what it was created with.
+// sql.ErrNoRows is returned unless the account is in a ledger the user is
+// a member of and ledger.ErrForbidden unless they may write to it.
+func (r *Repo) Update(ctx context.Context, a *models.Account, userID int64) error {
+	tx, err := r.db.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	var allowed bool
+	err = tx.QueryRow(ctx, fmt.Sprintf(`
+		SELECT %s FROM accounts WHERE id = $1 AND %s
+		FOR UPDATE
+	`,
+		ledger.AccessCondition("accounts.ledger_id", "$2", ledger.Write),
+		ledger.AccessCondition("accounts.ledger_id", "$2", ledger.Read),
+	), a.ID, userID).Scan(&allowed)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return sql.ErrNoRows
+	}
+	if err != nil {
+		return err
+	}
+	if !allowed {
+		return ledger.ErrForbidden
+	}
+
+	err = tx.QueryRow(ctx, `
+		UPDATE accounts
+		SET name = $1, type = $2, opening_balance = $3, archived_at = $4, updated_at = NOW()
+		WHERE id = $5 AND currency = $6
+		RETURNING updated_at
+	`,
+		a.Name,
+		a.Type,
+		a.OpeningBalance.Numeric(),
+		a.ArchivedAt,
+		a.ID,
+		a.OpeningBalance.Currency,
+	).Scan(&a.UpdatedAt)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return ErrCurrencyMismatch
+	}
+	if err != nil {
+		return duplicateName(err)
+	}
+
+	return tx.Commit(ctx)
+}
+
+// Check verifies within tx that the account belongs to the ledger and
+// keeps its money in currency. Archived accounts still pass, so that their
+// old transactions can be edited.
+func Check(ctx context.Context, tx pgx.Tx, ledgerID, id int64, currency string) error {
+	var accountCurrency string
+	err := tx.QueryRow(ctx, `
+		SELECT currency FROM accounts WHERE id = $1 AND ledger_id = $2
+	`, id, ledgerID).Scan(&accountCurrency)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return ErrNotInLedger
+	}
+	if err != nil {
+		return err
+	}
+	if accountCurrency != currency {
+		return ErrCurrencyMismatch
+	}
+
+	return nil
+}
+
+const accountColumns = `a.id, a.ledger_id, a.user_id, a.name, a.type, a.currency, a.opening_balance,
+	a.archived_at, a.created_at, a.updated_at`
+
+// balanceColumn computes the balance of the account aliased as a at the
+// time in asOfExpr. Incomes paid into the account add to it, expenses paid
+// from it subtract; transfers move money between accounts.
+func balanceColumn(asOfExpr string) string {
+	return fmt.Sprintf(`a.opening_balance
+		+ COALESCE((
+			SELECT SUM(CASE WHEN e.kind = '%[2]s' THEN e.amount ELSE -e.amount END)
+			FROM expenses e
+			WHERE e.account_id = a.id AND e.deleted_at IS NULL AND e.occurred_at <= %[1]s
+		), 0)
+		- COALESCE((
+			SELECT SUM(t.amount) FROM transfers t
+			WHERE t.from_account_id = a.id AND t.occurred_at <= %[1]s
+		), 0)
+		+ COALESCE((
+			SELECT SUM(t.to_amount) FROM transfers t
+			WHERE t.to_account_id = a.id AND t.occurred_at <= %[1]s
+		), 0)`, asOfExpr, models.KindIncome)
+}
+
+// scanAccount reads accountColumns followed by balanceColumn.
+func scanAccount(row pgx.Row, a *models.Account, asOf time.Time) error {
+	var opening, balance pgtype.Numeric
+	var currency string
+	err := row.Scan(&a.ID, &a.LedgerID, &a.UserID, &a.Name, &a.Type, &currency, &opening,
+		&a.ArchivedAt, &a.CreatedAt, &a.UpdatedAt, &balance)
+	if err != nil {
+		return err
+	}
+
+	if a.OpeningBalance, err = money.FromNumeric(opening, currency); err != nil {
+		return fmt.Errorf("account %d: %w", a.ID, err)
+	}
+	b, err := money.FromNumeric(balance, currency)
+	if err != nil {
+		return fmt.Errorf("account %d: %w", a.ID, err)
+	}
+	a.Balance = &b
+	a.BalanceAt = &asOf
+
+	return nil
+}
+
+func duplicateName(err error) error {
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) && pgErr.Code == "23505" {
+		return ErrDuplicateName
+	}
+	return err
+}
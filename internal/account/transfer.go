@@ -0,0 +1,176 @@
+package account
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"search-job/internal/ledger"
+	"search-job/internal/models"
+	"search-job/internal/pkg/apperr"
+	"search-job/internal/pkg/money"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+var (
+	ErrSameAccount = apperr.Validation("transfer_same_account", "transfer needs two different accounts")
+	// ErrToAmountRequired is returned when the accounts keep different
+	// currencies and the amount received is not given.
+	ErrToAmountRequired = apperr.Validation("transfer_to_amount_required", "amount received is required between accounts in different currencies")
+)
+
+// CreateTransfer moves money between two accounts of the transfer's ledger.
+// Amount is in the currency of the source account; ToAmount, unless given,
+// equals it. ErrNotInLedger is returned if either account is not in the
+// ledger, ErrArchived if either is archived and ledger.ErrForbidden unless
+// the user may write to it.
+func (r *Repo) CreateTransfer(ctx context.Context, t *models.AccountTransfer) error {
+	if t.FromAccountID == t.ToAccountID {
+		return ErrSameAccount
+	}
+
+	tx, err := r.db.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	var fromCurrency, toCurrency *string
+	var fromArchived, toArchived bool
+	err = tx.QueryRow(ctx, `
+		SELECT f.currency, f.archived_at IS NOT NULL, t.currency, t.archived_at IS NOT NULL
+		FROM (SELECT 1) one
+		LEFT JOIN accounts f ON f.id = $1 AND f.ledger_id = $3
+		LEFT JOIN accounts t ON t.id = $2 AND t.ledger_id = $3
+	`, t.FromAccountID, t.ToAccountID, t.LedgerID).Scan(&fromCurrency, &fromArchived, &toCurrency, &toArchived)
+	if err != nil {
+		return err
+	}
+	if fromCurrency == nil {
+		return ErrNotInLedger.At("from_account_id")
+	}
+	if toCurrency == nil {
+		return ErrNotInLedger.At("to_account_id")
+	}
+	if fromArchived {
+		return ErrArchived.At("from_account_id")
+	}
+	if toArchived {
+		return ErrArchived.At("to_account_id")
+	}
+
+	if t.Amount.Currency != *fromCurrency {
+		return ErrCurrencyMismatch
+	}
+	if t.ToAmount.Currency == "" {
+		if *fromCurrency != *toCurrency {
+			return ErrToAmountRequired
+		}
+		t.ToAmount = t.Amount
+	} else if t.ToAmount.Currency != *toCurrency {
+		return ErrCurrencyMismatch
+	}
+
+	query := fmt.Sprintf(`
+		INSERT INTO transfers (ledger_id, user_id, from_account_id, to_account_id, amount, to_amount, occurred_at, comment, created_at)
+		SELECT $1, $2, $3, $4, $5, $6, $7, $8, NOW()
+		WHERE %s
+		RETURNING id, created_at
+	`, ledger.AccessCondition("$1", "$2", ledger.Write))
+
+	err = tx.QueryRow(ctx, query,
+		t.LedgerID,
+		t.UserID,
+		t.FromAccountID,
+		t.ToAccountID,
+		t.Amount.Numeric(),
+		t.ToAmount.Numeric(),
+		t.OccurredAt,
+		t.Comment,
+	).Scan(&t.ID, &t.CreatedAt)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return ledger.ErrForbidden
+	}
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit(ctx)
+}
+
+// GetTransfers lists the transfers of a ledger the user is a member of,
+// latest first. A non-nil accountID keeps only the transfers from or to
+// that account.
+func (r *Repo) GetTransfers(ctx context.Context, ledgerID, userID int64, accountID *int64, limit, offset int) ([]models.AccountTransfer, int, error) {
+	where := "t.ledger_id = $1 AND " + ledger.AccessCondition("t.ledger_id", "$2", ledger.Read)
+	args := []interface{}{ledgerID, userID}
+	if accountID != nil {
+		where += " AND (t.from_account_id = $3 OR t.to_account_id = $3)"
+		args = append(args, *accountID)
+	}
+
+	var total int
+	err := r.db.QueryRow(ctx, "SELECT COUNT(*) FROM transfers t WHERE "+where, args...).Scan(&total)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	query := fmt.Sprintf(`
+		SELECT t.id, t.ledger_id, t.user_id, t.from_account_id, t.to_account_id,
+		       t.amount, f.currency, t.to_amount, a.currency, t.occurred_at, t.comment, t.created_at
+		FROM transfers t
+		JOIN accounts f ON f.id = t.from_account_id
+		JOIN accounts a ON a.id = t.to_account_id
+		WHERE %s
+		ORDER BY t.occurred_at DESC, t.id DESC
+		LIMIT $%d OFFSET $%d
+	`, where, len(args)+1, len(args)+2)
+
+	rows, err := r.db.Query(ctx, query, append(args, limit, offset)...)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+
+	transfers := []models.AccountTransfer{}
+	for rows.Next() {
+		var t models.AccountTransfer
+		var amount, toAmount pgtype.Numeric
+		var fromCurrency, toCurrency string
+		err := rows.Scan(&t.ID, &t.LedgerID, &t.UserID, &t.FromAccountID, &t.ToAccountID,
+			&amount, &fromCurrency, &toAmount, &toCurrency, &t.OccurredAt, &t.Comment, &t.CreatedAt)
+		if err != nil {
+			return nil, 0, err
+		}
+		if t.Amount, err = money.FromNumeric(amount, fromCurrency); err != nil {
+			return nil, 0, fmt.Errorf("transfer %d: %w", t.ID, err)
+		}
+		if t.ToAmount, err = money.FromNumeric(toAmount, toCurrency); err != nil {
+			return nil, 0, fmt.Errorf("transfer %d: %w", t.ID, err)
+		}
+		transfers = append(transfers, t)
+	}
+
+	return transfers, total, rows.Err()
+}
+
+// DeleteTransfer removes a transfer recorded by mistake. Any member who
+// may write to the ledger may delete it.
+func (r *Repo) DeleteTransfer(ctx context.Context, id, userID int64) error {
+	query := fmt.Sprintf(`
+		DELETE FROM transfers
+		WHERE id = $1 AND %s
+	`, ledger.AccessCondition("transfers.ledger_id", "$2", ledger.Write))
+
+	result, err := r.db.Exec(ctx, query, id, userID)
+	if err != nil {
+		return err
+	}
+	if result.RowsAffected() == 0 {
+		return sql.ErrNoRows
+	}
+
+	return nil
+}
@@ -0,0 +1,81 @@
+package attachment
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"path/filepath"
+	"search-job/internal/pkg/apperr"
+	"strings"
+	"unicode"
+)
+
+// SniffLength is the number of leading bytes needed by DetectContentType.
+const SniffLength = 512
+
+var ErrUnsupportedType = apperr.Validation("attachment_unsupported_type", "unsupported file type")
+
+// allowedTypes are the receipt formats accepted for upload.
+var allowedTypes = map[string]bool{
+	"image/jpeg":      true,
+	"image/png":       true,
+	"image/gif":       true,
+	"image/webp":      true,
+	"image/heic":      true,
+	"application/pdf": true,
+}
+
+// DetectContentType determines the type from the content of the file
+// rather than trusting the name or the header sent by the client.
+func DetectContentType(head []byte) (string, error) {
+	contentType := http.DetectContentType(head)
+	// net/http does not know HEIC, the format of iPhone photos
+	if len(head) >= 12 && string(head[4:8]) == "ftyp" && isHEICBrand(head[8:12]) {
+		contentType = "image/heic"
+	}
+
+	contentType, _, _ = strings.Cut(contentType, ";")
+	if !allowedTypes[contentType] {
+		return "", fmt.Errorf("%w: %s", ErrUnsupportedType, contentType)
+	}
+	return contentType, nil
+}
+
+func isHEICBrand(brand []byte) bool {
+	for _, b := range []string{"heic", "heix", "mif1", "msf1"} {
+		if bytes.Equal(brand, []byte(b)) {
+			return true
+		}
+	}
+	return false
+}
+
+// StorageKey returns a new unguessable key for an object of the user.
+func StorageKey(userID int64) (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("attachments/%d/%s", userID, hex.EncodeToString(b)), nil
+}
+
+// CleanFilename strips the directory and control characters from a name
+// sent by the client.
+func CleanFilename(name string) string {
+	name = filepath.Base(strings.ReplaceAll(name, "\\", "/"))
+	name = strings.Map(func(r rune) rune {
+		if unicode.IsControl(r) || r == '"' {
+			return -1
+		}
+		return r
+	}, name)
+	if name == "." || name == "/" || name == "" {
+		return "attachment"
+	}
+	if runes := []rune(name); len(runes) > 255 {
+		name = string(runes[len(runes)-255:])
+	}
+	return name
+}
@@ -0,0 +1,158 @@
+package attachment
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"search-job/internal/ledger"
+	"search-job/internal/models"
+	"search-job/internal/pkg/apperr"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+var ErrQuotaExceeded = apperr.Conflict("attachment_quota_exceeded", "storage quota exceeded")
+
+type Repo struct {
+	db *pgxpool.Pool
+}
+
+func NewRepo(db *pgxpool.Pool) *Repo {
+	return &Repo{db: db}
+}
+
+// Create stores the attachment unless it would bring the user's total size
+// above quota. A quota of zero is unlimited. ledger.ErrForbidden is
+// returned unless the user may change the expense.
+func (r *Repo) Create(ctx context.Context, a *models.Attachment, quota int64) error {
+	tx, err := r.db.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	if quota > 0 {
+		// the user row serializes concurrent uploads of the same user
+		if _, err := tx.Exec(ctx, `SELECT id FROM users WHERE id = $1 FOR UPDATE`, a.UserID); err != nil {
+			return err
+		}
+
+		var used int64
+		err := tx.QueryRow(ctx, `SELECT COALESCE(SUM(size), 0) FROM attachments WHERE user_id = $1`, a.UserID).Scan(&used)
+		if err != nil {
+			return err
+		}
+		if used+a.Size > quota {
+			return ErrQuotaExceeded
+		}
+	}
+
+	query := fmt.Sprintf(`
+		INSERT INTO attachments (user_id, expense_id, storage_key, filename, content_type, size, created_at)
+		SELECT $1, e.id, $3, $4, $5, $6, NOW()
+		FROM expenses e
+		WHERE e.id = $2 AND %s
+		RETURNING id, created_at
+	`, ledger.AccessCondition("e.ledger_id", "$1", ledger.Write))
+
+	err = tx.QueryRow(ctx, query,
+		a.UserID,
+		a.ExpenseID,
+		a.StorageKey,
+		a.Filename,
+		a.ContentType,
+		a.Size,
+	).Scan(&a.ID, &a.CreatedAt)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return ledger.ErrForbidden
+	}
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit(ctx)
+}
+
+// GetAll lists the attachments of an expense in a ledger the user is a
+// member of.
+func (r *Repo) GetAll(ctx context.Context, expenseID, userID int64) ([]models.Attachment, error) {
+	query := fmt.Sprintf(`
+		SELECT %s
+		FROM attachments a
+		JOIN expenses e ON e.id = a.expense_id
+		WHERE a.expense_id = $1 AND %s
+		ORDER BY a.created_at, a.id
+	`, attachmentColumns, ledger.AccessCondition("e.ledger_id", "$2", ledger.Read))
+
+	rows, err := r.db.Query(ctx, query, expenseID, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	attachments := []models.Attachment{}
+	for rows.Next() {
+		var a models.Attachment
+		if err := scanAttachment(rows, &a); err != nil {
+			return nil, err
+		}
+		attachments = append(attachments, a)
+	}
+
+	return attachments, rows.Err()
+}
+
+func (r *Repo) GetByID(ctx context.Context, id, expenseID, userID int64) (*models.Attachment, error) {
+	query := fmt.Sprintf(`
+		SELECT %s
+		FROM attachments a
+		JOIN expenses e ON e.id = a.expense_id
+		WHERE a.id = $1 AND a.expense_id = $2 AND %s
+	`, attachmentColumns, ledger.AccessCondition("e.ledger_id", "$3", ledger.Read))
+
+	var a models.Attachment
+	err := scanAttachment(r.db.QueryRow(ctx, query, id, expenseID, userID), &a)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, sql.ErrNoRows
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return &a, nil
+}
+
+// Delete removes the attachment record and returns its storage key, so
+// that the caller can remove the object as well. Any member who may change
+// the expense may delete its attachments.
+func (r *Repo) Delete(ctx context.Context, id, expenseID, userID int64) (string, error) {
+	query := fmt.Sprintf(`
+		DELETE FROM attachments a
+		USING expenses e
+		WHERE a.id = $1 AND a.expense_id = $2 AND e.id = a.expense_id AND %s
+		RETURNING a.storage_key
+	`, ledger.AccessCondition("e.ledger_id", "$3", ledger.Write))
+
+	var key string
+	err := r.db.QueryRow(ctx, query, id, expenseID, userID).Scan(&key)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return "", sql.ErrNoRows
+	}
+
+	return key, err
+}
+
+// Usage returns the total size of the user's attachments in bytes.
+func (r *Repo) Usage(ctx context.Context, userID int64) (int64, error) {
+	var used int64
+	err := r.db.QueryRow(ctx, `SELECT COALESCE(SUM(size), 0) FROM attachments WHERE user_id = $1`, userID).Scan(&used)
+	return used, err
+}
+
+const attachmentColumns = `a.id, a.user_id, a.expense_id, a.storage_key, a.filename, a.content_type, a.size, a.created_at`
+
+func scanAttachment(row pgx.Row, a *models.Attachment) error {
+	return row.Scan(&a.ID, &a.UserID, &a.ExpenseID, &a.StorageKey, &a.Filename, &a.ContentType, &a.Size, &a.CreatedAt)
+}
@@ -0,0 +1,160 @@
+package audit
+
+import (
+	"context"
+	"encoding/json"
+	"reflect"
+
+	"github.com/jackc/pgx/v5"
+)
+
+const (
+	EntityExpense  = "expense"
+	EntityCategory = "category"
+)
+
+const (
+	ActionCreate  = "create"
+	ActionUpdate  = "update"
+	ActionDelete  = "delete"
+	ActionRestore = "restore"
+)
+
+// Actor is whoever caused a change. Changes made by background jobs have no
+// actor.
+type Actor struct {
+	UserID    int64
+	RequestID string
+	IP        string
+}
+
+type actorKey struct{}
+
+func WithActor(ctx context.Context, actor Actor) context.Context {
+	return context.WithValue(ctx, actorKey{}, actor)
+}
+
+func ActorFrom(ctx context.Context) (Actor, bool) {
+	actor, ok := ctx.Value(actorKey{}).(Actor)
+	return actor, ok
+}
+
+// Event describes one change. Before is nil for a created entity and After
+// is nil for a deleted one. OwnerID is the user who created the entity.
+type Event struct {
+	LedgerID   int64
+	OwnerID    int64
+	EntityType string
+	EntityID   int64
+	Action     string
+	Before     any
+	After      any
+}
+
+// ignoredFields change on every write and are left out of the diff.
+var ignoredFields = map[string]bool{
+	"updated_at": true,
+}
+
+// Record appends the events within tx, so they are only kept if the change
+// itself is committed. The actor is taken from ctx.
+func Record(ctx context.Context, tx pgx.Tx, events ...Event) error {
+	if len(events) == 0 {
+		return nil
+	}
+
+	var actorID, requestID, ip any
+	if actor, ok := ActorFrom(ctx); ok {
+		actorID = actor.UserID
+		if actor.RequestID != "" {
+			requestID = actor.RequestID
+		}
+		if actor.IP != "" {
+			ip = actor.IP
+		}
+	}
+
+	rows := make([][]any, 0, len(events))
+	for _, ev := range events {
+		before, beforeFields, err := snapshot(ev.Before)
+		if err != nil {
+			return err
+		}
+		after, afterFields, err := snapshot(ev.After)
+		if err != nil {
+			return err
+		}
+
+		var changes any
+		if diff := Diff(beforeFields, afterFields); len(diff) > 0 {
+			b, err := json.Marshal(diff)
+			if err != nil {
+				return err
+			}
+			changes = string(b)
+		}
+
+		rows = append(rows, []any{
+			ev.LedgerID, ev.OwnerID, actorID, ev.EntityType, ev.EntityID, ev.Action,
+			before, after, changes, requestID, ip,
+		})
+	}
+
+	_, err := tx.CopyFrom(ctx,
+		pgx.Identifier{"audit_events"},
+		[]string{"ledger_id", "user_id", "actor_id", "entity_type", "entity_id", "action", "before", "after", "changes", "request_id", "ip"},
+		pgx.CopyFromRows(rows),
+	)
+	return err
+}
+
+// Change is the old and new value of a field.
+type Change struct {
+	From any `json:"from"`
+	To   any `json:"to"`
+}
+
+// Diff compares two snapshots field by field. A field missing on one side
+// is reported with a null value there. Nothing is reported when one of the
+// snapshots is absent, as for created and deleted entities.
+func Diff(before, after map[string]any) map[string]Change {
+	if before == nil || after == nil {
+		return nil
+	}
+
+	diff := make(map[string]Change)
+	for field, from := range before {
+		if ignoredFields[field] {
+			continue
+		}
+		if to := after[field]; !reflect.DeepEqual(from, to) {
+			diff[field] = Change{From: from, To: to}
+		}
+	}
+	for field, to := range after {
+		if _, ok := before[field]; !ok && !ignoredFields[field] {
+			diff[field] = Change{From: nil, To: to}
+		}
+	}
+	return diff
+}
+
+// snapshot returns v as JSON for the database, or nil for NULL, together
+// with its decoded fields.
+func snapshot(v any) (any, map[string]any, error) {
+	if v == nil || reflect.ValueOf(v).Kind() == reflect.Pointer && reflect.ValueOf(v).IsNil() {
+		return nil, nil, nil
+	}
+
+	b, err := json.Marshal(v)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var fields map[string]any
+	if err := json.Unmarshal(b, &fields); err != nil {
+		return nil, nil, err
+	}
+
+	return string(b), fields, nil
+}
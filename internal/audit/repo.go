@@ -0,0 +1,66 @@
+package audit
+
+import (
+	"context"
+	"search-job/internal/ledger"
+	"search-job/internal/models"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+type Repo struct {
+	db *pgxpool.Pool
+}
+
+func NewRepo(db *pgxpool.Pool) *Repo {
+	return &Repo{db: db}
+}
+
+// History returns the events of an entity in a ledger the user is a
+// member of, oldest first. The request id and IP address of an event are
+// shown only to its actor and to owners of the ledger.
+func (r *Repo) History(ctx context.Context, entityType string, entityID, userID int64, limit, offset int) ([]models.AuditEvent, int, error) {
+	where := "entity_type = $1 AND entity_id = $2 AND " + ledger.AccessCondition("audit_events.ledger_id", "$3", ledger.Read)
+
+	var total int
+	err := r.db.QueryRow(ctx, `
+		SELECT COUNT(*) FROM audit_events
+		WHERE `+where, entityType, entityID, userID).Scan(&total)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	private := "(actor_id = $3 OR " + ledger.AccessCondition("audit_events.ledger_id", "$3", ledger.Manage) + ")"
+	rows, err := r.db.Query(ctx, `
+		SELECT id, ledger_id, user_id, actor_id, entity_type, entity_id, action,
+		       before, after, changes,
+		       CASE WHEN `+private+` THEN request_id END,
+		       CASE WHEN `+private+` THEN ip END,
+		       created_at
+		FROM audit_events
+		WHERE `+where+`
+		ORDER BY id
+		LIMIT $4 OFFSET $5
+	`, entityType, entityID, userID, limit, offset)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+
+	events := []models.AuditEvent{}
+	for rows.Next() {
+		var ev models.AuditEvent
+		var before, after, changes []byte
+		err := rows.Scan(
+			&ev.ID, &ev.LedgerID, &ev.UserID, &ev.ActorID, &ev.EntityType, &ev.EntityID, &ev.Action,
+			&before, &after, &changes, &ev.RequestID, &ev.IP, &ev.CreatedAt,
+		)
+		if err != nil {
+			return nil, 0, err
+		}
+		ev.Before, ev.After, ev.Changes = before, after, changes
+		events = append(events, ev)
+	}
+
+	return events, total, rows.Err()
+}
@@ -1,43 +1,60 @@
 package auth
 
 import (
+	"context"
+	"errors"
 	"net/http"
 	"search-job/internal/models"
+	"search-job/internal/pkg/apperr"
 	"search-job/internal/pkg/jwt"
+	"search-job/internal/pkg/validate"
+	"search-job/internal/session"
 	"search-job/internal/user"
+	"time"
 
+	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgxpool"
 	"github.com/labstack/echo/v4"
 	"golang.org/x/crypto/bcrypt"
 )
 
+// errInvalidCredentials does not tell an unknown email from a wrong
+// password.
+var errInvalidCredentials = apperr.Unauthorized("invalid_credentials", "invalid credentials")
+
 type Handler struct {
-	userRepo *user.Repo
+	userRepo    *user.Repo
+	sessionRepo *session.Repo
+	keys        *jwt.KeyManager
 }
 
-func NewHandler(db *pgxpool.Pool) *Handler {
+func NewHandler(db *pgxpool.Pool, keys *jwt.KeyManager) *Handler {
 	return &Handler{
-		userRepo: user.NewRepo(db),
+		userRepo:    user.NewRepo(db),
+		sessionRepo: session.NewRepo(db),
+		keys:        keys,
 	}
 }
 
+type tokenPair struct {
+	AccessToken  string
+	RefreshToken string
+}
+
 func (h *Handler) Register(c echo.Context) error {
 	var req struct {
-		Email    string `json:"email"`
-		Password string `json:"password"`
+		Email string `json:"email" validate:"required,email,max=255"`
+		// Password is limited to the 72 bytes bcrypt reads.
+		Password string `json:"password" validate:"required,min=8,maxbytes=72"`
 	}
 
-	if err := c.Bind(&req); err != nil {
-		return c.JSON(http.StatusBadRequest, map[string]string{
-			"error": "invalid request",
-		})
+	if err := validate.Bind(c, &req); err != nil {
+		return err
 	}
 
 	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(req.Password), bcrypt.DefaultCost)
 	if err != nil {
-		return c.JSON(http.StatusInternalServerError, map[string]string{
-			"error": "internal server error",
-		})
+		return err
 	}
 
 	user := &models.User{
@@ -46,58 +63,144 @@ func (h *Handler) Register(c echo.Context) error {
 	}
 
 	if err := h.userRepo.Create(c.Request().Context(), user); err != nil {
-		return c.JSON(http.StatusInternalServerError, map[string]string{
-			"error": "failed to create user",
-		})
+		return err
 	}
 
-	token, err := jwt.GenerateToken(user.ID)
+	tokens, err := h.startSession(c.Request().Context(), user.ID)
 	if err != nil {
-		return c.JSON(http.StatusInternalServerError, map[string]string{
-			"error": "failed to generate token",
-		})
+		return err
 	}
 
 	return c.JSON(http.StatusCreated, map[string]interface{}{
-		"token": token,
-		"user":  user,
+		"token":         tokens.AccessToken,
+		"refresh_token": tokens.RefreshToken,
+		"user":          user,
 	})
 }
 
 func (h *Handler) Login(c echo.Context) error {
 	var req struct {
-		Email    string `json:"email"`
-		Password string `json:"password"`
+		Email    string `json:"email" validate:"required"`
+		Password string `json:"password" validate:"required"`
 	}
 
-	if err := c.Bind(&req); err != nil {
-		return c.JSON(http.StatusBadRequest, map[string]string{
-			"error": "invalid request",
-		})
+	if err := validate.Bind(c, &req); err != nil {
+		return err
 	}
 
 	user, err := h.userRepo.GetByEmail(c.Request().Context(), req.Email)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return errInvalidCredentials
+	}
 	if err != nil {
-		return c.JSON(http.StatusUnauthorized, map[string]string{
-			"error": "invalid credentials",
-		})
+		return err
 	}
 
 	if err := bcrypt.CompareHashAndPassword([]byte(user.PasswordHash), []byte(req.Password)); err != nil {
-		return c.JSON(http.StatusUnauthorized, map[string]string{
-			"error": "invalid credentials",
-		})
+		return errInvalidCredentials
+	}
+
+	tokens, err := h.startSession(c.Request().Context(), user.ID)
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"token":         tokens.AccessToken,
+		"refresh_token": tokens.RefreshToken,
+		"user":          user,
+	})
+}
+
+func (h *Handler) Refresh(c echo.Context) error {
+	var req struct {
+		RefreshToken string `json:"refresh_token" validate:"required"`
+	}
+
+	if err := validate.Bind(c, &req); err != nil {
+		return err
 	}
 
-	token, err := jwt.GenerateToken(user.ID)
+	refreshToken, hash, err := session.NewRefreshToken()
 	if err != nil {
-		return c.JSON(http.StatusInternalServerError, map[string]string{
-			"error": "failed to generate token",
-		})
+		return err
+	}
+
+	next := &models.RefreshToken{
+		TokenHash: hash,
+		ExpiresAt: time.Now().Add(session.RefreshTokenTTL),
+	}
+
+	err = h.sessionRepo.Rotate(c.Request().Context(), session.HashToken(req.RefreshToken), next)
+	if err != nil {
+		return err
+	}
+
+	accessToken, err := h.keys.GenerateToken(next.UserID, next.FamilyID)
+	if err != nil {
+		return err
 	}
 
 	return c.JSON(http.StatusOK, map[string]interface{}{
-		"token": token,
-		"user":  user,
+		"token":         accessToken,
+		"refresh_token": refreshToken,
+	})
+}
+
+func (h *Handler) Logout(c echo.Context) error {
+	var req struct {
+		RefreshToken string `json:"refresh_token" validate:"required"`
+	}
+
+	if err := validate.Bind(c, &req); err != nil {
+		return err
+	}
+
+	err := h.sessionRepo.RevokeByToken(c.Request().Context(), session.HashToken(req.RefreshToken))
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(http.StatusOK, map[string]string{
+		"status": "success",
+	})
+}
+
+func (h *Handler) JWKS(c echo.Context) error {
+	c.Response().Header().Set("Cache-Control", "public, max-age=300")
+	return c.JSON(http.StatusOK, h.keys.JWKS())
+}
+
+// startSession opens a new refresh token family for the user and issues the
+// first access/refresh token pair of it.
+func (h *Handler) startSession(ctx context.Context, userID int64) (*tokenPair, error) {
+	familyID, err := session.NewFamilyID()
+	if err != nil {
+		return nil, err
+	}
+
+	refreshToken, hash, err := session.NewRefreshToken()
+	if err != nil {
+		return nil, err
+	}
+
+	err = h.sessionRepo.Create(ctx, &models.RefreshToken{
+		UserID:    userID,
+		FamilyID:  familyID,
+		TokenHash: hash,
+		ExpiresAt: time.Now().Add(session.RefreshTokenTTL),
 	})
+	if err != nil {
+		return nil, err
+	}
+
+	accessToken, err := h.keys.GenerateToken(userID, familyID)
+	if err != nil {
+		return nil, err
+	}
+
+	return &tokenPair{
+		AccessToken:  accessToken,
+		RefreshToken: refreshToken,
+	}, nil
 }
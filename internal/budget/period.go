@@ -0,0 +1,37 @@
+package budget
+
+import "time"
+
+const (
+	PeriodWeek  = "week"
+	PeriodMonth = "month"
+	PeriodYear  = "year"
+)
+
+func IsValidPeriod(period string) bool {
+	switch period {
+	case PeriodWeek, PeriodMonth, PeriodYear:
+		return true
+	}
+	return false
+}
+
+// Bounds returns the [start, end) of the period containing t, computed in
+// loc. Weeks start on Monday.
+func Bounds(period string, t time.Time, loc *time.Location) (time.Time, time.Time) {
+	t = t.In(loc)
+	year, month, day := t.Date()
+
+	switch period {
+	case PeriodWeek:
+		offset := (int(t.Weekday()) + 6) % 7
+		start := time.Date(year, month, day-offset, 0, 0, 0, 0, loc)
+		return start, start.AddDate(0, 0, 7)
+	case PeriodYear:
+		start := time.Date(year, time.January, 1, 0, 0, 0, 0, loc)
+		return start, start.AddDate(1, 0, 0)
+	default:
+		start := time.Date(year, month, 1, 0, 0, 0, 0, loc)
+		return start, start.AddDate(0, 1, 0)
+	}
+}
@@ -0,0 +1,233 @@
+package budget
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"search-job/internal/category"
+	"search-job/internal/ledger"
+	"search-job/internal/models"
+	"search-job/internal/pkg/apperr"
+	"search-job/internal/pkg/money"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+type Repo struct {
+	db *pgxpool.Pool
+}
+
+func NewRepo(db *pgxpool.Pool) *Repo {
+	return &Repo{db: db}
+}
+
+const columns = `id, ledger_id, user_id, category_id, amount, currency, period, rollover, created_at, updated_at`
+
+// Create adds the budget to its ledger. ledger.ErrForbidden is returned
+// unless the user may write to it and category.ErrNotInLedger or
+// category.ErrWrongKind unless the category is a live expense category of
+// the ledger.
+func (r *Repo) Create(ctx context.Context, budget *models.Budget) error {
+	tx, err := r.db.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	var allowed bool
+	err = tx.QueryRow(ctx, `SELECT `+ledger.AccessCondition("$1", "$2", ledger.Write), budget.LedgerID, budget.UserID).Scan(&allowed)
+	if err != nil {
+		return err
+	}
+	if !allowed {
+		return ledger.ErrForbidden
+	}
+
+	if budget.CategoryID != nil {
+		err := category.Check(ctx, tx, budget.LedgerID, *budget.CategoryID, models.KindExpense)
+		var e *apperr.Error
+		if errors.As(err, &e) {
+			return e.At("category_id")
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	query := `
+		INSERT INTO budgets (ledger_id, user_id, category_id, amount, currency, period, rollover, created_at, updated_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, NOW(), NOW())
+		RETURNING id, created_at, updated_at
+	`
+
+	err = tx.QueryRow(ctx, query,
+		budget.LedgerID,
+		budget.UserID,
+		budget.CategoryID,
+		budget.Amount.Numeric(),
+		budget.Amount.Currency,
+		budget.Period,
+		budget.Rollover,
+	).Scan(&budget.ID, &budget.CreatedAt, &budget.UpdatedAt)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit(ctx)
+}
+
+// GetAll returns the budgets of the ledger, shared by its members, if the
+// user is a member of it.
+func (r *Repo) GetAll(ctx context.Context, ledgerID, userID int64) ([]models.Budget, error) {
+	query := fmt.Sprintf(`
+		SELECT %s
+		FROM budgets
+		WHERE ledger_id = $1 AND deleted_at IS NULL AND %s
+		ORDER BY category_id NULLS FIRST, period
+	`, columns, ledger.AccessCondition("budgets.ledger_id", "$2", ledger.Read))
+
+	rows, err := r.db.Query(ctx, query, ledgerID, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var budgets []models.Budget
+	for rows.Next() {
+		var b models.Budget
+		if err := scanBudget(rows, &b); err != nil {
+			return nil, err
+		}
+		budgets = append(budgets, b)
+	}
+
+	return budgets, rows.Err()
+}
+
+func (r *Repo) GetByID(ctx context.Context, id, userID int64) (*models.Budget, error) {
+	return getByID(ctx, r.db, id, userID, ledger.Read)
+}
+
+type querier interface {
+	QueryRow(ctx context.Context, sql string, args ...any) pgx.Row
+}
+
+// getByID reads a live budget of a ledger the user is a member of and
+// returns ledger.ErrForbidden if the member lacks the access. Inside a
+// transaction the row stays locked until it ends.
+func getByID(ctx context.Context, q querier, id, userID int64, access ledger.Access) (*models.Budget, error) {
+	lock := ""
+	if _, ok := q.(pgx.Tx); ok {
+		lock = "FOR UPDATE"
+	}
+
+	query := fmt.Sprintf(`
+		SELECT %s, %s
+		FROM budgets
+		WHERE id = $1 AND deleted_at IS NULL AND %s
+		%s
+	`, columns,
+		ledger.AccessCondition("budgets.ledger_id", "$2", access),
+		ledger.AccessCondition("budgets.ledger_id", "$2", ledger.Read),
+		lock)
+
+	var b models.Budget
+	var allowed bool
+	if err := scanBudget(q.QueryRow(ctx, query, id, userID), &b, &allowed); err != nil {
+		return nil, err
+	}
+	if !allowed {
+		return nil, ledger.ErrForbidden
+	}
+
+	return &b, nil
+}
+
+// Update changes the limit and period of the budget.
+// userID is the member making the change, not necessarily the author.
+func (r *Repo) Update(ctx context.Context, budget *models.Budget, userID int64) error {
+	tx, err := r.db.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	if _, err := getByID(ctx, tx, budget.ID, userID, ledger.Write); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return sql.ErrNoRows
+		}
+		return err
+	}
+
+	query := `
+		UPDATE budgets
+		SET amount = $1, currency = $2, period = $3, rollover = $4, updated_at = NOW()
+		WHERE id = $5
+		RETURNING updated_at
+	`
+
+	err = tx.QueryRow(ctx, query,
+		budget.Amount.Numeric(),
+		budget.Amount.Currency,
+		budget.Period,
+		budget.Rollover,
+		budget.ID,
+	).Scan(&budget.UpdatedAt)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit(ctx)
+}
+
+// Delete removes the budget. userID is the member deleting it, not
+// necessarily the author.
+func (r *Repo) Delete(ctx context.Context, id, userID int64) error {
+	tx, err := r.db.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	if _, err := getByID(ctx, tx, id, userID, ledger.Write); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return sql.ErrNoRows
+		}
+		return err
+	}
+
+	query := `
+		UPDATE budgets
+		SET deleted_at = NOW(), updated_at = NOW()
+		WHERE id = $1
+	`
+
+	if _, err := tx.Exec(ctx, query, id); err != nil {
+		return err
+	}
+
+	return tx.Commit(ctx)
+}
+
+// scanBudget reads the columns followed by any extra ones.
+func scanBudget(row pgx.Row, b *models.Budget, extra ...any) error {
+	var amount pgtype.Numeric
+	var currency string
+	dest := []any{
+		&b.ID, &b.LedgerID, &b.UserID, &b.CategoryID, &amount, &currency, &b.Period, &b.Rollover, &b.CreatedAt, &b.UpdatedAt,
+	}
+	err := row.Scan(append(dest, extra...)...)
+	if err != nil {
+		return err
+	}
+
+	b.Amount, err = money.FromNumeric(amount, currency)
+	if err != nil {
+		return fmt.Errorf("budget %d: %w", b.ID, err)
+	}
+
+	return nil
+}
@@ -3,12 +3,36 @@ package category
 import (
 	"context"
 	"database/sql"
+	"errors"
+	"fmt"
+	"search-job/internal/audit"
+	"search-job/internal/ledger"
 	"search-job/internal/models"
+	"search-job/internal/pkg/apperr"
+	"time"
 
 	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
 	"github.com/jackc/pgx/v5/pgxpool"
 )
 
+// MaxDepth is the number of levels a category tree may have.
+const MaxDepth = 5
+
+var (
+	ErrParentNotFound = apperr.Validation("category_parent_not_found", "parent category not found")
+	ErrCycle          = apperr.Validation("category_cycle", "category cannot be moved below itself")
+	ErrTooDeep        = apperr.Validation("category_too_deep", fmt.Sprintf("categories cannot be nested deeper than %d levels", MaxDepth))
+	ErrDuplicateName  = apperr.Conflict("category_name_taken", "category with this name already exists")
+	ErrKindMismatch   = apperr.Validation("category_kind_mismatch", "category cannot be moved below a category of another kind")
+	// ErrNotInLedger is returned for a transaction filed under a category
+	// that is not a live category of the transaction's ledger.
+	ErrNotInLedger = apperr.Validation("category_not_in_ledger", "category not found in the ledger")
+	// ErrWrongKind is returned for an income filed under an expense
+	// category or the other way around.
+	ErrWrongKind = apperr.Validation("category_wrong_kind", "category is of another kind than the transaction")
+)
+
 type Repo struct {
 	db *pgxpool.Pool
 }
@@ -17,55 +41,89 @@ func NewRepo(db *pgxpool.Pool) *Repo {
 	return &Repo{db: db}
 }
 
+// Create adds the category to its ledger. A subcategory takes the kind of
+// its parent. ledger.ErrForbidden is returned unless the user may write to
+// the ledger.
 func (r *Repo) Create(ctx context.Context, category *models.Category) error {
-	query := `
-		INSERT INTO categories (user_id, name, created_at, updated_at)
-		VALUES ($1, $2, NOW(), NOW())
+	tx, err := r.db.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	if category.ParentID != nil {
+		depth, err := depth(ctx, tx, *category.ParentID, category.LedgerID)
+		if err != nil {
+			return err
+		}
+		if depth+1 > MaxDepth {
+			return ErrTooDeep
+		}
+		if category.Kind, err = kindOf(ctx, tx, *category.ParentID); err != nil {
+			return err
+		}
+	}
+
+	query := fmt.Sprintf(`
+		INSERT INTO categories (ledger_id, user_id, parent_id, kind, name, created_at, updated_at)
+		SELECT $1, $2, $3, $4, $5, NOW(), NOW()
+		WHERE %s
 		RETURNING id, created_at, updated_at
-	`
+	`, ledger.AccessCondition("$1", "$2", ledger.Write))
 
-	return r.db.QueryRow(ctx, query, category.UserID, category.Name).Scan(
+	err = tx.QueryRow(ctx, query, category.LedgerID, category.UserID, category.ParentID, category.Kind, category.Name).Scan(
 		&category.ID, &category.CreatedAt, &category.UpdatedAt,
 	)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return ledger.ErrForbidden
+	}
+	if err != nil {
+		return duplicateName(err)
+	}
+
+	err = audit.Record(ctx, tx, audit.Event{
+		LedgerID:   category.LedgerID,
+		OwnerID:    category.UserID,
+		EntityType: audit.EntityCategory,
+		EntityID:   category.ID,
+		Action:     audit.ActionCreate,
+		After:      category,
+	})
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit(ctx)
 }
 
-func (r *Repo) GetAll(ctx context.Context, userID int64, limit, offset int, search string) ([]models.Category, int, error) {
-	countQuery := `
-		SELECT COUNT(*) 
-		FROM categories 
-		WHERE user_id = $1 AND deleted_at IS NULL
-	`
+// GetAll lists the categories of a ledger the user is a member of, all of
+// them or those of one kind.
+func (r *Repo) GetAll(ctx context.Context, ledgerID, userID int64, limit, offset int, search, kind string) ([]models.Category, int, error) {
+	where := "ledger_id = $1 AND deleted_at IS NULL AND " + ledger.AccessCondition("categories.ledger_id", "$2", ledger.Read)
+	args := []interface{}{ledgerID, userID}
 	if search != "" {
-		countQuery += " AND name ILIKE '%' || $2 || '%'"
+		args = append(args, search)
+		where += fmt.Sprintf(" AND name ILIKE '%%' || $%d || '%%'", len(args))
+	}
+	if kind != "" {
+		args = append(args, kind)
+		where += fmt.Sprintf(" AND kind = $%d", len(args))
 	}
 
 	var total int
-	var err error
-	if search != "" {
-		err = r.db.QueryRow(ctx, countQuery, userID, search).Scan(&total)
-	} else {
-		err = r.db.QueryRow(ctx, countQuery, userID).Scan(&total)
-	}
+	err := r.db.QueryRow(ctx, "SELECT COUNT(*) FROM categories WHERE "+where, args...).Scan(&total)
 	if err != nil {
 		return nil, 0, err
 	}
 
-	query := `
-		SELECT id, user_id, name, created_at, updated_at
+	query := fmt.Sprintf(`
+		SELECT id, ledger_id, user_id, parent_id, kind, name, created_at, updated_at
 		FROM categories
-		WHERE user_id = $1 AND deleted_at IS NULL
-	`
-	if search != "" {
-		query += " AND name ILIKE '%' || $2 || '%'"
-	}
-	query += " ORDER BY name LIMIT $3 OFFSET $4"
+		WHERE %s
+		ORDER BY name LIMIT $%d OFFSET $%d
+	`, where, len(args)+1, len(args)+2)
 
-	var rows pgx.Rows
-	if search != "" {
-		rows, err = r.db.Query(ctx, query, userID, search, limit, offset)
-	} else {
-		rows, err = r.db.Query(ctx, query, userID, limit, offset)
-	}
+	rows, err := r.db.Query(ctx, query, append(args, limit, offset)...)
 	if err != nil {
 		return nil, 0, err
 	}
@@ -74,8 +132,7 @@ func (r *Repo) GetAll(ctx context.Context, userID int64, limit, offset int, sear
 	var categories []models.Category
 	for rows.Next() {
 		var c models.Category
-		err := rows.Scan(&c.ID, &c.UserID, &c.Name, &c.CreatedAt, &c.UpdatedAt)
-		if err != nil {
+		if err := scanCategory(rows, &c); err != nil {
 			return nil, 0, err
 		}
 		categories = append(categories, c)
@@ -84,60 +141,469 @@ func (r *Repo) GetAll(ctx context.Context, userID int64, limit, offset int, sear
 	return categories, total, nil
 }
 
+// GetByID returns a category of any ledger the user is a member of.
 func (r *Repo) GetByID(ctx context.Context, id, userID int64) (*models.Category, error) {
-	query := `
-		SELECT id, user_id, name, created_at, updated_at
+	return getByID(ctx, r.db, id, userID, ledger.Read)
+}
+
+type querier interface {
+	QueryRow(ctx context.Context, sql string, args ...any) pgx.Row
+}
+
+// getByID reads a live category of a ledger the user is a member of and
+// returns ledger.ErrForbidden if the member lacks the access. Inside a
+// transaction the row stays locked until it ends.
+func getByID(ctx context.Context, q querier, id, userID int64, access ledger.Access) (*models.Category, error) {
+	lock := ""
+	if _, ok := q.(pgx.Tx); ok {
+		lock = "FOR UPDATE"
+	}
+
+	query := fmt.Sprintf(`
+		SELECT id, ledger_id, user_id, parent_id, kind, name, created_at, updated_at, %s
 		FROM categories
-		WHERE id = $1 AND user_id = $2 AND deleted_at IS NULL
-	`
+		WHERE id = $1 AND deleted_at IS NULL AND %s
+		%s
+	`, ledger.AccessCondition("categories.ledger_id", "$2", access), ledger.AccessCondition("categories.ledger_id", "$2", ledger.Read), lock)
 
 	var c models.Category
-	err := r.db.QueryRow(ctx, query, id, userID).Scan(
-		&c.ID, &c.UserID, &c.Name, &c.CreatedAt, &c.UpdatedAt,
-	)
-	if err != nil {
+	var allowed bool
+	if err := scanCategory(q.QueryRow(ctx, query, id, userID), &c, &allowed); err != nil {
 		return nil, err
 	}
+	if !allowed {
+		return nil, ledger.ErrForbidden
+	}
 
 	return &c, nil
 }
 
-func (r *Repo) Update(ctx context.Context, category *models.Category) error {
-	query := `
-		UPDATE categories
-		SET name = $1, updated_at = NOW()
-		WHERE id = $2 AND user_id = $3 AND deleted_at IS NULL
-	`
+func scanCategory(row pgx.Row, c *models.Category, extra ...any) error {
+	dest := []any{&c.ID, &c.LedgerID, &c.UserID, &c.ParentID, &c.Kind, &c.Name, &c.CreatedAt, &c.UpdatedAt}
+	return row.Scan(append(dest, extra...)...)
+}
 
-	result, err := r.db.Exec(ctx, query, category.Name, category.ID, category.UserID)
+// Update renames the category and moves it below ParentID, or to the top
+// level when ParentID is nil. A category cannot be moved below one of its
+// own descendants nor below a category of another kind, and the moved
+// subtree must still fit into MaxDepth. userID is the member making the
+// change.
+func (r *Repo) Update(ctx context.Context, category *models.Category, userID int64) error {
+	tx, err := r.db.Begin(ctx)
 	if err != nil {
 		return err
 	}
+	defer tx.Rollback(ctx)
 
-	rowsAffected := result.RowsAffected()
-	if rowsAffected == 0 {
+	before, err := getByID(ctx, tx, category.ID, userID, ledger.Write)
+	if errors.Is(err, pgx.ErrNoRows) {
 		return sql.ErrNoRows
 	}
+	if err != nil {
+		return err
+	}
 
-	return nil
-}
+	// lock the ledger's categories so that two concurrent moves cannot
+	// build a cycle together
+	_, err = tx.Exec(ctx, `SELECT id FROM categories WHERE ledger_id = $1 AND deleted_at IS NULL FOR UPDATE`, before.LedgerID)
+	if err != nil {
+		return err
+	}
+
+	if category.ParentID != nil {
+		if *category.ParentID == category.ID {
+			return ErrCycle
+		}
+
+		var isDescendant bool
+		var height int
+		err := tx.QueryRow(ctx, `
+			WITH RECURSIVE sub AS (
+				SELECT id, 1 AS level FROM categories WHERE id = $1
+				UNION ALL
+				SELECT c.id, sub.level + 1 FROM categories c JOIN sub ON c.parent_id = sub.id
+				WHERE c.deleted_at IS NULL
+			)
+			SELECT COALESCE(bool_or(id = $2), FALSE), COALESCE(MAX(level), 1) FROM sub
+		`, category.ID, *category.ParentID).Scan(&isDescendant, &height)
+		if err != nil {
+			return err
+		}
+		if isDescendant {
+			return ErrCycle
+		}
+
+		depth, err := depth(ctx, tx, *category.ParentID, before.LedgerID)
+		if err != nil {
+			return err
+		}
+		if depth+height > MaxDepth {
+			return ErrTooDeep
+		}
+
+		kind, err := kindOf(ctx, tx, *category.ParentID)
+		if err != nil {
+			return err
+		}
+		if kind != before.Kind {
+			return ErrKindMismatch
+		}
+	}
 
-func (r *Repo) Delete(ctx context.Context, id, userID int64) error {
 	query := `
 		UPDATE categories
-		SET deleted_at = NOW(), updated_at = NOW()
-		WHERE id = $1 AND user_id = $2 AND deleted_at IS NULL
+		SET name = $1, parent_id = $2, updated_at = NOW()
+		WHERE id = $3
+		RETURNING created_at, updated_at
 	`
 
-	result, err := r.db.Exec(ctx, query, id, userID)
+	err = tx.QueryRow(ctx, query, category.Name, category.ParentID, category.ID).Scan(
+		&category.CreatedAt, &category.UpdatedAt,
+	)
+	if err != nil {
+		return duplicateName(err)
+	}
+
+	err = audit.Record(ctx, tx, audit.Event{
+		LedgerID:   before.LedgerID,
+		OwnerID:    before.UserID,
+		EntityType: audit.EntityCategory,
+		EntityID:   category.ID,
+		Action:     audit.ActionUpdate,
+		Before:     before,
+		After:      category,
+	})
 	if err != nil {
 		return err
 	}
 
-	rowsAffected := result.RowsAffected()
-	if rowsAffected == 0 {
+	return tx.Commit(ctx)
+}
+
+// Delete removes the category together with all its descendants.
+func (r *Repo) Delete(ctx context.Context, id, userID int64) error {
+	tx, err := r.db.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	if _, err := getByID(ctx, tx, id, userID, ledger.Write); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return sql.ErrNoRows
+		}
+		return err
+	}
+
+	rows, err := tx.Query(ctx, fmt.Sprintf(`
+		SELECT id, ledger_id, user_id, parent_id, kind, name, created_at, updated_at
+		FROM categories
+		WHERE id IN (%s) AND deleted_at IS NULL
+		FOR UPDATE
+	`, DescendantsQuery("$1")), id)
+	if err != nil {
+		return err
+	}
+
+	var events []audit.Event
+	var ids []int64
+	for rows.Next() {
+		var c models.Category
+		if err := scanCategory(rows, &c); err != nil {
+			rows.Close()
+			return err
+		}
+		ids = append(ids, c.ID)
+		events = append(events, audit.Event{
+			LedgerID:   c.LedgerID,
+			OwnerID:    c.UserID,
+			EntityType: audit.EntityCategory,
+			EntityID:   c.ID,
+			Action:     audit.ActionDelete,
+			Before:     c,
+		})
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	if len(ids) == 0 {
 		return sql.ErrNoRows
 	}
 
+	_, err = tx.Exec(ctx, `
+		UPDATE categories
+		SET deleted_at = NOW(), updated_at = NOW()
+		WHERE id = ANY($1)
+	`, ids)
+	if err != nil {
+		return err
+	}
+
+	if err := audit.Record(ctx, tx, events...); err != nil {
+		return err
+	}
+
+	return tx.Commit(ctx)
+}
+
+// Restore brings a deleted category back together with the descendants
+// that were deleted along with it. A category whose parent is still in the
+// trash is restored at the top level, and one whose name has been taken by
+// a sibling in the meantime gets a numbered suffix. The restored category
+// is returned.
+func (r *Repo) Restore(ctx context.Context, id, userID int64) (*models.Category, error) {
+	tx, err := r.db.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback(ctx)
+
+	var c models.Category
+	var deletedAt time.Time
+	var parentDeleted bool
+	err = tx.QueryRow(ctx, fmt.Sprintf(`
+		SELECT c.id, c.ledger_id, c.user_id, c.parent_id, c.kind, c.name, c.created_at, c.deleted_at,
+		       p.id IS NOT NULL AND p.deleted_at IS NOT NULL
+		FROM categories c
+		LEFT JOIN categories p ON p.id = c.parent_id
+		WHERE c.id = $1 AND c.deleted_at IS NOT NULL AND %s
+		FOR UPDATE OF c
+	`, ledger.AccessCondition("c.ledger_id", "$2", ledger.Write)), id, userID).Scan(
+		&c.ID, &c.LedgerID, &c.UserID, &c.ParentID, &c.Kind, &c.Name, &c.CreatedAt, &deletedAt, &parentDeleted,
+	)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, sql.ErrNoRows
+	}
+	if err != nil {
+		return nil, err
+	}
+	if parentDeleted {
+		c.ParentID = nil
+	}
+
+	name, err := freeName(ctx, tx, c.LedgerID, c.Kind, c.ParentID, c.Name)
+	if err != nil {
+		return nil, err
+	}
+	c.Name = name
+
+	err = tx.QueryRow(ctx, `
+		UPDATE categories
+		SET name = $1, parent_id = $2, deleted_at = NULL, updated_at = NOW()
+		WHERE id = $3
+		RETURNING updated_at
+	`, c.Name, c.ParentID, c.ID).Scan(&c.UpdatedAt)
+	if err != nil {
+		return nil, duplicateName(err)
+	}
+
+	events := []audit.Event{{
+		LedgerID:   c.LedgerID,
+		OwnerID:    c.UserID,
+		EntityType: audit.EntityCategory,
+		EntityID:   c.ID,
+		Action:     audit.ActionRestore,
+		After:      c,
+	}}
+
+	// descendants deleted in the same statement share the timestamp
+	rows, err := tx.Query(ctx, `
+		WITH RECURSIVE sub AS (
+			SELECT id FROM categories WHERE parent_id = $1 AND deleted_at = $2
+			UNION ALL
+			SELECT c.id FROM categories c JOIN sub ON c.parent_id = sub.id
+			WHERE c.deleted_at = $2
+		)
+		UPDATE categories SET deleted_at = NULL, updated_at = NOW()
+		WHERE id IN (SELECT id FROM sub)
+		RETURNING id, ledger_id, user_id, parent_id, kind, name, created_at, updated_at
+	`, c.ID, deletedAt)
+	if err != nil {
+		return nil, err
+	}
+	for rows.Next() {
+		var child models.Category
+		if err := scanCategory(rows, &child); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		events = append(events, audit.Event{
+			LedgerID:   child.LedgerID,
+			OwnerID:    child.UserID,
+			EntityType: audit.EntityCategory,
+			EntityID:   child.ID,
+			Action:     audit.ActionRestore,
+			After:      child,
+		})
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, duplicateName(err)
+	}
+
+	if err := audit.Record(ctx, tx, events...); err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return nil, err
+	}
+
+	return &c, nil
+}
+
+// freeName returns name, or name with the first free suffix " (2)", " (3)"
+// and so on if a live sibling already uses it.
+func freeName(ctx context.Context, tx pgx.Tx, ledgerID int64, kind string, parentID *int64, name string) (string, error) {
+	for i := 1; ; i++ {
+		candidate := name
+		if i > 1 {
+			candidate = fmt.Sprintf("%s (%d)", name, i)
+		}
+
+		var taken bool
+		err := tx.QueryRow(ctx, `
+			SELECT EXISTS (
+				SELECT 1 FROM categories
+				WHERE ledger_id = $1 AND kind = $2 AND COALESCE(parent_id, 0) = COALESCE($3::bigint, 0)
+				  AND name = $4 AND deleted_at IS NULL
+			)
+		`, ledgerID, kind, parentID, candidate).Scan(&taken)
+		if err != nil {
+			return "", err
+		}
+		if !taken {
+			return candidate, nil
+		}
+	}
+}
+
+// GetTree returns the top level categories of a ledger the user is a
+// member of with their descendants in Children, sorted by name on every
+// level.
+func (r *Repo) GetTree(ctx context.Context, ledgerID, userID int64) ([]models.Category, error) {
+	query := fmt.Sprintf(`
+		SELECT id, ledger_id, user_id, parent_id, kind, name, created_at, updated_at
+		FROM categories
+		WHERE ledger_id = $1 AND deleted_at IS NULL AND %s
+		ORDER BY kind, name
+	`, ledger.AccessCondition("categories.ledger_id", "$2", ledger.Read))
+
+	rows, err := r.db.Query(ctx, query, ledgerID, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var categories []models.Category
+	for rows.Next() {
+		var c models.Category
+		if err := scanCategory(rows, &c); err != nil {
+			return nil, err
+		}
+		categories = append(categories, c)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return BuildTree(categories), nil
+}
+
+// BuildTree nests a flat list of categories, keeping their order among
+// siblings.
+func BuildTree(categories []models.Category) []models.Category {
+	children := make(map[int64][]models.Category)
+	var roots []models.Category
+	for _, c := range categories {
+		if c.ParentID == nil {
+			roots = append(roots, c)
+		} else {
+			children[*c.ParentID] = append(children[*c.ParentID], c)
+		}
+	}
+
+	var attach func(nodes []models.Category) []models.Category
+	attach = func(nodes []models.Category) []models.Category {
+		for i := range nodes {
+			nodes[i].Children = attach(children[nodes[i].ID])
+		}
+		return nodes
+	}
+
+	return attach(roots)
+}
+
+// DescendantsQuery returns a subquery selecting the ids of the category
+// idExpr and all of its live descendants.
+func DescendantsQuery(idExpr string) string {
+	return fmt.Sprintf(`
+		WITH RECURSIVE sub AS (
+			SELECT id FROM categories WHERE id = %s
+			UNION ALL
+			SELECT c.id FROM categories c JOIN sub ON c.parent_id = sub.id
+			WHERE c.deleted_at IS NULL
+		)
+		SELECT id FROM sub`, idExpr)
+}
+
+// depth returns the level of a live category of the ledger, starting at 1
+// for top level categories.
+func depth(ctx context.Context, tx pgx.Tx, id, ledgerID int64) (int, error) {
+	var level *int
+	err := tx.QueryRow(ctx, `
+		WITH RECURSIVE up AS (
+			SELECT id, parent_id, 1 AS level FROM categories
+			WHERE id = $1 AND ledger_id = $2 AND deleted_at IS NULL
+			UNION ALL
+			SELECT c.id, c.parent_id, up.level + 1 FROM categories c JOIN up ON c.id = up.parent_id
+		)
+		SELECT MAX(level) FROM up
+	`, id, ledgerID).Scan(&level)
+	if err != nil {
+		return 0, err
+	}
+	// MAX over no rows is NULL when the category does not exist
+	if level == nil {
+		return 0, ErrParentNotFound
+	}
+
+	return *level, nil
+}
+
+// Check makes sure a transaction of the kind may be filed under the
+// category: it must be a live category of the ledger and of the same kind.
+func Check(ctx context.Context, tx pgx.Tx, ledgerID, id int64, kind string) error {
+	var actual string
+	err := tx.QueryRow(ctx, `
+		SELECT kind FROM categories
+		WHERE id = $1 AND ledger_id = $2 AND deleted_at IS NULL
+	`, id, ledgerID).Scan(&actual)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return ErrNotInLedger
+	}
+	if err != nil {
+		return err
+	}
+	if actual != kind {
+		return ErrWrongKind
+	}
+
 	return nil
 }
+
+// kindOf returns the kind of a category.
+func kindOf(ctx context.Context, tx pgx.Tx, id int64) (string, error) {
+	var kind string
+	err := tx.QueryRow(ctx, `SELECT kind FROM categories WHERE id = $1`, id).Scan(&kind)
+	return kind, err
+}
+
+func duplicateName(err error) error {
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) && pgErr.Code == "23505" {
+		return ErrDuplicateName
+	}
+	return err
+}
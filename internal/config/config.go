@@ -2,22 +2,48 @@ package config
 
 import (
 	"fmt"
+	"search-job/internal/pkg/jwt"
 	"search-job/internal/pkg/postgres"
+	"search-job/internal/pkg/storage"
 	"strconv"
+	"time"
 
 	"github.com/spf13/viper"
 )
 
 type Config struct {
-	IsProd   bool
-	Web      *WebParams
-	Postgres *postgres.ConnectionData
+	IsProd      bool
+	Web         *WebParams
+	Postgres    *postgres.ConnectionData
+	AutoMigrate bool
+	JWT         *jwt.KeyManagerConfig
+	Scheduler   *SchedulerParams
+	Storage     *storage.Config
+	Trash       *TrashParams
 }
 
 type WebParams struct {
 	Port uint16
 }
 
+type SchedulerParams struct {
+	Interval time.Duration
+}
+
+// TrashParams configures how long deleted items are kept. A zero
+// Retention keeps them forever.
+type TrashParams struct {
+	Retention time.Duration
+	Interval  time.Duration
+}
+
+type jwtKeyParams struct {
+	KID            string `mapstructure:"kid"`
+	Algorithm      string `mapstructure:"alg"`
+	PrivateKeyPath string `mapstructure:"privateKeyPath"`
+	ActiveFrom     string `mapstructure:"activeFrom"`
+}
+
 func NewConfig() (*Config, error) {
 	viper.SetConfigName("config")
 	viper.SetConfigType("yaml")
@@ -46,12 +72,40 @@ func NewConfig() (*Config, error) {
 			DBName:   viper.GetString("server.pg.database"),
 			SSLMode:  viper.GetString("server.pg.sslmode"),
 		},
+		AutoMigrate: viper.GetBool("server.pg.autoMigrate"),
+		Scheduler: &SchedulerParams{
+			Interval: viper.GetDuration("server.scheduler.interval"),
+		},
+		Storage: &storage.Config{
+			Driver: viper.GetString("server.storage.driver"),
+			Dir:    viper.GetString("server.storage.dir"),
+			S3: storage.S3Config{
+				Endpoint:  viper.GetString("server.storage.s3.endpoint"),
+				AccessKey: viper.GetString("server.storage.s3.accessKey"),
+				SecretKey: viper.GetString("server.storage.s3.secretKey"),
+				Bucket:    viper.GetString("server.storage.s3.bucket"),
+				Region:    viper.GetString("server.storage.s3.region"),
+				UseSSL:    viper.GetBool("server.storage.s3.useSSL"),
+			},
+			MaxFileSize: int64(viper.GetSizeInBytes("server.storage.maxFileSize")),
+			UserQuota:   int64(viper.GetSizeInBytes("server.storage.userQuota")),
+		},
+		Trash: &TrashParams{
+			Retention: time.Duration(viper.GetInt("server.trash.retentionDays")) * 24 * time.Hour,
+			Interval:  viper.GetDuration("server.trash.interval"),
+		},
 	}
 
 	if cfg.Postgres.User == "" || cfg.Postgres.Host == "" || cfg.Postgres.DBName == "" {
 		return nil, fmt.Errorf("incomplete postgres configuration")
 	}
 
+	jwtCfg, err := newJWTConfig(cfg.IsProd)
+	if err != nil {
+		return nil, err
+	}
+	cfg.JWT = jwtCfg
+
 	return cfg, nil
 }
 
@@ -61,3 +115,33 @@ func (cfg *Config) GetWebPort() string {
 	}
 	return ":" + strconv.Itoa(int(cfg.Web.Port))
 }
+
+func newJWTConfig(isProd bool) (*jwt.KeyManagerConfig, error) {
+	var keys []jwtKeyParams
+	if err := viper.UnmarshalKey("server.jwt.keys", &keys); err != nil {
+		return nil, fmt.Errorf("invalid server.jwt.keys: %w", err)
+	}
+
+	cfg := &jwt.KeyManagerConfig{
+		GracePeriod:    viper.GetDuration("server.jwt.gracePeriod"),
+		AllowEphemeral: !isProd,
+	}
+
+	for _, k := range keys {
+		key := jwt.KeyConfig{
+			KID:            k.KID,
+			Algorithm:      k.Algorithm,
+			PrivateKeyPath: k.PrivateKeyPath,
+		}
+		if k.ActiveFrom != "" {
+			activeFrom, err := time.Parse(time.RFC3339, k.ActiveFrom)
+			if err != nil {
+				return nil, fmt.Errorf("invalid activeFrom for jwt key %q: %w", k.KID, err)
+			}
+			key.ActiveFrom = activeFrom
+		}
+		cfg.Keys = append(cfg.Keys, key)
+	}
+
+	return cfg, nil
+}
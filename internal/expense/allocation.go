@@ -0,0 +1,206 @@
+package expense
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"search-job/internal/category"
+	"search-job/internal/models"
+	"search-job/internal/pkg/apperr"
+	"search-job/internal/pkg/money"
+	"slices"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+var (
+	ErrAllocationSum      = apperr.Validation("allocation_sum", "allocations must add up to the expense amount")
+	ErrAllocationCategory = apperr.Validation("allocation_category_not_found", "allocation category not found in the ledger")
+)
+
+// expenseLines selects the category lines of the expense aliased as e: its
+// allocations or, without any, the whole expense in its own category.
+// Analytics and category filters work on lines, so that every part of a
+// divided expense counts towards its own category.
+const expenseLines = `(
+	SELECT a.category_id, a.amount FROM expense_allocations a WHERE a.expense_id = e.id
+	UNION ALL
+	SELECT e.category_id, e.amount
+	WHERE NOT EXISTS (SELECT 1 FROM expense_allocations a WHERE a.expense_id = e.id)
+)`
+
+// checkAllocations verifies that the allocations are in the currency of
+// total and add up to it. No allocations are always fine.
+func checkAllocations(total money.Money, allocations []models.Allocation) error {
+	if len(allocations) == 0 {
+		return nil
+	}
+
+	sum := money.Money{Currency: total.Currency}
+	for _, a := range allocations {
+		if a.CategoryID == nil || a.Amount.IsZero() {
+			return ErrAllocationSum
+		}
+		var err error
+		if sum, err = sum.Add(a.Amount); err != nil {
+			return ErrAllocationSum
+		}
+	}
+	if sum != total {
+		return ErrAllocationSum
+	}
+
+	return nil
+}
+
+// checkCategories makes sure the category of the expense and those of its
+// allocations are live categories of the ledger and of the expense's kind.
+// On update, categories the expense had before are not checked again
+// unless its kind changes, so that it may keep a category deleted since.
+func checkCategories(ctx context.Context, tx pgx.Tx, ledgerID int64, expense, before *models.Expense) error {
+	known := map[int64]bool{}
+	if before != nil && before.Kind == expense.Kind {
+		if before.CategoryID != nil {
+			known[*before.CategoryID] = true
+		}
+		for _, a := range before.Allocations {
+			if a.CategoryID != nil {
+				known[*a.CategoryID] = true
+			}
+		}
+	}
+
+	check := func(id *int64, field string) error {
+		if id == nil || known[*id] {
+			return nil
+		}
+		err := category.Check(ctx, tx, ledgerID, *id, expense.Kind)
+		var e *apperr.Error
+		if errors.As(err, &e) {
+			return e.At(field)
+		}
+		return err
+	}
+
+	if err := check(expense.CategoryID, "category_id"); err != nil {
+		return err
+	}
+	for i, a := range expense.Allocations {
+		if err := check(a.CategoryID, fmt.Sprintf("allocations[%d].category_id", i)); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// sameAllocations reports whether a and b divide an expense the same way,
+// in the same order. Category names are not compared, as only loaded
+// allocations have them.
+func sameAllocations(a, b []models.Allocation) bool {
+	return slices.EqualFunc(a, b, func(x, y models.Allocation) bool {
+		return equalPtr(x.CategoryID, y.CategoryID) && x.Amount == y.Amount && equalPtr(x.Comment, y.Comment)
+	})
+}
+
+// allocationCategories returns the categories of the allocations of e.
+func allocationCategories(e *models.Expense) []int64 {
+	var ids []int64
+	for _, a := range e.Allocations {
+		if a.CategoryID != nil {
+			ids = append(ids, *a.CategoryID)
+		}
+	}
+	return ids
+}
+
+func equalPtr[T comparable](a, b *T) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return *a == *b
+}
+
+// assignAllocations replaces the allocations of an expense within tx.
+// ErrAllocationCategory is returned if a category is not a live category
+// of the ledger or one of keep, the categories the expense had before,
+// which may have been deleted since.
+func assignAllocations(ctx context.Context, tx pgx.Tx, ledgerID, expenseID int64, allocations []models.Allocation, keep []int64) error {
+	if _, err := tx.Exec(ctx, `DELETE FROM expense_allocations WHERE expense_id = $1`, expenseID); err != nil {
+		return err
+	}
+	if len(allocations) == 0 {
+		return nil
+	}
+
+	categoryIDs := make([]int64, len(allocations))
+	amounts := make([]pgtype.Numeric, len(allocations))
+	comments := make([]*string, len(allocations))
+	for i, a := range allocations {
+		categoryIDs[i] = *a.CategoryID
+		amounts[i] = a.Amount.Numeric()
+		comments[i] = a.Comment
+	}
+
+	result, err := tx.Exec(ctx, `
+		INSERT INTO expense_allocations (expense_id, category_id, amount, comment)
+		SELECT $1, a.category_id, a.amount, a.comment
+		FROM unnest($2::bigint[], $3::numeric[], $4::text[]) WITH ORDINALITY AS a(category_id, amount, comment, n)
+		JOIN categories c ON c.id = a.category_id AND c.ledger_id = $5
+		 AND (c.deleted_at IS NULL OR c.id = ANY($6::bigint[]))
+		ORDER BY a.n
+	`, expenseID, categoryIDs, amounts, comments, ledgerID, keep)
+	if err != nil {
+		return err
+	}
+	if result.RowsAffected() != int64(len(allocations)) {
+		return ErrAllocationCategory
+	}
+
+	return nil
+}
+
+// loadAllocations fills Allocations of the given expenses in the order
+// they were stored.
+func loadAllocations(ctx context.Context, q querier, expenses []models.Expense) error {
+	if len(expenses) == 0 {
+		return nil
+	}
+
+	byID := make(map[int64]*models.Expense, len(expenses))
+	ids := make([]int64, len(expenses))
+	for i := range expenses {
+		byID[expenses[i].ID] = &expenses[i]
+		ids[i] = expenses[i].ID
+	}
+
+	rows, err := q.Query(ctx, `
+		SELECT a.expense_id, a.category_id, c.name, a.amount, a.comment
+		FROM expense_allocations a
+		LEFT JOIN categories c ON c.id = a.category_id AND c.deleted_at IS NULL
+		WHERE a.expense_id = ANY($1)
+		ORDER BY a.expense_id, a.id
+	`, ids)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var expenseID int64
+		var a models.Allocation
+		var amount pgtype.Numeric
+		if err := rows.Scan(&expenseID, &a.CategoryID, &a.CategoryName, &amount, &a.Comment); err != nil {
+			return err
+		}
+
+		e := byID[expenseID]
+		if a.Amount, err = money.FromNumeric(amount, e.Amount.Currency); err != nil {
+			return fmt.Errorf("expense %d: %w", expenseID, err)
+		}
+		e.Allocations = append(e.Allocations, a)
+	}
+
+	return rows.Err()
+}
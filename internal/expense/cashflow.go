@@ -0,0 +1,125 @@
+package expense
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"search-job/internal/models"
+	"search-job/internal/pkg/money"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+type CashFlowParams struct {
+	// Filter selects the transactions; its Kind is ignored, since both
+	// kinds are needed.
+	Filter GetExpensesParams
+	// Period is one of GroupByDay, GroupByWeek, GroupByMonth and
+	// GroupByYear.
+	Period string
+	// Location is the time zone periods are aligned to.
+	Location *time.Location
+}
+
+// CashFlow sums income and spending per period. Without a base currency in
+// the filter rows are split by currency as well.
+func (r *Repo) CashFlow(ctx context.Context, params CashFlowParams) ([]models.CashFlowRow, error) {
+	switch params.Period {
+	case GroupByDay, GroupByWeek, GroupByMonth, GroupByYear:
+	default:
+		return nil, fmt.Errorf("%w: %q", ErrInvalidGroupBy, params.Period)
+	}
+	if params.Location == nil {
+		params.Location = time.UTC
+	}
+
+	filter := params.Filter
+	filter.Kind = ""
+	where, args := lineConditions(filter)
+	arg := func(v interface{}) string {
+		args = append(args, v)
+		return fmt.Sprintf("$%d", len(args))
+	}
+
+	tz := arg(params.Location.String())
+	keys := []string{fmt.Sprintf("date_trunc('%s', e.occurred_at AT TIME ZONE %s) AT TIME ZONE %s", params.Period, tz, tz)}
+
+	amount := "l.amount"
+	unconverted := "0"
+	if filter.BaseCurrency != "" {
+		scale, err := money.Scale(filter.BaseCurrency)
+		if err != nil {
+			return nil, err
+		}
+		amount = convertedAmount("l.amount", arg(filter.BaseCurrency))
+		unconverted = fmt.Sprintf("COUNT(DISTINCT e.id) FILTER (WHERE (%s) IS NULL)", amount)
+		amount = fmt.Sprintf("ROUND(%s, %s)", amount, arg(scale))
+	} else {
+		keys = append(keys, "e.currency")
+	}
+
+	sumOf := func(kind string) string {
+		return fmt.Sprintf("COALESCE(SUM(%s) FILTER (WHERE e.kind = %s), 0)", amount, arg(kind))
+	}
+
+	positions := make([]string, len(keys))
+	for i := range keys {
+		positions[i] = fmt.Sprint(i + 1)
+	}
+
+	query := fmt.Sprintf(`
+		SELECT %s, %s, %s, %s
+		FROM expenses e
+		CROSS JOIN LATERAL %s l
+		WHERE %s
+		GROUP BY %s
+		ORDER BY %s
+	`, strings.Join(keys, ", "), sumOf(models.KindIncome), sumOf(models.KindExpense), unconverted,
+		expenseLines, strings.Join(where, " AND "),
+		strings.Join(positions, ", "), strings.Join(positions, ", "))
+
+	rows, err := r.db.Query(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	result := []models.CashFlowRow{}
+	for rows.Next() {
+		var row models.CashFlowRow
+		var income, spent pgtype.Numeric
+
+		dest := []any{&row.Period}
+		if filter.BaseCurrency == "" {
+			dest = append(dest, &row.Currency)
+		}
+		dest = append(dest, &income, &spent, &row.Unconverted)
+		if err := rows.Scan(dest...); err != nil {
+			return nil, err
+		}
+
+		row.Period = row.Period.In(params.Location)
+		if filter.BaseCurrency != "" {
+			row.Currency = filter.BaseCurrency
+		}
+		if row.Income, err = money.FromNumeric(income, row.Currency); err != nil {
+			return nil, err
+		}
+		if row.Expenses, err = money.FromNumeric(spent, row.Currency); err != nil {
+			return nil, err
+		}
+		if row.Net, err = row.Income.Sub(row.Expenses); err != nil {
+			return nil, err
+		}
+		if row.Income.Amount > 0 {
+			rate := math.Round(float64(row.Net.Amount)/float64(row.Income.Amount)*10000) / 100
+			row.SavingsRate = &rate
+		}
+
+		result = append(result, row)
+	}
+
+	return result, rows.Err()
+}
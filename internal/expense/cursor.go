@@ -0,0 +1,104 @@
+package expense
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"search-job/internal/models"
+	"search-job/internal/pkg/apperr"
+	"search-job/internal/pkg/money"
+	"time"
+)
+
+var ErrInvalidCursor = apperr.Validation("invalid_cursor", "cursor is not a position in this list")
+
+// Cursor is a position in an expense list: the sort key and id of the
+// expense a page starts after or, when Backward, ends before. It is made
+// for one Sort and Order and given to clients only encoded.
+type Cursor struct {
+	Sort     string     `json:"s"`
+	Order    string     `json:"o"`
+	Backward bool       `json:"b,omitempty"`
+	ID       int64      `json:"i"`
+	Time     *time.Time `json:"t,omitempty"`
+	// Amount is the exact decimal, as numbers in JSON may lose digits.
+	Amount string   `json:"a,omitempty"`
+	Rank   *float64 `json:"r,omitempty"`
+}
+
+// Page is a page of GetAll. A cursor is nil at the end of the list in its
+// direction and Total is nil unless counting was asked for.
+type Page struct {
+	Items      []models.Expense
+	NextCursor *string
+	PrevCursor *string
+	Total      *int
+}
+
+// cursorAt returns the cursor pointing at e in the order of params.
+func cursorAt(params GetExpensesParams, e models.Expense, backward bool) Cursor {
+	c := Cursor{Sort: params.Sort, Order: params.Order, Backward: backward, ID: e.ID}
+	switch params.Sort {
+	case SortAmount:
+		c.Amount = e.Amount.Decimal()
+	case SortRelevance:
+		rank := e.Search.Rank
+		c.Rank = &rank
+	default:
+		t := e.OccurredAt
+		c.Time = &t
+	}
+	return c
+}
+
+// key returns the sort key of the cursor as a query argument.
+func (c Cursor) key() interface{} {
+	switch c.Sort {
+	case SortAmount:
+		n, _ := money.ParseNumeric(c.Amount)
+		return n
+	case SortRelevance:
+		return *c.Rank
+	}
+	return *c.Time
+}
+
+// Encode returns the cursor in the opaque form given to clients.
+func (c Cursor) Encode() string {
+	data, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+// DecodeCursor reads a cursor made by Encode. It fails with
+// ErrInvalidCursor for anything else.
+func DecodeCursor(s string) (Cursor, error) {
+	data, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return Cursor{}, ErrInvalidCursor
+	}
+
+	var c Cursor
+	if err := json.Unmarshal(data, &c); err != nil || c.ID < 1 {
+		return Cursor{}, ErrInvalidCursor
+	}
+	switch c.Sort {
+	case SortOccurredAt:
+		if c.Time == nil {
+			return Cursor{}, ErrInvalidCursor
+		}
+	case SortAmount:
+		if _, err := money.ParseNumeric(c.Amount); err != nil {
+			return Cursor{}, ErrInvalidCursor
+		}
+	case SortRelevance:
+		if c.Rank == nil {
+			return Cursor{}, ErrInvalidCursor
+		}
+	default:
+		return Cursor{}, ErrInvalidCursor
+	}
+	if c.Order != OrderAsc && c.Order != OrderDesc {
+		return Cursor{}, ErrInvalidCursor
+	}
+
+	return c, nil
+}
@@ -3,11 +3,23 @@ package expense
 import (
 	"context"
 	"database/sql"
+	"errors"
 	"fmt"
+	"search-job/internal/account"
+	"search-job/internal/audit"
+	"search-job/internal/category"
+	"search-job/internal/ledger"
 	"search-job/internal/models"
+	"search-job/internal/pkg/money"
+	"search-job/internal/rates"
+	"search-job/internal/split"
+	"search-job/internal/tag"
+	"slices"
 	"strings"
 	"time"
 
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
 	"github.com/jackc/pgx/v5/pgxpool"
 )
 
@@ -19,207 +31,773 @@ func NewRepo(db *pgxpool.Pool) *Repo {
 	return &Repo{db: db}
 }
 
+// Orders of GetAll: by the time an expense occurred or by its amount,
+// descending or ascending.
+const (
+	SortOccurredAt = "occurred_at"
+	SortAmount     = "amount"
+	// SortRelevance puts the best matches of Search first and applies
+	// only when searching.
+	SortRelevance = "relevance"
+	OrderDesc     = "desc"
+	OrderAsc      = "asc"
+)
+
+// GetExpensesParams selects expenses of LedgerID, which UserID must be a
+// member of.
 type GetExpensesParams struct {
-	UserID     int64
+	LedgerID int64
+	UserID   int64
+	// Kind limits the result to expenses or incomes; both when empty.
+	Kind       string
 	From       *time.Time
 	To         *time.Time
 	CategoryID *int64
-	MinAmount  *float64
-	MaxAmount  *float64
-	Search     string
-	Sort       string
-	Order      string
-	Limit      int
-	Offset     int
+	AccountID  *int64
+	// IncludeSubcategories widens the CategoryID filter to the descendants
+	// of the category.
+	IncludeSubcategories bool
+	MinAmount            *pgtype.Numeric
+	MaxAmount            *pgtype.Numeric
+	// Search finds expenses by the words of their merchant, comment and
+	// category names, allowing for typos.
+	Search string
+	// TagsAny, TagsAll and TagsNone match tag names case insensitively.
+	TagsAny  []string
+	TagsAll  []string
+	TagsNone []string
+	// BaseCurrency, when set, fills Expense.AmountInBase using the exchange
+	// rate valid on the day the expense occurred.
+	BaseCurrency string
+	// Sort is SortOccurredAt, SortAmount or SortRelevance and Order
+	// OrderDesc or OrderAsc; empty values select the latest first.
+	Sort  string
+	Order string
+	// Limit is the size of a page of GetAll. The page starts after Cursor
+	// or, without one, at Offset.
+	Limit  int
+	Offset int
+	Cursor *Cursor
+	// CountTotal makes GetAll count all matching expenses.
+	CountTotal bool
 }
 
+// Create adds the expense to its ledger. ledger.ErrForbidden is returned
+// unless the user may write to the ledger, ErrAllocationSum unless the
+// allocations add up to the amount, category.ErrNotInLedger or
+// category.ErrWrongKind unless its categories are live categories of the
+// ledger and of its kind and account.ErrCurrencyMismatch unless the account
+// keeps money in the currency of the expense.
 func (r *Repo) Create(ctx context.Context, expense *models.Expense) error {
-	query := `
-		INSERT INTO expenses (user_id, category_id, amount, currency, occurred_at, comment, created_at, updated_at)
-		VALUES ($1, $2, $3, $4, $5, $6, NOW(), NOW())
+	if err := checkAllocations(expense.Amount, expense.Allocations); err != nil {
+		return err
+	}
+
+	tx, err := r.db.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	if err := checkCategories(ctx, tx, expense.LedgerID, expense, nil); err != nil {
+		return err
+	}
+	if expense.AccountID != nil {
+		if err := account.Check(ctx, tx, expense.LedgerID, *expense.AccountID, expense.Amount.Currency); err != nil {
+			return err
+		}
+	}
+
+	query := fmt.Sprintf(`
+		INSERT INTO expenses (ledger_id, user_id, kind, category_id, account_id, amount, currency, occurred_at, merchant, comment, created_at, updated_at)
+		SELECT $1, $2, $8, $3, $9, $4, $5, $6, $10, $7, NOW(), NOW()
+		WHERE %s
 		RETURNING id, created_at, updated_at
-	`
+	`, ledger.AccessCondition("$1", "$2", ledger.Write))
 
-	return r.db.QueryRow(ctx, query,
+	err = tx.QueryRow(ctx, query,
+		expense.LedgerID,
 		expense.UserID,
 		expense.CategoryID,
-		expense.Amount,
-		expense.Currency,
+		expense.Amount.Numeric(),
+		expense.Amount.Currency,
 		expense.OccurredAt,
 		expense.Comment,
+		expense.Kind,
+		expense.AccountID,
+		expense.Merchant,
 	).Scan(&expense.ID, &expense.CreatedAt, &expense.UpdatedAt)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return ledger.ErrForbidden
+	}
+	if err != nil {
+		return err
+	}
+
+	if err := tag.Assign(ctx, tx, expense.LedgerID, expense.UserID, expense.ID, expense.Tags); err != nil {
+		return err
+	}
+	if err := assignAllocations(ctx, tx, expense.LedgerID, expense.ID, expense.Allocations, nil); err != nil {
+		return err
+	}
+	if err := split.Assign(ctx, tx, expense.LedgerID, expense.ID, expense.Participants, nil); err != nil {
+		return err
+	}
+
+	after, err := getByID(ctx, tx, expense.ID, expense.UserID, ledger.Write)
+	if err != nil {
+		return err
+	}
+
+	err = audit.Record(ctx, tx, audit.Event{
+		LedgerID:   expense.LedgerID,
+		OwnerID:    expense.UserID,
+		EntityType: audit.EntityExpense,
+		EntityID:   expense.ID,
+		Action:     audit.ActionCreate,
+		After:      after,
+	})
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit(ctx)
 }
 
-func (r *Repo) GetAll(ctx context.Context, params GetExpensesParams) ([]models.Expense, int, error) {
+// GetAll returns a page of the expenses matching params. Pages follow
+// each other by Cursor, or by Offset without one, and Total is counted only
+// when CountTotal is set.
+func (r *Repo) GetAll(ctx context.Context, params GetExpensesParams) (*Page, error) {
+	if params.Sort == "" || (params.Sort == SortRelevance && params.Search == "") {
+		params.Sort = SortOccurredAt
+	}
+	if params.Order == "" {
+		params.Order = OrderDesc
+	}
+	if c := params.Cursor; c != nil && (c.Sort != params.Sort || c.Order != params.Order) {
+		return nil, ErrInvalidCursor.At("cursor")
+	}
 
-	where := []string{"e.user_id = $1", "e.deleted_at IS NULL"}
-	args := []interface{}{params.UserID}
-	argPos := 2
+	page := &Page{}
+	if params.CountTotal {
+		where, args := filterConditions(params)
+		countQuery := fmt.Sprintf(`
+			SELECT COUNT(*) 
+			FROM expenses e
+			WHERE %s
+		`, strings.Join(where, " AND "))
 
-	if params.From != nil {
-		where = append(where, fmt.Sprintf("e.occurred_at >= $%d", argPos))
-		args = append(args, *params.From)
-		argPos++
+		var total int
+		if err := r.db.QueryRow(ctx, countQuery, args...).Scan(&total); err != nil {
+			return nil, err
+		}
+		page.Total = &total
 	}
-	if params.To != nil {
-		where = append(where, fmt.Sprintf("e.occurred_at <= $%d", argPos))
-		args = append(args, *params.To)
-		argPos++
+
+	query, args := listQuery(params, true)
+	rows, err := r.db.Query(ctx, query, args...)
+	if err != nil {
+		return nil, err
 	}
-	if params.CategoryID != nil {
-		where = append(where, fmt.Sprintf("e.category_id = $%d", argPos))
-		args = append(args, *params.CategoryID)
-		argPos++
+	defer rows.Close()
+
+	var expenses []models.Expense
+	for rows.Next() {
+		var e models.Expense
+		if err := scanListRow(rows, params, &e); err != nil {
+			return nil, err
+		}
+		expenses = append(expenses, e)
 	}
-	if params.MinAmount != nil {
-		where = append(where, fmt.Sprintf("e.amount >= $%d", argPos))
-		args = append(args, *params.MinAmount)
-		argPos++
+	if err := rows.Err(); err != nil {
+		return nil, err
 	}
-	if params.MaxAmount != nil {
-		where = append(where, fmt.Sprintf("e.amount <= $%d", argPos))
-		args = append(args, *params.MaxAmount)
-		argPos++
+
+	// one row more than asked for tells whether the list goes on
+	more := len(expenses) > params.Limit
+	if more {
+		expenses = expenses[:params.Limit]
 	}
-	if params.Search != "" {
-		where = append(where, fmt.Sprintf("e.comment ILIKE '%%' || $%d || '%%'", argPos))
-		args = append(args, params.Search)
-		argPos++
+	backward := params.Cursor != nil && params.Cursor.Backward
+	if backward {
+		slices.Reverse(expenses)
 	}
 
-	whereClause := strings.Join(where, " AND ")
+	if err := loadAllocations(ctx, r.db, expenses); err != nil {
+		return nil, err
+	}
 
-	countQuery := fmt.Sprintf(`
-		SELECT COUNT(*) 
-		FROM expenses e
-		WHERE %s
-	`, whereClause)
+	if len(expenses) > 0 {
+		if (backward && more) || (!backward && (params.Cursor != nil || params.Offset > 0)) {
+			prev := cursorAt(params, expenses[0], true).Encode()
+			page.PrevCursor = &prev
+		}
+		if backward || more {
+			next := cursorAt(params, expenses[len(expenses)-1], false).Encode()
+			page.NextCursor = &next
+		}
+	}
+	page.Items = expenses
+
+	return page, nil
+}
 
-	var total int
-	err := r.db.QueryRow(ctx, countQuery, args...).Scan(&total)
+// Stream calls fn for every expense matching params in the order of
+// GetAll, ignoring Limit and Offset. Rows are read from the connection one
+// at a time, so the result is never held in memory as a whole.
+func (r *Repo) Stream(ctx context.Context, params GetExpensesParams, fn func(models.Expense) error) error {
+	query, args := listQuery(params, false)
+	rows, err := r.db.Query(ctx, query, args...)
 	if err != nil {
-		return nil, 0, err
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var e models.Expense
+		if err := scanListRow(rows, params, &e); err != nil {
+			return err
+		}
+		if err := fn(e); err != nil {
+			return err
+		}
+	}
+
+	return rows.Err()
+}
+
+// listQuery builds the query behind GetAll and Stream. The rate columns
+// are NULL unless a base currency is requested.
+func listQuery(params GetExpensesParams, paginate bool) (string, []interface{}) {
+	where, args := filterConditions(params)
+	arg := func(v interface{}) string {
+		args = append(args, v)
+		return fmt.Sprintf("$%d", len(args))
 	}
 
 	sortField := "e.occurred_at"
-	if params.Sort == "amount" {
+	switch {
+	case params.Sort == SortAmount:
 		sortField = "e.amount"
+	case params.Sort == SortRelevance && params.Search != "":
+		sortField = searchRank(arg(params.Search))
 	}
-	sortOrder := "DESC"
-	if params.Order == "asc" {
-		sortOrder = "ASC"
+	desc := params.Order != OrderAsc
+
+	pagination := ""
+	if paginate {
+		if c := params.Cursor; c != nil {
+			// a page before the cursor is read backwards and turned
+			// around by GetAll
+			if c.Backward {
+				desc = !desc
+			}
+			op := ">"
+			if desc {
+				op = "<"
+			}
+			where = append(where, fmt.Sprintf("(%s, e.id) %s (%s, %s::bigint)", sortField, op, arg(c.key()), arg(c.ID)))
+			pagination = fmt.Sprintf("LIMIT %s", arg(params.Limit+1))
+		} else {
+			pagination = fmt.Sprintf("LIMIT %s OFFSET %s", arg(params.Limit+1), arg(params.Offset))
+		}
+	}
+
+	sortOrder := "ASC"
+	if desc {
+		sortOrder = "DESC"
+	}
+
+	rateColumns := "NULL::numeric, NULL::numeric"
+	if params.BaseCurrency != "" {
+		rateColumns = fmt.Sprintf("(%s), (%s)",
+			rates.RateQuery("e.currency", "e.occurred_at"),
+			rates.RateQuery(arg(params.BaseCurrency)+"::varchar", "e.occurred_at"),
+		)
+	}
+
+	searchColumns := "NULL::float8, NULL::text, NULL::text, NULL::text"
+	if params.Search != "" {
+		search := arg(params.Search)
+		searchColumns = fmt.Sprintf("%s, %s, %s, %s",
+			searchRank(search),
+			searchHeadline("e.merchant", search),
+			searchHeadline("e.comment", search),
+			searchHeadline("c.name", search),
+		)
 	}
 
 	query := fmt.Sprintf(`
-		SELECT e.id, e.user_id, e.category_id, e.amount, e.currency, 
-		       e.occurred_at, e.comment, e.created_at, e.updated_at,
-		       c.name as category_name
+		SELECT e.id, e.ledger_id, e.user_id, e.kind, e.category_id, e.account_id, e.amount, e.currency, 
+		       e.occurred_at, e.merchant, e.comment, e.recurring_id, e.created_at, e.updated_at,
+		       c.name as category_name, %s, %s, %s
 		FROM expenses e
-		LEFT JOIN categories c ON e.category_id = c.id AND c.deleted_at IS NULL
+		LEFT JOIN categories c ON e.category_id = c.id AND c.ledger_id = e.ledger_id AND c.deleted_at IS NULL
 		WHERE %s
-		ORDER BY %s %s
-		LIMIT $%d OFFSET $%d
-	`, whereClause, sortField, sortOrder, argPos, argPos+1)
+		ORDER BY %s %s, e.id %s
+		%s
+	`, tagsColumn, rateColumns, searchColumns, strings.Join(where, " AND "), sortField, sortOrder, sortOrder, pagination)
 
-	args = append(args, params.Limit, params.Offset)
+	return query, args
+}
 
-	rows, err := r.db.Query(ctx, query, args...)
-	if err != nil {
-		return nil, 0, err
+// scanListRow scans a row of listQuery, filling AmountInBase when the
+// rate of the day is known and Search when searching.
+func scanListRow(rows pgx.Rows, params GetExpensesParams, e *models.Expense) error {
+	var fromRate, toRate pgtype.Numeric
+	var rank *float64
+	var merchant, comment, categoryName *string
+	if err := scanExpense(rows, e, &fromRate, &toRate, &rank, &merchant, &comment, &categoryName); err != nil {
+		return err
+	}
+	if rank != nil {
+		e.Search = searchMatch(*rank, merchant, comment, categoryName)
 	}
-	defer rows.Close()
 
-	var expenses []models.Expense
-	for rows.Next() {
-		var e models.Expense
-		var categoryName *string
-		err := rows.Scan(
-			&e.ID, &e.UserID, &e.CategoryID, &e.Amount, &e.Currency,
-			&e.OccurredAt, &e.Comment, &e.CreatedAt, &e.UpdatedAt,
-			&categoryName,
-		)
-		if err != nil {
-			return nil, 0, err
+	if params.BaseCurrency != "" {
+		if rate, err := rates.CrossRate(fromRate, toRate); err == nil {
+			converted, err := e.Amount.Convert(rate, params.BaseCurrency)
+			if err != nil {
+				return err
+			}
+			e.AmountInBase = &converted
 		}
-		expenses = append(expenses, e)
 	}
 
-	return expenses, total, nil
+	return nil
 }
 
+// GetByID returns an expense of any ledger the user is a member of.
 func (r *Repo) GetByID(ctx context.Context, id, userID int64) (*models.Expense, error) {
-	query := `
-		SELECT e.id, e.user_id, e.category_id, e.amount, e.currency, 
-		       e.occurred_at, e.comment, e.created_at, e.updated_at,
-		       c.name as category_name
+	return getByID(ctx, r.db, id, userID, ledger.Read)
+}
+
+type querier interface {
+	Query(ctx context.Context, sql string, args ...any) (pgx.Rows, error)
+	QueryRow(ctx context.Context, sql string, args ...any) pgx.Row
+}
+
+// getByID reads a live expense of a ledger the user is a member of and
+// returns ledger.ErrForbidden if the member lacks the access. Inside a
+// transaction the row stays locked until it ends.
+func getByID(ctx context.Context, q querier, id, userID int64, access ledger.Access) (*models.Expense, error) {
+	lock := ""
+	if _, ok := q.(pgx.Tx); ok {
+		lock = "FOR UPDATE OF e"
+	}
+
+	query := fmt.Sprintf(`
+		SELECT e.id, e.ledger_id, e.user_id, e.kind, e.category_id, e.account_id, e.amount, e.currency, 
+		       e.occurred_at, e.merchant, e.comment, e.recurring_id, e.created_at, e.updated_at,
+		       c.name as category_name, %s, %s
 		FROM expenses e
-		LEFT JOIN categories c ON e.category_id = c.id AND c.deleted_at IS NULL
-		WHERE e.id = $1 AND e.user_id = $2 AND e.deleted_at IS NULL
-	`
+		LEFT JOIN categories c ON e.category_id = c.id AND c.ledger_id = e.ledger_id AND c.deleted_at IS NULL
+		WHERE e.id = $1 AND e.deleted_at IS NULL AND %s
+		%s
+	`, tagsColumn,
+		ledger.AccessCondition("e.ledger_id", "$2", access),
+		ledger.AccessCondition("e.ledger_id", "$2", ledger.Read),
+		lock)
 
 	var e models.Expense
-	var categoryName *string
-	err := r.db.QueryRow(ctx, query, id, userID).Scan(
-		&e.ID, &e.UserID, &e.CategoryID, &e.Amount, &e.Currency,
-		&e.OccurredAt, &e.Comment, &e.CreatedAt, &e.UpdatedAt,
-		&categoryName,
-	)
+	var allowed bool
+	if err := scanExpense(q.QueryRow(ctx, query, id, userID), &e, &allowed); err != nil {
+		return nil, err
+	}
+	if !allowed {
+		return nil, ledger.ErrForbidden
+	}
+
+	expenses := []models.Expense{e}
+	if err := loadAllocations(ctx, q, expenses); err != nil {
+		return nil, err
+	}
+	e = expenses[0]
+
+	participants, err := split.Participants(ctx, q, e.ID, e.Amount.Currency)
 	if err != nil {
 		return nil, err
 	}
+	e.Participants = participants
 
 	return &e, nil
 }
 
-func (r *Repo) Update(ctx context.Context, expense *models.Expense) error {
+// Update writes all fields of the expense, replacing its tags, allocations
+// and participants with the given ones. Allocations and participants equal
+// to the stored ones are left as they are, even if a category of theirs is
+// gone or a participant has left the ledger.
+// userID is the member making the change, not necessarily the author.
+func (r *Repo) Update(ctx context.Context, expense *models.Expense, userID int64) error {
+	tx, err := r.db.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	before, err := getByID(ctx, tx, expense.ID, userID, ledger.Write)
+	if err == pgx.ErrNoRows {
+		return sql.ErrNoRows
+	}
+	if err != nil {
+		return err
+	}
+
+	keepAllocations := expense.Amount == before.Amount && sameAllocations(expense.Allocations, before.Allocations)
+	if !keepAllocations {
+		if err := checkAllocations(expense.Amount, expense.Allocations); err != nil {
+			return err
+		}
+	}
+	if err := checkCategories(ctx, tx, before.LedgerID, expense, before); err != nil {
+		return err
+	}
+	if expense.AccountID != nil {
+		if err := account.Check(ctx, tx, before.LedgerID, *expense.AccountID, expense.Amount.Currency); err != nil {
+			return err
+		}
+	}
+
 	query := `
 		UPDATE expenses
-		SET category_id = COALESCE($1, category_id),
-		    amount = COALESCE($2, amount),
-		    currency = COALESCE($3, currency),
-		    occurred_at = COALESCE($4, occurred_at),
+		SET category_id = $1,
+		    amount = $2,
+		    currency = $3,
+		    occurred_at = $4,
 		    comment = COALESCE($5, comment),
+		    kind = $7,
+		    account_id = $8,
+		    merchant = $9,
 		    updated_at = NOW()
-		WHERE id = $6 AND user_id = $7 AND deleted_at IS NULL
+		WHERE id = $6
+		RETURNING updated_at
 	`
 
-	result, err := r.db.Exec(ctx, query,
+	err = tx.QueryRow(ctx, query,
 		expense.CategoryID,
-		expense.Amount,
-		expense.Currency,
+		expense.Amount.Numeric(),
+		expense.Amount.Currency,
 		expense.OccurredAt,
 		expense.Comment,
 		expense.ID,
-		expense.UserID,
-	)
+		expense.Kind,
+		expense.AccountID,
+		expense.Merchant,
+	).Scan(&expense.UpdatedAt)
 	if err != nil {
 		return err
 	}
 
-	rowsAffected := result.RowsAffected()
-	if rowsAffected == 0 {
-		return sql.ErrNoRows
+	if err := tag.Assign(ctx, tx, before.LedgerID, userID, expense.ID, expense.Tags); err != nil {
+		return err
+	}
+	if !keepAllocations {
+		if err := assignAllocations(ctx, tx, before.LedgerID, expense.ID, expense.Allocations, allocationCategories(before)); err != nil {
+			return err
+		}
+	}
+	// participants who left the ledger stay on the expenses they shared
+	if !slices.Equal(expense.Participants, before.Participants) {
+		if err := split.Assign(ctx, tx, before.LedgerID, expense.ID, expense.Participants, split.UserIDs(before.Participants)); err != nil {
+			return err
+		}
 	}
 
-	return nil
+	after, err := getByID(ctx, tx, expense.ID, userID, ledger.Write)
+	if err != nil {
+		return err
+	}
+
+	err = audit.Record(ctx, tx, audit.Event{
+		LedgerID:   before.LedgerID,
+		OwnerID:    before.UserID,
+		EntityType: audit.EntityExpense,
+		EntityID:   expense.ID,
+		Action:     audit.ActionUpdate,
+		Before:     before,
+		After:      after,
+	})
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit(ctx)
 }
 
 func (r *Repo) Delete(ctx context.Context, id, userID int64) error {
+	tx, err := r.db.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	before, err := getByID(ctx, tx, id, userID, ledger.Write)
+	if err == pgx.ErrNoRows {
+		return sql.ErrNoRows
+	}
+	if err != nil {
+		return err
+	}
+
 	query := `
 		UPDATE expenses
 		SET deleted_at = NOW(), updated_at = NOW()
-		WHERE id = $1 AND user_id = $2 AND deleted_at IS NULL
+		WHERE id = $1
 	`
 
-	result, err := r.db.Exec(ctx, query, id, userID)
+	if _, err := tx.Exec(ctx, query, id); err != nil {
+		return err
+	}
+
+	err = audit.Record(ctx, tx, audit.Event{
+		LedgerID:   before.LedgerID,
+		OwnerID:    before.UserID,
+		EntityType: audit.EntityExpense,
+		EntityID:   id,
+		Action:     audit.ActionDelete,
+		Before:     before,
+	})
 	if err != nil {
 		return err
 	}
 
+	return tx.Commit(ctx)
+}
+
+// Restore brings a deleted expense back from the trash. A category of the
+// expense that is still deleted is cleared, and so are the allocations if
+// any of them is in such a category, which Restore reports.
+func (r *Repo) Restore(ctx context.Context, id, userID int64) (bool, error) {
+	tx, err := r.db.Begin(ctx)
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback(ctx)
+
+	query := fmt.Sprintf(`
+		UPDATE expenses
+		SET deleted_at = NULL, updated_at = NOW()
+		WHERE id = $1 AND deleted_at IS NOT NULL AND %s
+	`, ledger.AccessCondition("expenses.ledger_id", "$2", ledger.Write))
+
+	result, err := tx.Exec(ctx, query, id, userID)
+	if err != nil {
+		return false, err
+	}
+
 	rowsAffected := result.RowsAffected()
 	if rowsAffected == 0 {
-		return sql.ErrNoRows
+		return false, sql.ErrNoRows
+	}
+
+	result, err = tx.Exec(ctx, `
+		UPDATE expenses e
+		SET category_id = NULL
+		FROM categories c
+		WHERE e.id = $1 AND c.id = e.category_id AND c.deleted_at IS NOT NULL
+	`, id)
+	if err != nil {
+		return false, err
+	}
+	categoryCleared := result.RowsAffected() > 0
+
+	// The lines of a divided expense must add up to its amount, so one line
+	// without a live category drops the whole division.
+	result, err = tx.Exec(ctx, `
+		DELETE FROM expense_allocations
+		WHERE expense_id = $1 AND EXISTS (
+			SELECT 1 FROM expense_allocations a
+			LEFT JOIN categories c ON c.id = a.category_id
+			WHERE a.expense_id = $1 AND (c.id IS NULL OR c.deleted_at IS NOT NULL)
+		)
+	`, id)
+	if err != nil {
+		return false, err
+	}
+	categoryCleared = categoryCleared || result.RowsAffected() > 0
+
+	after, err := getByID(ctx, tx, id, userID, ledger.Write)
+	if err != nil {
+		return false, err
+	}
+
+	err = audit.Record(ctx, tx, audit.Event{
+		LedgerID:   after.LedgerID,
+		OwnerID:    after.UserID,
+		EntityType: audit.EntityExpense,
+		EntityID:   id,
+		Action:     audit.ActionRestore,
+		After:      after,
+	})
+	if err != nil {
+		return false, err
+	}
+
+	return categoryCleared, tx.Commit(ctx)
+}
+
+// tagsColumn selects the sorted tag names of the expense aliased as e.
+const tagsColumn = `ARRAY(
+	SELECT t.name FROM expense_tags et JOIN tags t ON t.id = et.tag_id
+	WHERE et.expense_id = e.id ORDER BY lower(t.name)
+) AS tags`
+
+// scanExpense reads the common expense columns followed by any extra ones.
+func scanExpense(row pgx.Row, e *models.Expense, extra ...any) error {
+	var amount pgtype.Numeric
+	var currency string
+	dest := []any{
+		&e.ID, &e.LedgerID, &e.UserID, &e.Kind, &e.CategoryID, &e.AccountID, &amount, &currency,
+		&e.OccurredAt, &e.Merchant, &e.Comment, &e.RecurringID, &e.CreatedAt, &e.UpdatedAt,
+		&e.CategoryName, &e.Tags,
+	}
+	err := row.Scan(append(dest, extra...)...)
+	if err != nil {
+		return err
+	}
+
+	e.Amount, err = money.FromNumeric(amount, currency)
+	if err != nil {
+		return fmt.Errorf("expense %d: %w", e.ID, err)
 	}
 
 	return nil
 }
+
+// Total sums the spending that occurred in [from, to) in the given
+// currency, converting other currencies at the rate of the day each expense
+// occurred. Expenses without a known rate are not summed but counted. The
+// expenses of every member of the ledger count; a category includes its
+// subcategories and counts the allocated part of divided expenses.
+func (r *Repo) Total(ctx context.Context, ledgerID int64, categoryID *int64, from, to time.Time, currency string) (money.Money, int, error) {
+	scale, err := money.Scale(currency)
+	if err != nil {
+		return money.Money{}, 0, err
+	}
+
+	where := "e.ledger_id = $1 AND e.kind = '" + models.KindExpense + "' AND e.deleted_at IS NULL AND e.occurred_at >= $2 AND e.occurred_at < $3"
+	args := []interface{}{ledgerID, from, to, currency, scale}
+	if categoryID != nil {
+		where += " AND " + categoryCondition("l.category_id", "$6", true)
+		args = append(args, *categoryID)
+	}
+
+	query := fmt.Sprintf(`
+		SELECT ROUND(COALESCE(SUM(x.converted), 0), $5), COUNT(DISTINCT x.id) FILTER (WHERE x.converted IS NULL)
+		FROM (
+			SELECT e.id,
+			       CASE WHEN e.currency = $4 THEN l.amount
+			            ELSE l.amount * (%s) / (%s)
+			       END AS converted
+			FROM expenses e
+			CROSS JOIN LATERAL %s l
+			WHERE %s
+		) x
+	`, rates.RateQuery("$4::varchar", "e.occurred_at"), rates.RateQuery("e.currency", "e.occurred_at"), expenseLines, where)
+
+	var sum pgtype.Numeric
+	var unconverted int
+	if err := r.db.QueryRow(ctx, query, args...).Scan(&sum, &unconverted); err != nil {
+		return money.Money{}, 0, err
+	}
+
+	total, err := money.FromNumeric(sum, currency)
+	if err != nil {
+		return money.Money{}, 0, err
+	}
+
+	return total, unconverted, nil
+}
+
+// filterConditions turns the filters of params into WHERE conditions over
+// expenses aliased as e and their positional arguments.
+func filterConditions(params GetExpensesParams) ([]string, []interface{}) {
+	where := []string{"e.ledger_id = $1", ledger.AccessCondition("e.ledger_id", "$2", ledger.Read), "e.deleted_at IS NULL"}
+	args := []interface{}{params.LedgerID, params.UserID}
+	argPos := 3
+
+	if params.Kind != "" {
+		where = append(where, fmt.Sprintf("e.kind = $%d", argPos))
+		args = append(args, params.Kind)
+		argPos++
+	}
+	if params.From != nil {
+		where = append(where, fmt.Sprintf("e.occurred_at >= $%d", argPos))
+		args = append(args, *params.From)
+		argPos++
+	}
+	if params.To != nil {
+		where = append(where, fmt.Sprintf("e.occurred_at <= $%d", argPos))
+		args = append(args, *params.To)
+		argPos++
+	}
+	if params.CategoryID != nil {
+		where = append(where, fmt.Sprintf("EXISTS (SELECT 1 FROM %s l WHERE %s)",
+			expenseLines, categoryCondition("l.category_id", fmt.Sprintf("$%d", argPos), params.IncludeSubcategories)))
+		args = append(args, *params.CategoryID)
+		argPos++
+	}
+	if params.AccountID != nil {
+		where = append(where, fmt.Sprintf("e.account_id = $%d", argPos))
+		args = append(args, *params.AccountID)
+		argPos++
+	}
+	if params.MinAmount != nil {
+		where = append(where, fmt.Sprintf("e.amount >= $%d", argPos))
+		args = append(args, *params.MinAmount)
+		argPos++
+	}
+	if params.MaxAmount != nil {
+		where = append(where, fmt.Sprintf("e.amount <= $%d", argPos))
+		args = append(args, *params.MaxAmount)
+		argPos++
+	}
+	if params.Search != "" {
+		where = append(where, searchCondition(fmt.Sprintf("$%d", argPos)))
+		args = append(args, params.Search)
+		argPos++
+	}
+
+	tagged := `
+		SELECT %s FROM expense_tags et JOIN tags t ON t.id = et.tag_id
+		WHERE et.expense_id = e.id AND lower(t.name) = ANY($%d::text[])`
+	if len(params.TagsAny) > 0 {
+		where = append(where, "EXISTS ("+fmt.Sprintf(tagged, "1", argPos)+")")
+		args = append(args, tag.Keys(params.TagsAny))
+		argPos++
+	}
+	if len(params.TagsAll) > 0 {
+		keys := tag.Keys(params.TagsAll)
+		where = append(where, fmt.Sprintf("(%s) = cardinality($%d::text[])", fmt.Sprintf(tagged, "COUNT(DISTINCT lower(t.name))", argPos), argPos))
+		args = append(args, distinct(keys))
+		argPos++
+	}
+	if len(params.TagsNone) > 0 {
+		where = append(where, "NOT EXISTS ("+fmt.Sprintf(tagged, "1", argPos)+")")
+		args = append(args, tag.Keys(params.TagsNone))
+		argPos++
+	}
+
+	return where, args
+}
+
+// categoryCondition matches column against the category id in idExpr and,
+// if asked, its descendants.
+func categoryCondition(column, idExpr string, subcategories bool) string {
+	if subcategories {
+		return fmt.Sprintf("%s IN (%s)", column, category.DescendantsQuery(idExpr))
+	}
+	return fmt.Sprintf("%s = %s", column, idExpr)
+}
+
+func distinct(values []string) []string {
+	seen := make(map[string]bool, len(values))
+	result := make([]string, 0, len(values))
+	for _, v := range values {
+		if !seen[v] {
+			seen[v] = true
+			result = append(result, v)
+		}
+	}
+	return result
+}
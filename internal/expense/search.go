@@ -0,0 +1,77 @@
+package expense
+
+import (
+	"fmt"
+	"html"
+	"search-job/internal/models"
+	"strings"
+)
+
+// Text search matches the merchant and comment of an expense and the names
+// of its categories. Words are stemmed in Russian and in English, as
+// comments mix both, and trigram similarity finds words with typos.
+
+// markStart and markStop delimit matches in headlines until they are
+// replaced by tags. They are private use characters, which do not occur in
+// text people type.
+const (
+	markStart = "\ue000"
+	markStop  = "\ue001"
+)
+
+// searchQuery parses the terms in arg with both configurations.
+func searchQuery(arg string) string {
+	return fmt.Sprintf("(websearch_to_tsquery('russian', %[1]s) || websearch_to_tsquery('english', %[1]s))", arg)
+}
+
+// searchCondition matches the expense aliased as e against the terms in
+// arg. The category names are those of its lines, so that a divided
+// expense is found by any of its categories.
+func searchCondition(arg string) string {
+	return fmt.Sprintf(`(e.search_vector @@ %[1]s OR %[2]s <%% e.search_text OR EXISTS (
+		SELECT 1 FROM %[3]s l
+		JOIN categories sc ON sc.id = l.category_id AND sc.deleted_at IS NULL
+		WHERE (to_tsvector('russian', sc.name) || to_tsvector('english', sc.name)) @@ %[1]s
+		   OR %[2]s <%% sc.name
+	))`, searchQuery(arg), arg, expenseLines)
+}
+
+// searchRank scores how well the expense aliased as e, with its category
+// joined as c, matches the terms in arg: the text rank plus the better
+// trigram similarity of its text and its category name.
+func searchRank(arg string) string {
+	return fmt.Sprintf(`(ts_rank_cd(e.search_vector, %[1]s) + greatest(
+		word_similarity(%[2]s, e.search_text), coalesce(word_similarity(%[2]s, c.name), 0)
+	))::float8`, searchQuery(arg), arg)
+}
+
+// searchHeadline selects the fragments of column matching the terms in arg,
+// with the matches between markStart and markStop. The Russian
+// configuration stems English words too.
+func searchHeadline(column, arg string) string {
+	return fmt.Sprintf("ts_headline('russian', coalesce(%s, ''), %s, 'StartSel=%s, StopSel=%s, MaxFragments=2, MaxWords=20, MinWords=5')",
+		column, searchQuery(arg), markStart, markStop)
+}
+
+// searchMatch builds the match of a found expense from the scanned rank
+// and headlines.
+func searchMatch(rank float64, merchant, comment, categoryName *string) *models.SearchMatch {
+	return &models.SearchMatch{
+		Rank:         rank,
+		Merchant:     highlight(merchant),
+		Comment:      highlight(comment),
+		CategoryName: highlight(categoryName),
+	}
+}
+
+// highlight turns a headline into HTML with the matches in mark elements.
+// A headline without matches, as of a fuzzy match, is left out.
+func highlight(headline *string) *string {
+	if headline == nil || !strings.Contains(*headline, markStart) {
+		return nil
+	}
+	s := html.EscapeString(*headline)
+	s = strings.ReplaceAll(s, markStart, "<mark>")
+	s = strings.ReplaceAll(s, markStop, "</mark>")
+	return &s
+}
@@ -0,0 +1,315 @@
+package service
+
+import (
+	"net/http"
+	"search-job/internal/middleware"
+	"search-job/internal/models"
+	"search-job/internal/pkg/apperr"
+	"search-job/internal/pkg/money"
+	"search-job/internal/pkg/validate"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/labstack/echo/v4"
+)
+
+func (s *Service) CreateAccount(c echo.Context) error {
+	userID := middleware.GetUserID(c)
+	if userID == 0 {
+		return apperr.ErrUnauthorized
+	}
+
+	var req struct {
+		Name     string `json:"name" validate:"required,max=100"`
+		Type     string `json:"type" validate:"required,oneof=cash card bank savings credit other"`
+		Currency string `json:"currency" validate:"required,currency"`
+		// OpeningBalance is zero when omitted.
+		OpeningBalance money.Number `json:"opening_balance" validate:"decimal,scale=Currency"`
+	}
+
+	if err := validate.Bind(c, &req); err != nil {
+		return err
+	}
+
+	name := strings.TrimSpace(req.Name)
+	if req.OpeningBalance == "" {
+		req.OpeningBalance = "0"
+	}
+
+	opening, err := money.Parse(string(req.OpeningBalance), req.Currency)
+	if err != nil {
+		return apperr.ErrInvalidParams
+	}
+
+	a := &models.Account{
+		LedgerID:       middleware.GetLedgerID(c),
+		UserID:         userID,
+		Name:           name,
+		Type:           req.Type,
+		OpeningBalance: opening,
+	}
+
+	if err := s.accountRepo.Create(c.Request().Context(), a); err != nil {
+		return err
+	}
+
+	return c.JSON(http.StatusCreated, a)
+}
+
+// GetAccounts lists the accounts of the selected ledger with their
+// balances as of the as_of parameter, now by default. Archived accounts
+// are listed with archived=true.
+func (s *Service) GetAccounts(c echo.Context) error {
+	userID := middleware.GetUserID(c)
+	if userID == 0 {
+		return apperr.ErrUnauthorized
+	}
+
+	asOf, ok := parseAsOf(c.QueryParam("as_of"))
+	if !ok {
+		return apperr.ErrInvalidParams
+	}
+
+	accounts, err := s.accountRepo.GetAll(c.Request().Context(), middleware.GetLedgerID(c), userID, asOf,
+		c.QueryParam("archived") == "true")
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"items": accounts,
+	})
+}
+
+func (s *Service) GetAccountByID(c echo.Context) error {
+	userID := middleware.GetUserID(c)
+	if userID == 0 {
+		return apperr.ErrUnauthorized
+	}
+
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		return apperr.ErrInvalidParams
+	}
+
+	asOf, ok := parseAsOf(c.QueryParam("as_of"))
+	if !ok {
+		return apperr.ErrInvalidParams
+	}
+
+	a, err := s.accountRepo.GetByID(c.Request().Context(), id, userID, asOf)
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(http.StatusOK, a)
+}
+
+func (s *Service) UpdateAccount(c echo.Context) error {
+	userID := middleware.GetUserID(c)
+	if userID == 0 {
+		return apperr.ErrUnauthorized
+	}
+
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		return apperr.ErrInvalidParams
+	}
+
+	var req struct {
+		Name           *string       `json:"name" validate:"notblank,max=100"`
+		Type           *string       `json:"type" validate:"notblank,oneof=cash card bank savings credit other"`
+		OpeningBalance *money.Number `json:"opening_balance" validate:"notblank,decimal"`
+		// Archived hides the account from the list; false brings it back.
+		Archived *bool `json:"archived"`
+	}
+
+	if err := validate.Bind(c, &req); err != nil {
+		return err
+	}
+
+	a, err := s.accountRepo.GetByID(c.Request().Context(), id, userID, time.Now())
+	if err != nil {
+		return err
+	}
+
+	if req.Name != nil {
+		a.Name = strings.TrimSpace(*req.Name)
+	}
+	if req.Type != nil {
+		a.Type = *req.Type
+	}
+	if req.OpeningBalance != nil {
+		opening, err := money.Parse(string(*req.OpeningBalance), a.OpeningBalance.Currency)
+		if err != nil {
+			return validate.Failed(apperr.FieldError{Field: "opening_balance", Message: "must be an amount in " + a.OpeningBalance.Currency})
+		}
+		// the balance moves by as much as the opening balance does
+		a.Balance.Amount += opening.Amount - a.OpeningBalance.Amount
+		a.OpeningBalance = opening
+	}
+	if req.Archived != nil {
+		a.ArchivedAt = nil
+		if *req.Archived {
+			now := time.Now()
+			a.ArchivedAt = &now
+		}
+	}
+
+	if err := s.accountRepo.Update(c.Request().Context(), a, userID); err != nil {
+		return err
+	}
+
+	return c.JSON(http.StatusOK, a)
+}
+
+// DeleteAccount archives the account. Its transactions and transfers stay
+// and keep pointing at it.
+func (s *Service) DeleteAccount(c echo.Context) error {
+	userID := middleware.GetUserID(c)
+	if userID == 0 {
+		return apperr.ErrUnauthorized
+	}
+
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		return apperr.ErrInvalidParams
+	}
+
+	a, err := s.accountRepo.GetByID(c.Request().Context(), id, userID, time.Now())
+	if err != nil {
+		return err
+	}
+	if a.ArchivedAt == nil {
+		now := time.Now()
+		a.ArchivedAt = &now
+	}
+
+	if err := s.accountRepo.Update(c.Request().Context(), a, userID); err != nil {
+		return err
+	}
+
+	return c.JSON(http.StatusOK, map[string]string{
+		"status": "success",
+	})
+}
+
+func (s *Service) CreateTransfer(c echo.Context) error {
+	userID := middleware.GetUserID(c)
+	if userID == 0 {
+		return apperr.ErrUnauthorized
+	}
+
+	var req struct {
+		FromAccountID int64        `json:"from_account_id" validate:"required"`
+		ToAccountID   int64        `json:"to_account_id" validate:"required"`
+		Amount        money.Number `json:"amount" validate:"required,positive,scale=Currency"`
+		Currency      string       `json:"currency" validate:"required,currency"`
+		// ToAmount and ToCurrency give what arrives when the accounts keep
+		// different currencies.
+		ToAmount   money.Number `json:"to_amount" validate:"positive,scale=ToCurrency"`
+		ToCurrency string       `json:"to_currency" validate:"currency"`
+		// OccurredAt defaults to now.
+		OccurredAt string `json:"occurred_at" validate:"datetime"`
+		Comment    string `json:"comment"`
+	}
+
+	if err := validate.Bind(c, &req); err != nil {
+		return err
+	}
+	if req.ToAmount != "" && req.ToCurrency == "" {
+		return validate.Failed(apperr.FieldError{Field: "to_currency", Message: "is required with to_amount"})
+	}
+
+	amount, err := money.Parse(string(req.Amount), req.Currency)
+	if err != nil {
+		return apperr.ErrInvalidParams
+	}
+
+	transfer := &models.AccountTransfer{
+		LedgerID:      middleware.GetLedgerID(c),
+		UserID:        userID,
+		FromAccountID: req.FromAccountID,
+		ToAccountID:   req.ToAccountID,
+		Amount:        amount,
+		OccurredAt:    time.Now(),
+	}
+
+	if req.ToAmount != "" {
+		if transfer.ToAmount, err = money.Parse(string(req.ToAmount), req.ToCurrency); err != nil {
+			return apperr.ErrInvalidParams
+		}
+	}
+	if req.OccurredAt != "" {
+		if transfer.OccurredAt, err = time.Parse(time.RFC3339, req.OccurredAt); err != nil {
+			return apperr.ErrInvalidParams
+		}
+	}
+	if req.Comment != "" {
+		transfer.Comment = &req.Comment
+	}
+
+	if err := s.accountRepo.CreateTransfer(c.Request().Context(), transfer); err != nil {
+		return err
+	}
+
+	return c.JSON(http.StatusCreated, transfer)
+}
+
+// GetTransfers lists the transfers of the selected ledger, optionally only
+// those from or to account_id.
+func (s *Service) GetTransfers(c echo.Context) error {
+	userID := middleware.GetUserID(c)
+	if userID == 0 {
+		return apperr.ErrUnauthorized
+	}
+
+	q := newQuery(c, time.UTC)
+	accountID := q.id("account_id")
+	page, limit, offset := q.page()
+	if err := q.err(); err != nil {
+		return err
+	}
+
+	transfers, total, err := s.accountRepo.GetTransfers(c.Request().Context(), middleware.GetLedgerID(c), userID, accountID, limit, offset)
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"items": transfers,
+		"total": total,
+		"page":  page,
+		"limit": limit,
+	})
+}
+
+func (s *Service) DeleteTransfer(c echo.Context) error {
+	userID := middleware.GetUserID(c)
+	if userID == 0 {
+		return apperr.ErrUnauthorized
+	}
+
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		return apperr.ErrInvalidParams
+	}
+
+	if err := s.accountRepo.DeleteTransfer(c.Request().Context(), id, userID); err != nil {
+		return err
+	}
+
+	return c.JSON(http.StatusOK, map[string]string{
+		"status": "success",
+	})
+}
+
+// parseAsOf reads the moment balances are computed at, now when empty.
+func parseAsOf(value string) (time.Time, bool) {
+	if value == "" {
+		return time.Now(), true
+	}
+	t, err := time.Parse(time.RFC3339, value)
+	return t, err == nil
+}
@@ -0,0 +1,208 @@
+package service
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"search-job/internal/attachment"
+	"search-job/internal/middleware"
+	"search-job/internal/models"
+	"search-job/internal/pkg/apperr"
+	"search-job/internal/pkg/storage"
+	"strconv"
+
+	"github.com/labstack/echo/v4"
+)
+
+// multipartOverhead is room for the boundaries and part headers of an
+// upload on top of the file itself.
+const multipartOverhead = 64 << 10
+
+// UploadAttachment attaches the multipart field file to an expense. The
+// content type is detected from the file itself.
+func (s *Service) UploadAttachment(c echo.Context) error {
+	userID := middleware.GetUserID(c)
+	if userID == 0 {
+		return apperr.ErrUnauthorized
+	}
+
+	expenseID, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		return apperr.ErrInvalidParams
+	}
+
+	ctx := c.Request().Context()
+
+	if _, err := s.expenseRepo.GetByID(ctx, expenseID, userID); err != nil {
+		return err
+	}
+
+	// stop reading a body that cannot hold an acceptable file instead of
+	// buffering it whole
+	tooLarge := apperr.Validation("attachment_too_large", fmt.Sprintf("file is larger than %d bytes", s.cfg.Storage.MaxFileSize))
+	if s.cfg.Storage.MaxFileSize > 0 {
+		req := c.Request()
+		req.Body = http.MaxBytesReader(c.Response(), req.Body, s.cfg.Storage.MaxFileSize+multipartOverhead)
+	}
+
+	header, err := c.FormFile("file")
+	if err != nil {
+		var maxBytes *http.MaxBytesError
+		if errors.As(err, &maxBytes) {
+			return tooLarge
+		}
+		return apperr.ErrInvalidParams
+	}
+	if s.cfg.Storage.MaxFileSize > 0 && header.Size > s.cfg.Storage.MaxFileSize {
+		return tooLarge
+	}
+
+	// reject uploads that cannot fit before sending anything to the storage;
+	// the final check happens together with the insert
+	if s.cfg.Storage.UserQuota > 0 {
+		used, err := s.attachmentRepo.Usage(ctx, userID)
+		if err != nil {
+			return err
+		}
+		if used+header.Size > s.cfg.Storage.UserQuota {
+			return attachment.ErrQuotaExceeded
+		}
+	}
+
+	file, err := header.Open()
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	head := make([]byte, attachment.SniffLength)
+	n, err := io.ReadFull(file, head)
+	if err != nil && !errors.Is(err, io.ErrUnexpectedEOF) && !errors.Is(err, io.EOF) {
+		return err
+	}
+	head = head[:n]
+
+	contentType, err := attachment.DetectContentType(head)
+	if err != nil {
+		return err
+	}
+
+	key, err := attachment.StorageKey(userID)
+	if err != nil {
+		return err
+	}
+
+	body := io.MultiReader(bytes.NewReader(head), file)
+	if err := s.storage.Put(ctx, key, body, header.Size, contentType); err != nil {
+		return err
+	}
+
+	a := &models.Attachment{
+		UserID:      userID,
+		ExpenseID:   expenseID,
+		StorageKey:  key,
+		Filename:    attachment.CleanFilename(header.Filename),
+		ContentType: contentType,
+		Size:        header.Size,
+	}
+
+	if err := s.attachmentRepo.Create(ctx, a, s.cfg.Storage.UserQuota); err != nil {
+		if delErr := s.storage.Delete(ctx, key); delErr != nil {
+			s.logger.Error(delErr)
+		}
+		return err
+	}
+
+	return c.JSON(http.StatusCreated, a)
+}
+
+func (s *Service) GetAttachments(c echo.Context) error {
+	userID := middleware.GetUserID(c)
+	if userID == 0 {
+		return apperr.ErrUnauthorized
+	}
+
+	expenseID, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		return apperr.ErrInvalidParams
+	}
+
+	attachments, err := s.attachmentRepo.GetAll(c.Request().Context(), expenseID, userID)
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"items": attachments,
+	})
+}
+
+func (s *Service) DownloadAttachment(c echo.Context) error {
+	userID := middleware.GetUserID(c)
+	if userID == 0 {
+		return apperr.ErrUnauthorized
+	}
+
+	expenseID, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		return apperr.ErrInvalidParams
+	}
+	id, err := strconv.ParseInt(c.Param("attachmentId"), 10, 64)
+	if err != nil {
+		return apperr.ErrInvalidParams
+	}
+
+	ctx := c.Request().Context()
+
+	a, err := s.attachmentRepo.GetByID(ctx, id, expenseID, userID)
+	if err != nil {
+		return err
+	}
+
+	body, err := s.storage.Get(ctx, a.StorageKey)
+	if err != nil {
+		return err
+	}
+	defer body.Close()
+
+	res := c.Response()
+	res.Header().Set(echo.HeaderContentDisposition, fmt.Sprintf("attachment; filename=%q", a.Filename))
+	res.Header().Set(echo.HeaderContentLength, strconv.FormatInt(a.Size, 10))
+	res.Header().Set("X-Content-Type-Options", "nosniff")
+
+	return c.Stream(http.StatusOK, a.ContentType, body)
+}
+
+func (s *Service) DeleteAttachment(c echo.Context) error {
+	userID := middleware.GetUserID(c)
+	if userID == 0 {
+		return apperr.ErrUnauthorized
+	}
+
+	expenseID, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		return apperr.ErrInvalidParams
+	}
+	id, err := strconv.ParseInt(c.Param("attachmentId"), 10, 64)
+	if err != nil {
+		return apperr.ErrInvalidParams
+	}
+
+	ctx := c.Request().Context()
+
+	key, err := s.attachmentRepo.Delete(ctx, id, expenseID, userID)
+	if err != nil {
+		return err
+	}
+
+	// the record is gone either way; a leftover object only costs space
+	if err := s.storage.Delete(ctx, key); err != nil && !errors.Is(err, storage.ErrNotFound) {
+		s.logger.Error(err)
+	}
+
+	return c.JSON(http.StatusOK, map[string]string{
+		"status": "success",
+	})
+}
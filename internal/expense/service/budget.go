@@ -0,0 +1,236 @@
+package service
+
+import (
+	"context"
+	"math"
+	"net/http"
+	"search-job/internal/budget"
+	"search-job/internal/middleware"
+	"search-job/internal/models"
+	"search-job/internal/pkg/apperr"
+	"search-job/internal/pkg/money"
+	"search-job/internal/pkg/validate"
+	"search-job/internal/user"
+	"strconv"
+	"time"
+
+	"github.com/labstack/echo/v4"
+)
+
+func (s *Service) CreateBudget(c echo.Context) error {
+	userID := middleware.GetUserID(c)
+	if userID == 0 {
+		return apperr.ErrUnauthorized
+	}
+
+	var req struct {
+		Amount     money.Number `json:"amount" validate:"required,positive,scale=Currency"`
+		Currency   string       `json:"currency" validate:"required,currency"`
+		CategoryID *int64       `json:"category_id"`
+		Period     string       `json:"period" validate:"required,oneof=week month year"`
+		Rollover   bool         `json:"rollover"`
+	}
+
+	if err := validate.Bind(c, &req); err != nil {
+		return err
+	}
+
+	amount, err := money.Parse(string(req.Amount), req.Currency)
+	if err != nil {
+		return apperr.ErrInvalidParams
+	}
+	b := &models.Budget{
+		LedgerID:   middleware.GetLedgerID(c),
+		UserID:     userID,
+		CategoryID: req.CategoryID,
+		Amount:     amount,
+		Period:     req.Period,
+		Rollover:   req.Rollover,
+	}
+
+	if err := s.budgetRepo.Create(c.Request().Context(), b); err != nil {
+		return err
+	}
+
+	return c.JSON(http.StatusCreated, b)
+}
+
+func (s *Service) GetBudgets(c echo.Context) error {
+	userID := middleware.GetUserID(c)
+	if userID == 0 {
+		return apperr.ErrUnauthorized
+	}
+
+	budgets, err := s.budgetRepo.GetAll(c.Request().Context(), middleware.GetLedgerID(c), userID)
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"items": budgets,
+	})
+}
+
+func (s *Service) UpdateBudget(c echo.Context) error {
+	userID := middleware.GetUserID(c)
+	if userID == 0 {
+		return apperr.ErrUnauthorized
+	}
+
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		return apperr.ErrInvalidParams
+	}
+
+	var req struct {
+		Amount   *money.Number `json:"amount" validate:"notblank,positive,scale=Currency"`
+		Currency *string       `json:"currency" validate:"notblank,currency"`
+		Period   *string       `json:"period" validate:"notblank,oneof=week month year"`
+		Rollover *bool         `json:"rollover"`
+	}
+
+	if err := validate.Bind(c, &req); err != nil {
+		return err
+	}
+
+	b, err := s.budgetRepo.GetByID(c.Request().Context(), id, userID)
+	if err != nil {
+		return err
+	}
+
+	if req.Amount != nil || req.Currency != nil {
+		amount := b.Amount.Decimal()
+		if req.Amount != nil {
+			amount = string(*req.Amount)
+		}
+		currency := b.Amount.Currency
+		if req.Currency != nil {
+			currency = *req.Currency
+		}
+
+		b.Amount, err = money.Parse(amount, currency)
+		if err != nil {
+			return validate.Failed(apperr.FieldError{Field: "amount", Message: "must be an amount in " + currency})
+		}
+	}
+	if req.Period != nil {
+		b.Period = *req.Period
+	}
+	if req.Rollover != nil {
+		b.Rollover = *req.Rollover
+	}
+
+	if err := s.budgetRepo.Update(c.Request().Context(), b, userID); err != nil {
+		return err
+	}
+
+	return c.JSON(http.StatusOK, b)
+}
+
+func (s *Service) DeleteBudget(c echo.Context) error {
+	userID := middleware.GetUserID(c)
+	if userID == 0 {
+		return apperr.ErrUnauthorized
+	}
+
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		return apperr.ErrInvalidParams
+	}
+
+	if err := s.budgetRepo.Delete(c.Request().Context(), id, userID); err != nil {
+		return err
+	}
+
+	return c.JSON(http.StatusOK, map[string]string{
+		"status": "success",
+	})
+}
+
+// GetBudgetsStatus reports spending against every budget for the period
+// that contains the current moment in the user's time zone.
+func (s *Service) GetBudgetsStatus(c echo.Context) error {
+	userID := middleware.GetUserID(c)
+	if userID == 0 {
+		return apperr.ErrUnauthorized
+	}
+
+	ctx := c.Request().Context()
+
+	u, err := s.userRepo.GetByID(ctx, userID)
+	if err != nil {
+		return err
+	}
+
+	budgets, err := s.budgetRepo.GetAll(ctx, middleware.GetLedgerID(c), userID)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	loc := user.Location(u)
+
+	statuses := make([]models.BudgetStatus, 0, len(budgets))
+	for _, b := range budgets {
+		status, err := s.budgetStatus(ctx, b, now, loc)
+		if err != nil {
+			return err
+		}
+		statuses = append(statuses, *status)
+	}
+
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"items":    statuses,
+		"timezone": loc.String(),
+	})
+}
+
+func (s *Service) budgetStatus(ctx context.Context, b models.Budget, now time.Time, loc *time.Location) (*models.BudgetStatus, error) {
+	start, end := budget.Bounds(b.Period, now, loc)
+
+	spent, unconverted, err := s.expenseRepo.Total(ctx, b.LedgerID, b.CategoryID, start, end, b.Amount.Currency)
+	if err != nil {
+		return nil, err
+	}
+
+	// with rollover the unspent (or overspent) amount of the previous
+	// period moves into the current one
+	carried := money.Money{Currency: b.Amount.Currency}
+	if b.Rollover && b.CreatedAt.Before(start) {
+		prevStart, prevEnd := budget.Bounds(b.Period, start.Add(-time.Nanosecond), loc)
+		prevSpent, _, err := s.expenseRepo.Total(ctx, b.LedgerID, b.CategoryID, prevStart, prevEnd, b.Amount.Currency)
+		if err != nil {
+			return nil, err
+		}
+		if carried, err = b.Amount.Sub(prevSpent); err != nil {
+			return nil, err
+		}
+	}
+
+	limit, err := b.Amount.Add(carried)
+	if err != nil {
+		return nil, err
+	}
+	remaining, err := limit.Sub(spent)
+	if err != nil {
+		return nil, err
+	}
+
+	var percent float64
+	if limit.Amount > 0 {
+		percent = math.Round(float64(spent.Amount)/float64(limit.Amount)*10000) / 100
+	}
+
+	return &models.BudgetStatus{
+		Budget:      b,
+		PeriodStart: start,
+		PeriodEnd:   end,
+		CarriedOver: carried,
+		Limit:       limit,
+		Spent:       spent,
+		Remaining:   remaining,
+		Percent:     percent,
+		Overspent:   remaining.IsNegative(),
+		Unconverted: unconverted,
+	}, nil
+}
@@ -1,10 +1,18 @@
 package service
 
 import (
+	"context"
 	"net/http"
+	"search-job/internal/expense"
 	"search-job/internal/middleware"
 	"search-job/internal/models"
+	"search-job/internal/pkg/apperr"
+	"search-job/internal/pkg/money"
+	"search-job/internal/pkg/validate"
+	"search-job/internal/user"
 	"strconv"
+	"strings"
+	"time"
 
 	"github.com/labstack/echo/v4"
 )
@@ -12,57 +20,69 @@ import (
 func (s *Service) CreateCategory(c echo.Context) error {
 	userID := middleware.GetUserID(c)
 	if userID == 0 {
-		return c.JSON(http.StatusUnauthorized, map[string]string{
-			"error": "unauthorized",
-		})
+		return apperr.ErrUnauthorized
 	}
 
-	var category models.Category
-	if err := c.Bind(&category); err != nil {
-		s.logger.Error(err)
-		return c.JSON(s.NewError(InvalidParams))
+	var req struct {
+		Name     string `json:"name" validate:"required,max=100"`
+		ParentID *int64 `json:"parent_id"`
+		// Kind is ignored below a parent, whose kind the category takes.
+		Kind string `json:"kind" validate:"oneof=expense income"`
 	}
 
-	category.UserID = userID
+	if err := validate.Bind(c, &req); err != nil {
+		return err
+	}
+
+	kind, ok := parseKind(req.Kind)
+	if !ok {
+		return apperr.ErrInvalidParams
+	}
+
+	cat := models.Category{
+		LedgerID: middleware.GetLedgerID(c),
+		UserID:   userID,
+		ParentID: req.ParentID,
+		Kind:     kind,
+		Name:     strings.TrimSpace(req.Name),
+	}
 
-	if err := s.categoryRepo.Create(c.Request().Context(), &category); err != nil {
-		s.logger.Error(err)
-		return c.JSON(s.NewError(InternalServerError))
+	if err := s.categoryRepo.Create(c.Request().Context(), &cat); err != nil {
+		return err
 	}
 
-	return c.JSON(http.StatusCreated, category)
+	return c.JSON(http.StatusCreated, cat)
 }
 
 func (s *Service) GetCategories(c echo.Context) error {
 	userID := middleware.GetUserID(c)
 	if userID == 0 {
-		return c.JSON(http.StatusUnauthorized, map[string]string{
-			"error": "unauthorized",
-		})
+		return apperr.ErrUnauthorized
 	}
 
-	page, _ := strconv.Atoi(c.QueryParam("page"))
-	if page < 1 {
-		page = 1
+	if c.QueryParam("tree") == "true" {
+		return s.getCategoryTree(c, userID)
 	}
-	limit, _ := strconv.Atoi(c.QueryParam("limit"))
-	if limit < 1 || limit > 100 {
-		limit = 20
-	}
-	offset := (page - 1) * limit
 
-	search := c.QueryParam("search")
+	q := newQuery(c, time.UTC)
+	page, limit, offset := q.page()
+	search := q.string("search")
+	kind := q.oneOf("kind", "", models.KindExpense, models.KindIncome)
+	if err := q.err(); err != nil {
+		return err
+	}
 
 	categories, total, err := s.categoryRepo.GetAll(
 		c.Request().Context(),
+		middleware.GetLedgerID(c),
 		userID,
 		limit,
 		offset,
 		search,
+		kind,
 	)
 	if err != nil {
-		s.logger.Error(err)
-		return c.JSON(s.NewError(InternalServerError))
+		return err
 	}
 
 	return c.JSON(http.StatusOK, map[string]interface{}{
@@ -73,55 +93,143 @@ func (s *Service) GetCategories(c echo.Context) error {
 	})
 }
 
+// UpdateCategory renames and moves a category. parent_id 0 moves it to the
+// top level, an omitted parent_id leaves it where it is.
 func (s *Service) UpdateCategory(c echo.Context) error {
 	userID := middleware.GetUserID(c)
 	if userID == 0 {
-		return c.JSON(http.StatusUnauthorized, map[string]string{
-			"error": "unauthorized",
-		})
+		return apperr.ErrUnauthorized
 	}
 
 	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
 	if err != nil {
-		return c.JSON(s.NewError(InvalidParams))
+		return apperr.ErrInvalidParams
+	}
+
+	var req struct {
+		Name     *string `json:"name" validate:"notblank,max=100"`
+		ParentID *int64  `json:"parent_id"`
+	}
+
+	if err := validate.Bind(c, &req); err != nil {
+		return err
 	}
 
-	var category models.Category
-	if err := c.Bind(&category); err != nil {
-		s.logger.Error(err)
-		return c.JSON(s.NewError(InvalidParams))
+	cat, err := s.categoryRepo.GetByID(c.Request().Context(), id, userID)
+	if err != nil {
+		return err
 	}
 
-	category.ID = id
-	category.UserID = userID
+	if req.Name != nil {
+		cat.Name = strings.TrimSpace(*req.Name)
+	}
+	if req.ParentID != nil {
+		cat.ParentID = req.ParentID
+		if *req.ParentID == 0 {
+			cat.ParentID = nil
+		}
+	}
 
-	if err := s.categoryRepo.Update(c.Request().Context(), &category); err != nil {
-		s.logger.Error(err)
-		return c.JSON(s.NewError(InternalServerError))
+	if err := s.categoryRepo.Update(c.Request().Context(), cat, userID); err != nil {
+		return err
 	}
 
-	return c.JSON(http.StatusOK, category)
+	return c.JSON(http.StatusOK, cat)
 }
 
 func (s *Service) DeleteCategory(c echo.Context) error {
 	userID := middleware.GetUserID(c)
 	if userID == 0 {
-		return c.JSON(http.StatusUnauthorized, map[string]string{
-			"error": "unauthorized",
-		})
+		return apperr.ErrUnauthorized
 	}
 
 	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
 	if err != nil {
-		return c.JSON(s.NewError(InvalidParams))
+		return apperr.ErrInvalidParams
 	}
 
 	if err := s.categoryRepo.Delete(c.Request().Context(), id, userID); err != nil {
-		s.logger.Error(err)
-		return c.JSON(s.NewError(InternalServerError))
+		return err
 	}
 
 	return c.JSON(http.StatusOK, map[string]string{
 		"status": "success",
 	})
 }
+
+// getCategoryTree returns all categories nested by parent. With
+// totals=true every category carries the sum of its own expenses and those
+// of its descendants in the user's base currency, limited by from and to.
+func (s *Service) getCategoryTree(c echo.Context, userID int64) error {
+	ctx := c.Request().Context()
+
+	tree, err := s.categoryRepo.GetTree(ctx, middleware.GetLedgerID(c), userID)
+	if err != nil {
+		return err
+	}
+
+	if c.QueryParam("totals") == "true" {
+		if err := s.rollUpTotals(ctx, c, userID, tree); err != nil {
+			return err
+		}
+	}
+
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"items": tree,
+	})
+}
+
+func (s *Service) rollUpTotals(ctx context.Context, c echo.Context, userID int64, tree []models.Category) error {
+	u, err := s.userRepo.GetByID(ctx, userID)
+	if err != nil {
+		return err
+	}
+
+	// every category sums the transactions of its own kind
+	q := newQuery(c, user.Location(u))
+	filter := s.expenseFilters(q, userID)
+	if err := q.err(); err != nil {
+		return err
+	}
+	filter.Kind = ""
+	filter.CategoryID = nil
+	filter.BaseCurrency = u.BaseCurrency
+
+	rows, err := s.expenseRepo.Summary(ctx, expense.SummaryParams{
+		Filter:  filter,
+		GroupBy: []string{expense.GroupByCategory},
+	})
+	if err != nil {
+		return err
+	}
+
+	own := make(map[int64]money.Money, len(rows))
+	for _, row := range rows {
+		if row.CategoryID != nil {
+			own[*row.CategoryID] = row.Total
+		}
+	}
+
+	var sum func(nodes []models.Category) error
+	sum = func(nodes []models.Category) error {
+		for i := range nodes {
+			if err := sum(nodes[i].Children); err != nil {
+				return err
+			}
+
+			total, ok := own[nodes[i].ID]
+			if !ok {
+				total = money.Money{Currency: u.BaseCurrency}
+			}
+			for _, child := range nodes[i].Children {
+				if total, err = total.Add(*child.Total); err != nil {
+					return err
+				}
+			}
+			nodes[i].Total = &total
+		}
+		return nil
+	}
+
+	return sum(tree)
+}
@@ -1,11 +1,19 @@
 package service
 
 import (
+	"fmt"
 	"net/http"
 	"search-job/internal/expense"
 	"search-job/internal/middleware"
 	"search-job/internal/models"
+	"search-job/internal/pkg/apperr"
+	"search-job/internal/pkg/money"
+	"search-job/internal/pkg/validate"
+	"search-job/internal/split"
+	"search-job/internal/tag"
+	"search-job/internal/user"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/labstack/echo/v4"
@@ -14,128 +22,169 @@ import (
 func (s *Service) CreateExpense(c echo.Context) error {
 	userID := middleware.GetUserID(c)
 	if userID == 0 {
-		return c.JSON(http.StatusUnauthorized, map[string]string{
-			"error": "unauthorized",
-		})
+		return apperr.ErrUnauthorized
 	}
 
 	var req struct {
-		Amount     float64 `json:"amount"`
-		Currency   string  `json:"currency"`
-		CategoryID *int64  `json:"category_id"`
-		OccurredAt string  `json:"occurred_at"`
-		Comment    string  `json:"comment"`
+		// Kind is an expense unless it is given as income.
+		Kind       string       `json:"kind" validate:"oneof=expense income"`
+		Amount     money.Number `json:"amount" validate:"required,positive,scale=Currency"`
+		Currency   string       `json:"currency" validate:"required,currency"`
+		CategoryID *int64       `json:"category_id"`
+		AccountID  *int64       `json:"account_id"`
+		OccurredAt string       `json:"occurred_at" validate:"required,datetime"`
+		Merchant   string       `json:"merchant" validate:"max=255"`
+		Comment    string       `json:"comment"`
+		Tags       []string     `json:"tags"`
+		// Allocations divide the expense between categories instead of
+		// CategoryID.
+		Allocations []allocationRequest `json:"allocations"`
+		Split       *splitRequest       `json:"split"`
+	}
+
+	if err := validate.Bind(c, &req); err != nil {
+		return err
 	}
 
-	if err := c.Bind(&req); err != nil {
-		return c.JSON(s.NewError(InvalidParams))
+	kind, ok := parseKind(req.Kind)
+	if !ok {
+		return apperr.ErrInvalidParams
+	}
+
+	amount, err := money.Parse(string(req.Amount), req.Currency)
+	if err != nil {
+		return apperr.ErrInvalidParams
 	}
 
 	occurredAt, err := time.Parse(time.RFC3339, req.OccurredAt)
 	if err != nil {
-		return c.JSON(s.NewError(InvalidParams))
+		return apperr.ErrInvalidParams
+	}
+
+	tags, err := tag.Normalize(req.Tags)
+	if err != nil {
+		return err
 	}
 
 	expense := &models.Expense{
+		LedgerID:   middleware.GetLedgerID(c),
 		UserID:     userID,
+		Kind:       kind,
 		CategoryID: req.CategoryID,
-		Amount:     req.Amount,
-		Currency:   req.Currency,
+		AccountID:  req.AccountID,
+		Amount:     amount,
 		OccurredAt: occurredAt,
+		Tags:       tags,
 	}
 
+	if len(req.Allocations) > 0 {
+		if req.CategoryID != nil {
+			return errAllocationsWithCategory
+		}
+		if expense.Allocations, err = parseAllocations(req.Allocations, amount.Currency); err != nil {
+			return err
+		}
+	}
+
+	if req.Split != nil {
+		if kind != models.KindExpense {
+			return split.ErrIncome.At("split")
+		}
+		if expense.Participants, err = split.Shares(amount, req.Split.Mode, req.Split.Participants); err != nil {
+			return err
+		}
+	}
+
+	if req.Merchant != "" {
+		expense.Merchant = &req.Merchant
+	}
 	if req.Comment != "" {
 		expense.Comment = &req.Comment
 	}
 
 	if err := s.expenseRepo.Create(c.Request().Context(), expense); err != nil {
-		s.logger.Error(err)
-		return c.JSON(s.NewError(InternalServerError))
+		return err
 	}
 
 	return c.JSON(http.StatusCreated, expense)
 }
 
+// GetExpenses lists transactions a page at a time. next_cursor and
+// prev_cursor, passed back as cursor together with the same filters and
+// order, select the neighbouring pages; page still selects a page by its
+// number. The total is counted only with with_total=true.
 func (s *Service) GetExpenses(c echo.Context) error {
 	userID := middleware.GetUserID(c)
 	if userID == 0 {
-		return c.JSON(http.StatusUnauthorized, map[string]string{
-			"error": "unauthorized",
-		})
+		return apperr.ErrUnauthorized
 	}
 
-	params := expense.GetExpensesParams{
-		UserID: userID,
-	}
+	ctx := c.Request().Context()
 
-	page, _ := strconv.Atoi(c.QueryParam("page"))
-	if page < 1 {
-		page = 1
-	}
-	limit, _ := strconv.Atoi(c.QueryParam("limit"))
-	if limit < 1 || limit > 100 {
-		limit = 20
+	u, err := s.userRepo.GetByID(ctx, userID)
+	if err != nil {
+		return err
 	}
-	params.Limit = limit
-	params.Offset = (page - 1) * limit
 
-	if from := c.QueryParam("from"); from != "" {
-		if t, err := time.Parse(time.RFC3339, from); err == nil {
-			params.From = &t
+	q := newQuery(c, user.Location(u))
+	params := s.expenseFilters(q, userID)
+	page, limit, offset := q.page()
+	params.Limit = limit
+	params.Offset = offset
+	params.Sort, params.Order = expenseOrder(q, params.Search)
+	params.CountTotal = q.bool("with_total")
+	if value := q.string("cursor"); value != "" {
+		cursor, err := expense.DecodeCursor(value)
+		if err != nil {
+			q.fail("cursor", err.Error())
 		}
-	}
-	if to := c.QueryParam("to"); to != "" {
-		if t, err := time.Parse(time.RFC3339, to); err == nil {
-			params.To = &t
+		if q.string("page") != "" {
+			q.fail("page", "cannot be combined with cursor")
 		}
+		params.Cursor = &cursor
 	}
-	if catID := c.QueryParam("category_id"); catID != "" {
-		id, _ := strconv.ParseInt(catID, 10, 64)
-		params.CategoryID = &id
+	if q.bool("in_base") {
+		params.BaseCurrency = u.BaseCurrency
 	}
-	if min := c.QueryParam("min"); min != "" {
-		val, _ := strconv.ParseFloat(min, 64)
-		params.MinAmount = &val
+	if err := q.err(); err != nil {
+		return err
 	}
-	if max := c.QueryParam("max"); max != "" {
-		val, _ := strconv.ParseFloat(max, 64)
-		params.MaxAmount = &val
-	}
-	params.Search = c.QueryParam("search")
-	params.Sort = c.QueryParam("sort")
-	params.Order = c.QueryParam("order")
 
-	expenses, total, err := s.expenseRepo.GetAll(c.Request().Context(), params)
+	result, err := s.expenseRepo.GetAll(ctx, params)
 	if err != nil {
-		s.logger.Error(err)
-		return c.JSON(s.NewError(InternalServerError))
+		return err
 	}
 
-	return c.JSON(http.StatusOK, map[string]interface{}{
-		"items": expenses,
-		"total": total,
-		"page":  page,
-		"limit": limit,
-	})
+	response := map[string]interface{}{
+		"items":       result.Items,
+		"limit":       limit,
+		"next_cursor": result.NextCursor,
+		"prev_cursor": result.PrevCursor,
+	}
+	if params.Cursor == nil {
+		response["page"] = page
+	}
+	if result.Total != nil {
+		response["total"] = *result.Total
+	}
+
+	return c.JSON(http.StatusOK, response)
 }
 
 func (s *Service) GetExpenseByID(c echo.Context) error {
 	userID := middleware.GetUserID(c)
 	if userID == 0 {
-		return c.JSON(http.StatusUnauthorized, map[string]string{
-			"error": "unauthorized",
-		})
+		return apperr.ErrUnauthorized
 	}
 
 	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
 	if err != nil {
-		return c.JSON(s.NewError(InvalidParams))
+		return apperr.ErrInvalidParams
 	}
 
 	expense, err := s.expenseRepo.GetByID(c.Request().Context(), id, userID)
 	if err != nil {
-		s.logger.Error(err)
-		return c.JSON(s.NewError(InternalServerError))
+		return err
 	}
 
 	return c.JSON(http.StatusOK, expense)
@@ -144,65 +193,127 @@ func (s *Service) GetExpenseByID(c echo.Context) error {
 func (s *Service) UpdateExpense(c echo.Context) error {
 	userID := middleware.GetUserID(c)
 	if userID == 0 {
-		return c.JSON(http.StatusUnauthorized, map[string]string{
-			"error": "unauthorized",
-		})
+		return apperr.ErrUnauthorized
 	}
 
 	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
 	if err != nil {
-		return c.JSON(s.NewError(InvalidParams))
+		return apperr.ErrInvalidParams
 	}
 
 	var req struct {
-		CategoryID *int64   `json:"category_id"`
-		Amount     *float64 `json:"amount"`
-		Currency   *string  `json:"currency"`
-		OccurredAt *string  `json:"occurred_at"`
-		Comment    *string  `json:"comment"`
+		Kind       *string `json:"kind" validate:"oneof=expense income"`
+		CategoryID *int64  `json:"category_id"`
+		// AccountID moves the expense to another account; 0 detaches it.
+		AccountID  *int64        `json:"account_id"`
+		Amount     *money.Number `json:"amount" validate:"notblank,positive,scale=Currency"`
+		Currency   *string       `json:"currency" validate:"notblank,currency"`
+		OccurredAt *string       `json:"occurred_at" validate:"notblank,datetime"`
+		// Merchant is cleared when empty.
+		Merchant *string `json:"merchant" validate:"max=255"`
+		Comment  *string `json:"comment"`
+		// Tags replaces all tags of the expense when present.
+		Tags *[]string `json:"tags"`
+		// Allocations replace the allocations when present. An empty list
+		// leaves the expense in a single category, as does setting
+		// CategoryID alone. A new amount of a divided expense needs new
+		// allocations.
+		Allocations *[]allocationRequest `json:"allocations"`
+		// Split replaces the participants when present; otherwise their
+		// shares follow changes of the amount.
+		Split *splitRequest `json:"split"`
 	}
 
-	if err := c.Bind(&req); err != nil {
-		return c.JSON(s.NewError(InvalidParams))
+	if err := validate.Bind(c, &req); err != nil {
+		return err
+	}
+	if req.CategoryID != nil && req.Allocations != nil && len(*req.Allocations) > 0 {
+		return errAllocationsWithCategory
 	}
 
-	var occurredAt *time.Time
+	expense, err := s.expenseRepo.GetByID(c.Request().Context(), id, userID)
+	if err != nil {
+		return err
+	}
+
+	if req.Amount != nil || req.Currency != nil {
+		amount := expense.Amount.Decimal()
+		if req.Amount != nil {
+			amount = string(*req.Amount)
+		}
+		currency := expense.Amount.Currency
+		if req.Currency != nil {
+			currency = *req.Currency
+		}
+
+		expense.Amount, err = money.Parse(amount, currency)
+		if err != nil {
+			return validate.Failed(apperr.FieldError{Field: "amount", Message: "must be an amount in " + currency})
+		}
+		expense.Participants = split.Rescale(expense.Participants, expense.Amount)
+	}
+	if req.Kind != nil {
+		kind, ok := parseKind(*req.Kind)
+		if !ok {
+			return apperr.ErrInvalidParams
+		}
+		expense.Kind = kind
+	}
+	// an income is never shared, so turning an expense into one drops
+	// its participants
+	if expense.Kind != models.KindExpense {
+		if req.Split != nil {
+			return split.ErrIncome.At("split")
+		}
+		expense.Participants = nil
+	}
+	if req.Split != nil {
+		if expense.Participants, err = split.Shares(expense.Amount, req.Split.Mode, req.Split.Participants); err != nil {
+			return err
+		}
+	}
 	if req.OccurredAt != nil {
 		t, err := time.Parse(time.RFC3339, *req.OccurredAt)
 		if err != nil {
-			return c.JSON(s.NewError(InvalidParams))
+			return apperr.ErrInvalidParams
+		}
+		expense.OccurredAt = t
+	}
+	if req.CategoryID != nil {
+		expense.CategoryID = req.CategoryID
+		expense.Allocations = nil
+	}
+	if req.Allocations != nil {
+		if expense.Allocations, err = parseAllocations(*req.Allocations, expense.Amount.Currency); err != nil {
+			return err
+		}
+		if len(expense.Allocations) > 0 {
+			expense.CategoryID = nil
+		}
+	}
+	if req.AccountID != nil {
+		expense.AccountID = req.AccountID
+		if *req.AccountID == 0 {
+			expense.AccountID = nil
+		}
+	}
+	if req.Merchant != nil {
+		expense.Merchant = req.Merchant
+		if *req.Merchant == "" {
+			expense.Merchant = nil
+		}
+	}
+	if req.Comment != nil {
+		expense.Comment = req.Comment
+	}
+	if req.Tags != nil {
+		if expense.Tags, err = tag.Normalize(*req.Tags); err != nil {
+			return err
 		}
-		occurredAt = &t
 	}
 
-	expense := &models.Expense{
-		ID:         id,
-		UserID:     userID,
-		CategoryID: req.CategoryID,
-		Amount: func() float64 {
-			if req.Amount != nil {
-				return *req.Amount
-			}
-			return 0
-		}(),
-		Currency: func() string {
-			if req.Currency != nil {
-				return *req.Currency
-			}
-			return ""
-		}(),
-		OccurredAt: func() time.Time {
-			if occurredAt != nil {
-				return *occurredAt
-			}
-			return time.Time{}
-		}(),
-		Comment: req.Comment,
-	}
-
-	if err := s.expenseRepo.Update(c.Request().Context(), expense); err != nil {
-		s.logger.Error(err)
-		return c.JSON(s.NewError(InternalServerError))
+	if err := s.expenseRepo.Update(c.Request().Context(), expense, userID); err != nil {
+		return err
 	}
 
 	return c.JSON(http.StatusOK, expense)
@@ -211,22 +322,124 @@ func (s *Service) UpdateExpense(c echo.Context) error {
 func (s *Service) DeleteExpense(c echo.Context) error {
 	userID := middleware.GetUserID(c)
 	if userID == 0 {
-		return c.JSON(http.StatusUnauthorized, map[string]string{
-			"error": "unauthorized",
-		})
+		return apperr.ErrUnauthorized
 	}
 
 	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
 	if err != nil {
-		return c.JSON(s.NewError(InvalidParams))
+		return apperr.ErrInvalidParams
 	}
 
 	if err := s.expenseRepo.Delete(c.Request().Context(), id, userID); err != nil {
-		s.logger.Error(err)
-		return c.JSON(s.NewError(InternalServerError))
+		return err
 	}
 
 	return c.JSON(http.StatusOK, map[string]string{
 		"status": "success",
 	})
 }
+
+// expenseFilters reads the filter query parameters shared by the expense
+// list and the endpoints built on top of it. Expenses are taken from the
+// ledger selected for the request. kind=income selects incomes instead and
+// kind=all both. Malformed parameters are left for q to report.
+func (s *Service) expenseFilters(q *query, userID int64) expense.GetExpensesParams {
+	params := expense.GetExpensesParams{
+		LedgerID: middleware.GetLedgerID(q.c),
+		UserID:   userID,
+		Kind:     q.oneOf("kind", models.KindExpense, models.KindExpense, models.KindIncome, "all"),
+	}
+	if params.Kind == "all" {
+		params.Kind = ""
+	}
+
+	params.From = q.time("from", false)
+	params.To = q.time("to", true)
+	if params.From != nil && params.To != nil && params.From.After(*params.To) {
+		q.fail("from", "must not be after to")
+	}
+
+	params.CategoryID = q.id("category_id")
+	params.IncludeSubcategories = q.bool("include_subcategories")
+	params.AccountID = q.id("account_id")
+	params.MinAmount = q.decimal("min")
+	params.MaxAmount = q.decimal("max")
+	params.Search = q.string("search")
+	params.TagsAny = q.list("tags_any")
+	params.TagsAll = q.list("tags_all")
+	params.TagsNone = q.list("tags_none")
+
+	return params
+}
+
+// expenseOrder reads the sort and order parameters of expense lists: the
+// latest expenses come first unless sort=amount or order=asc is given.
+// With a search the best matches come first instead, and sort=relevance
+// is accepted only then.
+func expenseOrder(q *query, search string) (string, string) {
+	if search == "" {
+		return q.oneOf("sort", expense.SortOccurredAt, expense.SortOccurredAt, expense.SortAmount),
+			q.oneOf("order", expense.OrderDesc, expense.OrderAsc, expense.OrderDesc)
+	}
+	return q.oneOf("sort", expense.SortRelevance, expense.SortRelevance, expense.SortOccurredAt, expense.SortAmount),
+		q.oneOf("order", expense.OrderDesc, expense.OrderAsc, expense.OrderDesc)
+}
+
+// splitList splits a comma separated query parameter, dropping empty items.
+func splitList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// parseKind reads the kind of a transaction or category, which is an
+// expense unless given otherwise.
+func parseKind(value string) (string, bool) {
+	switch value {
+	case "", models.KindExpense:
+		return models.KindExpense, true
+	case models.KindIncome:
+		return models.KindIncome, true
+	default:
+		return "", false
+	}
+}
+
+// errAllocationsWithCategory is returned for an expense given both a
+// category and allocations between categories.
+var errAllocationsWithCategory = validate.Failed(apperr.FieldError{
+	Field:   "allocations",
+	Message: "cannot be given together with category_id",
+})
+
+type allocationRequest struct {
+	CategoryID int64        `json:"category_id" validate:"required"`
+	Amount     money.Number `json:"amount" validate:"required,positive"`
+	Comment    string       `json:"comment"`
+}
+
+// parseAllocations reads allocation amounts in the currency of the expense.
+func parseAllocations(items []allocationRequest, currency string) ([]models.Allocation, error) {
+	allocations := make([]models.Allocation, 0, len(items))
+	for i, item := range items {
+		amount, err := money.Parse(string(item.Amount), currency)
+		if err != nil {
+			return nil, validate.Failed(apperr.FieldError{
+				Field:   fmt.Sprintf("allocations[%d].amount", i),
+				Message: "must be an amount in " + currency,
+			})
+		}
+
+		a := models.Allocation{CategoryID: &item.CategoryID, Amount: amount}
+		if item.Comment != "" {
+			a.Comment = &item.Comment
+		}
+		allocations = append(allocations, a)
+	}
+
+	return allocations, nil
+}
@@ -0,0 +1,95 @@
+package service
+
+import (
+	"fmt"
+	"net/http"
+	"search-job/internal/export"
+	"search-job/internal/middleware"
+	"search-job/internal/models"
+	"search-job/internal/pkg/apperr"
+	"search-job/internal/user"
+	"time"
+
+	"github.com/labstack/echo/v4"
+)
+
+// exportFlushEvery is the number of rows after which the response is
+// flushed to the client.
+const exportFlushEvery = 500
+
+// ExportExpenses streams every expense matching the usual list filters as
+// csv, jsonl or xlsx. Once the first row has been sent errors can no
+// longer be reported in the response, so they are only logged.
+func (s *Service) ExportExpenses(c echo.Context) error {
+	userID := middleware.GetUserID(c)
+	if userID == 0 {
+		return apperr.ErrUnauthorized
+	}
+
+	ctx := c.Request().Context()
+
+	format := c.QueryParam("format")
+	if format == "" {
+		format = export.FormatCSV
+	}
+	if !export.IsValidFormat(format) {
+		return apperr.ErrInvalidParams
+	}
+
+	u, err := s.userRepo.GetByID(ctx, userID)
+	if err != nil {
+		return err
+	}
+
+	q := newQuery(c, user.Location(u))
+	params := s.expenseFilters(q, userID)
+	params.Sort, params.Order = expenseOrder(q, params.Search)
+	if q.bool("in_base") {
+		params.BaseCurrency = u.BaseCurrency
+	}
+	if err := q.err(); err != nil {
+		return err
+	}
+
+	res := c.Response()
+	filename := fmt.Sprintf("expenses-%s.%s", time.Now().In(user.Location(u)).Format("2006-01-02"), format)
+	res.Header().Set(echo.HeaderContentType, export.ContentType(format))
+	res.Header().Set(echo.HeaderContentDisposition, fmt.Sprintf("attachment; filename=%q", filename))
+	res.WriteHeader(http.StatusOK)
+
+	w, err := export.NewWriter(format, res, user.Location(u))
+	if err != nil {
+		s.logger.Error(err)
+		return nil
+	}
+	// a failed export still has to release the writer, which holds
+	// temporary files for xlsx
+	closed := false
+	defer func() {
+		if !closed {
+			w.Close()
+		}
+	}()
+
+	written := 0
+	err = s.expenseRepo.Stream(ctx, params, func(e models.Expense) error {
+		if err := w.Write(e); err != nil {
+			return err
+		}
+		written++
+		if written%exportFlushEvery == 0 {
+			res.Flush()
+		}
+		return nil
+	})
+	if err != nil {
+		s.logger.Error(err)
+		return nil
+	}
+
+	closed = true
+	if err := w.Close(); err != nil {
+		s.logger.Error(err)
+	}
+	return nil
+}
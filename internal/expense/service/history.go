@@ -0,0 +1,44 @@
+package service
+
+import (
+	"net/http"
+	"search-job/internal/audit"
+	"search-job/internal/middleware"
+	"search-job/internal/pkg/apperr"
+	"strconv"
+	"time"
+
+	"github.com/labstack/echo/v4"
+)
+
+// GetExpenseHistory lists the recorded changes of an expense, oldest
+// first. The history stays available after the expense is deleted.
+func (s *Service) GetExpenseHistory(c echo.Context) error {
+	userID := middleware.GetUserID(c)
+	if userID == 0 {
+		return apperr.ErrUnauthorized
+	}
+
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		return apperr.ErrInvalidParams
+	}
+
+	q := newQuery(c, time.UTC)
+	page, limit, offset := q.page()
+	if err := q.err(); err != nil {
+		return err
+	}
+
+	events, total, err := s.auditRepo.History(c.Request().Context(), audit.EntityExpense, id, userID, limit, offset)
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"items": events,
+		"total": total,
+		"page":  page,
+		"limit": limit,
+	})
+}
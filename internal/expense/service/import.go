@@ -0,0 +1,127 @@
+package service
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"search-job/internal/importer"
+	"search-job/internal/middleware"
+	"search-job/internal/pkg/apperr"
+	"search-job/internal/user"
+
+	"github.com/labstack/echo/v4"
+)
+
+// maxImportSize limits the size of an uploaded CSV file.
+const maxImportSize = 10 << 20
+
+// ImportExpenses imports expenses from a CSV file sent as the multipart
+// field file, with the column mapping as JSON in the field mapping. With
+// dry_run=true nothing is stored and the per-row errors are returned. A
+// file with any invalid row is rejected as a whole.
+func (s *Service) ImportExpenses(c echo.Context) error {
+	userID := middleware.GetUserID(c)
+	if userID == 0 {
+		return apperr.ErrUnauthorized
+	}
+
+	ctx := c.Request().Context()
+
+	var mapping importer.Mapping
+	if err := json.Unmarshal([]byte(c.FormValue("mapping")), &mapping); err != nil {
+		return apperr.ErrInvalidParams
+	}
+	dryRun := c.FormValue("dry_run") == "true" || c.QueryParam("dry_run") == "true"
+
+	header, err := c.FormFile("file")
+	if err != nil || header.Size > maxImportSize {
+		return apperr.ErrInvalidParams
+	}
+	file, err := header.Open()
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	u, err := s.userRepo.GetByID(ctx, userID)
+	if err != nil {
+		return err
+	}
+
+	rows, rowErrors, err := importer.Parse(file, mapping, user.Location(u))
+	if err != nil {
+		return err
+	}
+
+	ledgerID := middleware.GetLedgerID(c)
+
+	ids, err := s.importRepo.Categories(ctx, ledgerID, userID)
+	if err != nil {
+		return err
+	}
+	newCategories := importer.MissingCategories(rows, ids)
+	if !mapping.CreateCategories && len(newCategories) > 0 {
+		unknown := make(map[string]bool, len(newCategories))
+		for _, name := range newCategories {
+			unknown[importer.CategoryKey(name)] = true
+		}
+		valid := rows[:0]
+		for _, row := range rows {
+			if unknown[importer.CategoryKey(row.CategoryName)] {
+				rowErrors = append(rowErrors, importer.RowError{
+					Row: row.Line, Field: "category", Message: "unknown category " + row.CategoryName,
+				})
+				continue
+			}
+			valid = append(valid, row)
+		}
+		rows, newCategories = valid, nil
+	}
+
+	result := map[string]interface{}{
+		"dry_run":        dryRun,
+		"valid_rows":     len(rows),
+		"invalid_rows":   len(rowErrors),
+		"errors":         rowErrors,
+		"new_categories": newCategories,
+	}
+	if rowErrors == nil {
+		result["errors"] = []importer.RowError{}
+	}
+	if newCategories == nil {
+		result["new_categories"] = []string{}
+	}
+
+	if dryRun {
+		return c.JSON(http.StatusOK, result)
+	}
+	if len(rowErrors) > 0 {
+		return rowsError(rowErrors)
+	}
+
+	created, err := s.importRepo.Commit(ctx, ledgerID, userID, rows, mapping.CreateCategories)
+	if err != nil {
+		return err
+	}
+	if created != nil {
+		result["new_categories"] = created
+	}
+	result["imported"] = len(rows)
+
+	return c.JSON(http.StatusCreated, result)
+}
+
+// rowsError reports every invalid row of an import as a field of the
+// request, such as rows[12].amount.
+func rowsError(rowErrors []importer.RowError) error {
+	fields := make([]apperr.FieldError, len(rowErrors))
+	for i, e := range rowErrors {
+		field := fmt.Sprintf("rows[%d]", e.Row)
+		if e.Field != "" {
+			field += "." + e.Field
+		}
+		fields[i] = apperr.FieldError{Field: field, Message: e.Message}
+	}
+
+	return apperr.Validation("import_invalid_rows", fmt.Sprintf("%d rows cannot be imported", len(rowErrors)), fields...)
+}
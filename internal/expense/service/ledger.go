@@ -0,0 +1,296 @@
+package service
+
+import (
+	"net/http"
+	"search-job/internal/ledger"
+	"search-job/internal/middleware"
+	"search-job/internal/models"
+	"search-job/internal/pkg/apperr"
+	"search-job/internal/pkg/validate"
+	"strconv"
+	"strings"
+
+	"github.com/labstack/echo/v4"
+)
+
+func (s *Service) CreateLedger(c echo.Context) error {
+	userID := middleware.GetUserID(c)
+	if userID == 0 {
+		return apperr.ErrUnauthorized
+	}
+
+	var req struct {
+		Name string `json:"name" validate:"required,max=100"`
+	}
+
+	if err := validate.Bind(c, &req); err != nil {
+		return err
+	}
+	req.Name = strings.TrimSpace(req.Name)
+
+	l := &models.Ledger{Name: req.Name}
+	if err := s.ledgerRepo.Create(c.Request().Context(), l, userID); err != nil {
+		return err
+	}
+
+	return c.JSON(http.StatusCreated, l)
+}
+
+func (s *Service) GetLedgers(c echo.Context) error {
+	userID := middleware.GetUserID(c)
+	if userID == 0 {
+		return apperr.ErrUnauthorized
+	}
+
+	ledgers, err := s.ledgerRepo.GetAll(c.Request().Context(), userID)
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"items": ledgers,
+	})
+}
+
+func (s *Service) GetLedgerByID(c echo.Context) error {
+	userID := middleware.GetUserID(c)
+	if userID == 0 {
+		return apperr.ErrUnauthorized
+	}
+
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		return apperr.ErrInvalidParams
+	}
+
+	l, err := s.ledgerRepo.GetByID(c.Request().Context(), id, userID)
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(http.StatusOK, l)
+}
+
+// UpdateLedger renames a ledger. Only owners may do so.
+func (s *Service) UpdateLedger(c echo.Context) error {
+	userID := middleware.GetUserID(c)
+	if userID == 0 {
+		return apperr.ErrUnauthorized
+	}
+
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		return apperr.ErrInvalidParams
+	}
+
+	var req struct {
+		Name string `json:"name" validate:"required,max=100"`
+	}
+
+	if err := validate.Bind(c, &req); err != nil {
+		return err
+	}
+	req.Name = strings.TrimSpace(req.Name)
+
+	ctx := c.Request().Context()
+
+	l, err := s.ledgerRepo.GetByID(ctx, id, userID)
+	if err != nil {
+		return err
+	}
+
+	l.Name = req.Name
+	if err := s.ledgerRepo.Update(ctx, l, userID); err != nil {
+		return err
+	}
+
+	return c.JSON(http.StatusOK, l)
+}
+
+func (s *Service) GetLedgerMembers(c echo.Context) error {
+	userID := middleware.GetUserID(c)
+	if userID == 0 {
+		return apperr.ErrUnauthorized
+	}
+
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		return apperr.ErrInvalidParams
+	}
+
+	members, err := s.ledgerRepo.Members(c.Request().Context(), id, userID)
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"items": members,
+	})
+}
+
+func (s *Service) UpdateLedgerMember(c echo.Context) error {
+	userID := middleware.GetUserID(c)
+	if userID == 0 {
+		return apperr.ErrUnauthorized
+	}
+
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		return apperr.ErrInvalidParams
+	}
+	memberID, err := strconv.ParseInt(c.Param("userId"), 10, 64)
+	if err != nil {
+		return apperr.ErrInvalidParams
+	}
+
+	var req struct {
+		Role string `json:"role" validate:"required,oneof=owner editor viewer"`
+	}
+
+	if err := validate.Bind(c, &req); err != nil {
+		return err
+	}
+
+	if err := s.ledgerRepo.UpdateMember(c.Request().Context(), id, userID, memberID, req.Role); err != nil {
+		return err
+	}
+
+	return c.JSON(http.StatusOK, map[string]string{
+		"status": "success",
+	})
+}
+
+// RemoveLedgerMember removes a member. Members remove themselves to leave
+// the ledger.
+func (s *Service) RemoveLedgerMember(c echo.Context) error {
+	userID := middleware.GetUserID(c)
+	if userID == 0 {
+		return apperr.ErrUnauthorized
+	}
+
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		return apperr.ErrInvalidParams
+	}
+	memberID, err := strconv.ParseInt(c.Param("userId"), 10, 64)
+	if err != nil {
+		return apperr.ErrInvalidParams
+	}
+
+	if err := s.ledgerRepo.RemoveMember(c.Request().Context(), id, userID, memberID); err != nil {
+		return err
+	}
+
+	return c.JSON(http.StatusOK, map[string]string{
+		"status": "success",
+	})
+}
+
+// CreateLedgerInvitation invites an email address to the ledger. The
+// response carries the token the invited person needs to accept it; it
+// cannot be retrieved later.
+func (s *Service) CreateLedgerInvitation(c echo.Context) error {
+	userID := middleware.GetUserID(c)
+	if userID == 0 {
+		return apperr.ErrUnauthorized
+	}
+
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		return apperr.ErrInvalidParams
+	}
+
+	var req struct {
+		Email string `json:"email" validate:"required,email,max=255"`
+		// Role defaults to editor.
+		Role string `json:"role" validate:"oneof=owner editor viewer"`
+	}
+
+	if err := validate.Bind(c, &req); err != nil {
+		return err
+	}
+	if req.Role == "" {
+		req.Role = ledger.RoleEditor
+	}
+
+	inv := &models.LedgerInvitation{
+		LedgerID: id,
+		Email:    req.Email,
+		Role:     req.Role,
+	}
+
+	if err := s.ledgerRepo.Invite(c.Request().Context(), inv, userID); err != nil {
+		return err
+	}
+
+	return c.JSON(http.StatusCreated, inv)
+}
+
+func (s *Service) GetLedgerInvitations(c echo.Context) error {
+	userID := middleware.GetUserID(c)
+	if userID == 0 {
+		return apperr.ErrUnauthorized
+	}
+
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		return apperr.ErrInvalidParams
+	}
+
+	invitations, err := s.ledgerRepo.Invitations(c.Request().Context(), id, userID)
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"items": invitations,
+	})
+}
+
+func (s *Service) RevokeLedgerInvitation(c echo.Context) error {
+	userID := middleware.GetUserID(c)
+	if userID == 0 {
+		return apperr.ErrUnauthorized
+	}
+
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		return apperr.ErrInvalidParams
+	}
+	invitationID, err := strconv.ParseInt(c.Param("invitationId"), 10, 64)
+	if err != nil {
+		return apperr.ErrInvalidParams
+	}
+
+	if err := s.ledgerRepo.RevokeInvitation(c.Request().Context(), id, invitationID, userID); err != nil {
+		return err
+	}
+
+	return c.JSON(http.StatusOK, map[string]string{
+		"status": "success",
+	})
+}
+
+// AcceptLedgerInvitation joins the ledger of an invitation sent to the
+// email of the current user.
+func (s *Service) AcceptLedgerInvitation(c echo.Context) error {
+	userID := middleware.GetUserID(c)
+	if userID == 0 {
+		return apperr.ErrUnauthorized
+	}
+
+	var req struct {
+		Token string `json:"token" validate:"required"`
+	}
+
+	if err := validate.Bind(c, &req); err != nil {
+		return err
+	}
+
+	l, err := s.ledgerRepo.Accept(c.Request().Context(), req.Token, userID)
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(http.StatusOK, l)
+}
@@ -0,0 +1,196 @@
+package service
+
+import (
+	"search-job/internal/budget"
+	"search-job/internal/pkg/apperr"
+	"search-job/internal/pkg/money"
+	"search-job/internal/pkg/validate"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/labstack/echo/v4"
+)
+
+// maxRelativeDays bounds last_<N>d, ten years back.
+const maxRelativeDays = 3660
+
+// query reads typed query parameters. A malformed value is not ignored but
+// recorded against its parameter, and err reports all of them at once.
+// Dates are taken in loc, the time zone of the user.
+type query struct {
+	c      echo.Context
+	loc    *time.Location
+	now    time.Time
+	fields []apperr.FieldError
+}
+
+func newQuery(c echo.Context, loc *time.Location) *query {
+	return &query{c: c, loc: loc, now: time.Now()}
+}
+
+func (q *query) fail(name, message string) {
+	q.fields = append(q.fields, apperr.FieldError{Field: name, Message: message})
+}
+
+// err returns the validation error listing every malformed parameter, or
+// nil if there are none.
+func (q *query) err() error {
+	if len(q.fields) == 0 {
+		return nil
+	}
+	return validate.Failed(q.fields...)
+}
+
+func (q *query) string(name string) string {
+	return strings.TrimSpace(q.c.QueryParam(name))
+}
+
+// id reads a positive id, nil when the parameter is absent.
+func (q *query) id(name string) *int64 {
+	value := q.string(name)
+	if value == "" {
+		return nil
+	}
+	id, err := strconv.ParseInt(value, 10, 64)
+	if err != nil || id < 1 {
+		q.fail(name, "must be a positive integer")
+		return nil
+	}
+	return &id
+}
+
+// decimal reads an exact number, nil when the parameter is absent.
+func (q *query) decimal(name string) *pgtype.Numeric {
+	value := q.string(name)
+	if value == "" {
+		return nil
+	}
+	n, err := money.ParseNumeric(value)
+	if err != nil {
+		q.fail(name, "must be a decimal number")
+		return nil
+	}
+	return &n
+}
+
+// bool reads true or false, false when the parameter is absent.
+func (q *query) bool(name string) bool {
+	switch q.string(name) {
+	case "", "false":
+		return false
+	case "true":
+		return true
+	}
+	q.fail(name, "must be true or false")
+	return false
+}
+
+// oneOf reads one of options, def when the parameter is absent.
+func (q *query) oneOf(name, def string, options ...string) string {
+	value := q.string(name)
+	if value == "" {
+		return def
+	}
+	for _, option := range options {
+		if value == option {
+			return value
+		}
+	}
+	q.fail(name, "must be one of "+strings.Join(options, ", "))
+	return def
+}
+
+// list reads a comma separated list, dropping empty items.
+func (q *query) list(name string) []string {
+	return splitList(q.c.QueryParam(name))
+}
+
+// page reads page and limit and returns them with the offset they select.
+// page starts at 1 and limit is 20 unless given, at most 100.
+func (q *query) page() (page, limit, offset int) {
+	page, limit = 1, 20
+	if value := q.string("page"); value != "" {
+		n, err := strconv.Atoi(value)
+		if err != nil || n < 1 {
+			q.fail("page", "must be a positive integer")
+		} else {
+			page = n
+		}
+	}
+	if value := q.string("limit"); value != "" {
+		n, err := strconv.Atoi(value)
+		if err != nil || n < 1 || n > 100 {
+			q.fail("limit", "must be an integer from 1 to 100")
+		} else {
+			limit = n
+		}
+	}
+	return page, limit, (page - 1) * limit
+}
+
+// time reads a moment given in RFC 3339, as a date such as 2024-01-31 or
+// relative to today: today, yesterday, this_week, last_week, this_month,
+// last_month, this_year, last_year or last_<N>d for the N days up to and
+// including today. A date or period stands for its first moment, or for
+// its last one with end set, so that to=2024-01-31 includes that day.
+func (q *query) time(name string, end bool) *time.Time {
+	value := q.string(name)
+	if value == "" {
+		return nil
+	}
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return &t
+	}
+
+	start, next, ok := period(value, q.now, q.loc)
+	if !ok {
+		q.fail(name, "must be an RFC 3339 time, a date such as 2024-01-31, today, yesterday, this_week, last_week, this_month, last_month, this_year, last_year or last_<N>d")
+		return nil
+	}
+	if end {
+		// timestamps are stored with microsecond precision
+		last := next.Add(-time.Microsecond)
+		return &last
+	}
+	return &start
+}
+
+// period returns the [start, end) of a date or of a period relative to now,
+// in loc.
+func period(value string, now time.Time, loc *time.Location) (time.Time, time.Time, bool) {
+	if day, err := time.ParseInLocation(time.DateOnly, value, loc); err == nil {
+		return day, day.AddDate(0, 0, 1), true
+	}
+
+	year, month, day := now.In(loc).Date()
+	today := time.Date(year, month, day, 0, 0, 0, 0, loc)
+
+	switch value {
+	case "today":
+		return today, today.AddDate(0, 0, 1), true
+	case "yesterday":
+		return today.AddDate(0, 0, -1), today, true
+	}
+
+	if unit, ok := strings.CutPrefix(value, "this_"); ok && budget.IsValidPeriod(unit) {
+		start, end := budget.Bounds(unit, now, loc)
+		return start, end, true
+	}
+	if rest, ok := strings.CutPrefix(value, "last_"); ok {
+		if budget.IsValidPeriod(rest) {
+			current, _ := budget.Bounds(rest, now, loc)
+			start, end := budget.Bounds(rest, current.AddDate(0, 0, -1), loc)
+			return start, end, true
+		}
+		if count, ok := strings.CutSuffix(rest, "d"); ok {
+			days, err := strconv.Atoi(count)
+			if err == nil && days >= 1 && days <= maxRelativeDays {
+				return today.AddDate(0, 0, 1-days), today.AddDate(0, 0, 1), true
+			}
+		}
+	}
+
+	return time.Time{}, time.Time{}, false
+}
@@ -0,0 +1,324 @@
+package service
+
+import (
+	"errors"
+	"net/http"
+	"search-job/internal/middleware"
+	"search-job/internal/models"
+	"search-job/internal/pkg/apperr"
+	"search-job/internal/pkg/money"
+	"search-job/internal/pkg/validate"
+	"search-job/internal/recurring"
+	"strconv"
+	"time"
+
+	"github.com/labstack/echo/v4"
+)
+
+func (s *Service) CreateRecurringExpense(c echo.Context) error {
+	userID := middleware.GetUserID(c)
+	if userID == 0 {
+		return apperr.ErrUnauthorized
+	}
+
+	var req struct {
+		Kind       string       `json:"kind" validate:"oneof=expense income"`
+		Amount     money.Number `json:"amount" validate:"required,positive,scale=Currency"`
+		Currency   string       `json:"currency" validate:"required,currency"`
+		CategoryID *int64       `json:"category_id"`
+		Comment    *string      `json:"comment"`
+		RRule      string       `json:"rrule" validate:"required,max=255"`
+		StartAt    string       `json:"start_at" validate:"required,datetime"`
+	}
+
+	if err := validate.Bind(c, &req); err != nil {
+		return err
+	}
+
+	kind, ok := parseKind(req.Kind)
+	if !ok {
+		return apperr.ErrInvalidParams
+	}
+
+	amount, err := money.Parse(string(req.Amount), req.Currency)
+	if err != nil {
+		return apperr.ErrInvalidParams
+	}
+
+	rule, err := recurring.ParseRule(req.RRule)
+	if err != nil {
+		return ruleError(err)
+	}
+
+	startAt, err := time.Parse(time.RFC3339, req.StartAt)
+	if err != nil {
+		return apperr.ErrInvalidParams
+	}
+	startAt = startAt.UTC()
+
+	rec := &models.RecurringExpense{
+		LedgerID:   middleware.GetLedgerID(c),
+		UserID:     userID,
+		Kind:       kind,
+		CategoryID: req.CategoryID,
+		Amount:     amount,
+		Comment:    req.Comment,
+		RRule:      rule.String(),
+		StartAt:    startAt,
+	}
+	// a start in the past is backfilled by the scheduler
+	rec.NextIndex, rec.NextOccurrenceAt = rule.Next(startAt, 0, startAt)
+
+	if err := s.recurringRepo.Create(c.Request().Context(), rec); err != nil {
+		return err
+	}
+
+	return c.JSON(http.StatusCreated, rec)
+}
+
+func (s *Service) GetRecurringExpenses(c echo.Context) error {
+	userID := middleware.GetUserID(c)
+	if userID == 0 {
+		return apperr.ErrUnauthorized
+	}
+
+	q := newQuery(c, time.UTC)
+	page, limit, offset := q.page()
+	if err := q.err(); err != nil {
+		return err
+	}
+
+	items, total, err := s.recurringRepo.GetAll(c.Request().Context(), middleware.GetLedgerID(c), userID, limit, offset)
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"items": items,
+		"total": total,
+		"page":  page,
+		"limit": limit,
+	})
+}
+
+func (s *Service) GetRecurringExpenseByID(c echo.Context) error {
+	userID := middleware.GetUserID(c)
+	if userID == 0 {
+		return apperr.ErrUnauthorized
+	}
+
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		return apperr.ErrInvalidParams
+	}
+
+	rec, err := s.recurringRepo.GetByID(c.Request().Context(), id, userID)
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(http.StatusOK, rec)
+}
+
+// UpdateRecurringExpense changes the template for occurrences that have not
+// been created yet. A new rule keeps the start and the occurrences already
+// created, so COUNT includes them; a new start restarts the series. Either
+// way it resumes at the first occurrence from now on.
+func (s *Service) UpdateRecurringExpense(c echo.Context) error {
+	userID := middleware.GetUserID(c)
+	if userID == 0 {
+		return apperr.ErrUnauthorized
+	}
+
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		return apperr.ErrInvalidParams
+	}
+
+	var req struct {
+		Amount     *money.Number `json:"amount" validate:"notblank,positive,scale=Currency"`
+		Currency   *string       `json:"currency" validate:"notblank,currency"`
+		CategoryID *int64        `json:"category_id"`
+		Comment    *string       `json:"comment"`
+		RRule      *string       `json:"rrule" validate:"notblank,max=255"`
+		StartAt    *string       `json:"start_at" validate:"notblank,datetime"`
+	}
+
+	if err := validate.Bind(c, &req); err != nil {
+		return err
+	}
+
+	rec, err := s.recurringRepo.GetByID(c.Request().Context(), id, userID)
+	if err != nil {
+		return err
+	}
+
+	if req.Amount != nil || req.Currency != nil {
+		amount := rec.Amount.Decimal()
+		if req.Amount != nil {
+			amount = string(*req.Amount)
+		}
+		currency := rec.Amount.Currency
+		if req.Currency != nil {
+			currency = *req.Currency
+		}
+
+		rec.Amount, err = money.Parse(amount, currency)
+		if err != nil {
+			return validate.Failed(apperr.FieldError{Field: "amount", Message: "must be an amount in " + currency})
+		}
+	}
+	if req.CategoryID != nil {
+		rec.CategoryID = req.CategoryID
+	}
+	if req.Comment != nil {
+		rec.Comment = req.Comment
+	}
+
+	if req.RRule != nil || req.StartAt != nil {
+		rule, err := recurring.ParseRule(rec.RRule)
+		if req.RRule != nil {
+			rule, err = recurring.ParseRule(*req.RRule)
+		}
+		if err != nil {
+			return ruleError(err)
+		}
+
+		if req.StartAt != nil {
+			startAt, err := time.Parse(time.RFC3339, *req.StartAt)
+			if err != nil {
+				return apperr.ErrInvalidParams
+			}
+			rec.StartAt = startAt.UTC()
+			rec.NextIndex = 0
+		}
+
+		rec.RRule = rule.String()
+		rec.NextIndex, rec.NextOccurrenceAt = rule.Next(rec.StartAt, rec.NextIndex, time.Now())
+	}
+
+	if err := s.recurringRepo.Update(c.Request().Context(), rec, userID); err != nil {
+		return err
+	}
+
+	return c.JSON(http.StatusOK, rec)
+}
+
+func (s *Service) DeleteRecurringExpense(c echo.Context) error {
+	userID := middleware.GetUserID(c)
+	if userID == 0 {
+		return apperr.ErrUnauthorized
+	}
+
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		return apperr.ErrInvalidParams
+	}
+
+	if err := s.recurringRepo.Delete(c.Request().Context(), id, userID); err != nil {
+		return err
+	}
+
+	return c.JSON(http.StatusOK, map[string]string{
+		"status": "success",
+	})
+}
+
+func (s *Service) PauseRecurringExpense(c echo.Context) error {
+	return s.setRecurringPaused(c, true)
+}
+
+// ResumeRecurringExpense continues the series with the first occurrence
+// from now on; occurrences that fell into the pause are not created.
+func (s *Service) ResumeRecurringExpense(c echo.Context) error {
+	return s.setRecurringPaused(c, false)
+}
+
+func (s *Service) setRecurringPaused(c echo.Context, paused bool) error {
+	userID := middleware.GetUserID(c)
+	if userID == 0 {
+		return apperr.ErrUnauthorized
+	}
+
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		return apperr.ErrInvalidParams
+	}
+
+	rec, err := s.recurringRepo.GetByID(c.Request().Context(), id, userID)
+	if err != nil {
+		return err
+	}
+
+	if rec.Paused && !paused {
+		rule, err := recurring.ParseRule(rec.RRule)
+		if err != nil {
+			return err
+		}
+		rec.NextIndex, rec.NextOccurrenceAt = rule.Next(rec.StartAt, rec.NextIndex, time.Now())
+	}
+	rec.Paused = paused
+
+	if err := s.recurringRepo.Update(c.Request().Context(), rec, userID); err != nil {
+		return err
+	}
+
+	return c.JSON(http.StatusOK, rec)
+}
+
+func (s *Service) SkipRecurringOccurrence(c echo.Context) error {
+	userID := middleware.GetUserID(c)
+	if userID == 0 {
+		return apperr.ErrUnauthorized
+	}
+
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		return apperr.ErrInvalidParams
+	}
+
+	var req struct {
+		OccurrenceAt string `json:"occurrence_at" validate:"required,datetime"`
+	}
+
+	if err := validate.Bind(c, &req); err != nil {
+		return err
+	}
+
+	occurrenceAt, err := time.Parse(time.RFC3339, req.OccurrenceAt)
+	if err != nil {
+		return apperr.ErrInvalidParams
+	}
+
+	rec, err := s.recurringRepo.GetByID(c.Request().Context(), id, userID)
+	if err != nil {
+		return err
+	}
+
+	rule, err := recurring.ParseRule(rec.RRule)
+	if err != nil {
+		return err
+	}
+
+	// only upcoming occurrences of the series can be skipped
+	_, next := rule.Next(rec.StartAt, rec.NextIndex, occurrenceAt)
+	if next == nil || !next.Equal(occurrenceAt) {
+		return validate.Failed(apperr.FieldError{Field: "occurrence_at", Message: "is not an upcoming occurrence of the series"})
+	}
+
+	if err := s.recurringRepo.Skip(c.Request().Context(), rec.ID, userID, occurrenceAt); err != nil {
+		return err
+	}
+
+	return c.JSON(http.StatusOK, map[string]string{
+		"status": "success",
+	})
+}
+
+// ruleError points an error of recurring.ParseRule at the rrule field.
+func ruleError(err error) error {
+	if errors.Is(err, recurring.ErrInvalidRule) {
+		return apperr.From(err).At("rrule")
+	}
+	return err
+}
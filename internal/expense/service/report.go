@@ -0,0 +1,95 @@
+package service
+
+import (
+	"net/http"
+	"search-job/internal/expense"
+	"search-job/internal/middleware"
+	"search-job/internal/pkg/apperr"
+	"search-job/internal/user"
+
+	"github.com/labstack/echo/v4"
+)
+
+// GetSummary aggregates expenses matching the usual list filters.
+// group_by takes a comma separated list of category, currency and one of
+// day, week, month or year; compare=previous adds the preceding period.
+func (s *Service) GetSummary(c echo.Context) error {
+	userID := middleware.GetUserID(c)
+	if userID == 0 {
+		return apperr.ErrUnauthorized
+	}
+
+	ctx := c.Request().Context()
+
+	u, err := s.userRepo.GetByID(ctx, userID)
+	if err != nil {
+		return err
+	}
+
+	q := newQuery(c, user.Location(u))
+	params := expense.SummaryParams{
+		Filter:   s.expenseFilters(q, userID),
+		Location: q.loc,
+		Compare:  q.oneOf("compare", "", "previous") == "previous",
+		GroupBy:  q.list("group_by"),
+	}
+	if q.bool("in_base") {
+		params.Filter.BaseCurrency = u.BaseCurrency
+	}
+	if err := q.err(); err != nil {
+		return err
+	}
+
+	rows, err := s.expenseRepo.Summary(ctx, params)
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"items":    rows,
+		"group_by": params.GroupBy,
+		"timezone": params.Location.String(),
+	})
+}
+
+// GetCashFlow returns income, spending and their difference per period.
+// period is day, week, month (the default) or year; the usual list filters
+// apply except kind.
+func (s *Service) GetCashFlow(c echo.Context) error {
+	userID := middleware.GetUserID(c)
+	if userID == 0 {
+		return apperr.ErrUnauthorized
+	}
+
+	ctx := c.Request().Context()
+
+	u, err := s.userRepo.GetByID(ctx, userID)
+	if err != nil {
+		return err
+	}
+
+	q := newQuery(c, user.Location(u))
+	params := expense.CashFlowParams{
+		Filter: s.expenseFilters(q, userID),
+		Period: q.oneOf("period", expense.GroupByMonth,
+			expense.GroupByDay, expense.GroupByWeek, expense.GroupByMonth, expense.GroupByYear),
+		Location: q.loc,
+	}
+	if q.bool("in_base") {
+		params.Filter.BaseCurrency = u.BaseCurrency
+	}
+	if err := q.err(); err != nil {
+		return err
+	}
+
+	rows, err := s.expenseRepo.CashFlow(ctx, params)
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"items":    rows,
+		"period":   params.Period,
+		"timezone": params.Location.String(),
+	})
+}
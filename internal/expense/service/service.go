@@ -1,8 +1,20 @@
 package service
 
 import (
+	"search-job/internal/account"
+	"search-job/internal/attachment"
+	"search-job/internal/audit"
+	"search-job/internal/budget"
 	"search-job/internal/category"
+	"search-job/internal/config"
 	"search-job/internal/expense"
+	"search-job/internal/importer"
+	"search-job/internal/ledger"
+	"search-job/internal/pkg/storage"
+	"search-job/internal/recurring"
+	"search-job/internal/split"
+	"search-job/internal/tag"
+	"search-job/internal/trash"
 	"search-job/internal/user"
 
 	"github.com/labstack/gommon/log"
@@ -10,23 +22,33 @@ import (
 	"github.com/jackc/pgx/v5/pgxpool"
 )
 
-const (
-	InvalidParams       = "invalid params"
-	InternalServerError = "internal error"
-)
-
 type Service struct {
-	db           *pgxpool.Pool
-	logger       *log.Logger
-	expenseRepo  *expense.Repo
-	userRepo     *user.Repo
-	categoryRepo *category.Repo
+	db             *pgxpool.Pool
+	logger         *log.Logger
+	expenseRepo    *expense.Repo
+	userRepo       *user.Repo
+	categoryRepo   *category.Repo
+	recurringRepo  *recurring.Repo
+	budgetRepo     *budget.Repo
+	importRepo     *importer.Repo
+	tagRepo        *tag.Repo
+	attachmentRepo *attachment.Repo
+	trashRepo      *trash.Repo
+	auditRepo      *audit.Repo
+	ledgerRepo     *ledger.Repo
+	splitRepo      *split.Repo
+	accountRepo    *account.Repo
+
+	cfg     *config.Config
+	storage storage.Storage
 }
 
-func NewService(db *pgxpool.Pool, logger *log.Logger) *Service {
+func NewService(db *pgxpool.Pool, logger *log.Logger, cfg *config.Config, blobs storage.Storage) *Service {
 	svc := &Service{
-		db:     db,
-		logger: logger,
+		db:      db,
+		logger:  logger,
+		cfg:     cfg,
+		storage: blobs,
 	}
 	svc.initRepositories()
 	return svc
@@ -36,17 +58,14 @@ func (s *Service) initRepositories() {
 	s.expenseRepo = expense.NewRepo(s.db)
 	s.userRepo = user.NewRepo(s.db)
 	s.categoryRepo = category.NewRepo(s.db)
-}
-
-type Response struct {
-	Object       any    `json:"object,omitempty"`
-	ErrorMessage string `json:"error,omitempty"`
-}
-
-func (r *Response) Error() string {
-	return r.ErrorMessage
-}
-
-func (s *Service) NewError(err string) (int, *Response) {
-	return 400, &Response{ErrorMessage: err}
+	s.recurringRepo = recurring.NewRepo(s.db)
+	s.budgetRepo = budget.NewRepo(s.db)
+	s.importRepo = importer.NewRepo(s.db)
+	s.tagRepo = tag.NewRepo(s.db)
+	s.attachmentRepo = attachment.NewRepo(s.db)
+	s.trashRepo = trash.NewRepo(s.db)
+	s.auditRepo = audit.NewRepo(s.db)
+	s.ledgerRepo = ledger.NewRepo(s.db)
+	s.splitRepo = split.NewRepo(s.db)
+	s.accountRepo = account.NewRepo(s.db)
 }
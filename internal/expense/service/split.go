@@ -0,0 +1,141 @@
+package service
+
+import (
+	"net/http"
+	"search-job/internal/middleware"
+	"search-job/internal/models"
+	"search-job/internal/pkg/apperr"
+	"search-job/internal/pkg/money"
+	"search-job/internal/pkg/validate"
+	"search-job/internal/split"
+	"strconv"
+	"time"
+
+	"github.com/labstack/echo/v4"
+)
+
+// splitRequest shares an expense between members of its ledger. Mode is
+// one of split.ModeEqual, split.ModePercent and split.ModeExact; an empty
+// list of participants makes the expense personal again.
+type splitRequest struct {
+	Mode         string        `json:"mode" validate:"oneof=equal percent exact"`
+	Participants []split.Entry `json:"participants"`
+}
+
+// GetBalances shows who owes whom in the selected ledger together with the
+// fewest transfers that would settle everything.
+func (s *Service) GetBalances(c echo.Context) error {
+	userID := middleware.GetUserID(c)
+	if userID == 0 {
+		return apperr.ErrUnauthorized
+	}
+
+	balances, err := s.splitRepo.Balances(c.Request().Context(), middleware.GetLedgerID(c), userID)
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"balances":  balances,
+		"transfers": split.Simplify(balances),
+	})
+}
+
+func (s *Service) CreateSettlement(c echo.Context) error {
+	userID := middleware.GetUserID(c)
+	if userID == 0 {
+		return apperr.ErrUnauthorized
+	}
+
+	var req struct {
+		FromUserID int64        `json:"from_user_id" validate:"required"`
+		ToUserID   int64        `json:"to_user_id" validate:"required"`
+		Amount     money.Number `json:"amount" validate:"required,positive,scale=Currency"`
+		Currency   string       `json:"currency" validate:"required,currency"`
+		// SettledAt defaults to now.
+		SettledAt string `json:"settled_at" validate:"datetime"`
+		Comment   string `json:"comment"`
+	}
+
+	if err := validate.Bind(c, &req); err != nil {
+		return err
+	}
+	if req.FromUserID == req.ToUserID {
+		return validate.Failed(apperr.FieldError{Field: "to_user_id", Message: "must differ from from_user_id"})
+	}
+
+	amount, err := money.Parse(string(req.Amount), req.Currency)
+	if err != nil || amount.IsNegative() || amount.IsZero() {
+		return apperr.ErrInvalidParams
+	}
+
+	settledAt := time.Now()
+	if req.SettledAt != "" {
+		if settledAt, err = time.Parse(time.RFC3339, req.SettledAt); err != nil {
+			return apperr.ErrInvalidParams
+		}
+	}
+
+	settlement := &models.Settlement{
+		LedgerID:   middleware.GetLedgerID(c),
+		FromUserID: req.FromUserID,
+		ToUserID:   req.ToUserID,
+		Amount:     amount,
+		SettledAt:  settledAt,
+		CreatedBy:  &userID,
+	}
+	if req.Comment != "" {
+		settlement.Comment = &req.Comment
+	}
+
+	if err := s.splitRepo.CreateSettlement(c.Request().Context(), settlement); err != nil {
+		return err
+	}
+
+	return c.JSON(http.StatusCreated, settlement)
+}
+
+func (s *Service) GetSettlements(c echo.Context) error {
+	userID := middleware.GetUserID(c)
+	if userID == 0 {
+		return apperr.ErrUnauthorized
+	}
+
+	q := newQuery(c, time.UTC)
+	page, limit, offset := q.page()
+	if err := q.err(); err != nil {
+		return err
+	}
+
+	settlements, total, err := s.splitRepo.GetSettlements(c.Request().Context(), middleware.GetLedgerID(c), userID, limit, offset)
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"items": settlements,
+		"total": total,
+		"page":  page,
+		"limit": limit,
+	})
+}
+
+func (s *Service) DeleteSettlement(c echo.Context) error {
+	userID := middleware.GetUserID(c)
+	if userID == 0 {
+		return apperr.ErrUnauthorized
+	}
+
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		return apperr.ErrInvalidParams
+	}
+
+	if err := s.splitRepo.DeleteSettlement(c.Request().Context(), id, userID); err != nil {
+		return err
+	}
+
+	return c.JSON(http.StatusOK, map[string]string{
+		"status": "success",
+	})
+}
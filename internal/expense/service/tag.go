@@ -0,0 +1,118 @@
+package service
+
+import (
+	"net/http"
+	"search-job/internal/middleware"
+	"search-job/internal/models"
+	"search-job/internal/pkg/apperr"
+	"search-job/internal/pkg/validate"
+	"search-job/internal/tag"
+	"strconv"
+
+	"github.com/labstack/echo/v4"
+)
+
+func (s *Service) CreateTag(c echo.Context) error {
+	userID := middleware.GetUserID(c)
+	if userID == 0 {
+		return apperr.ErrUnauthorized
+	}
+
+	var req struct {
+		Name string `json:"name" validate:"required,max=50"`
+	}
+
+	if err := validate.Bind(c, &req); err != nil {
+		return err
+	}
+
+	names, err := tag.Normalize([]string{req.Name})
+	if err != nil {
+		return err
+	}
+
+	t := &models.Tag{
+		LedgerID: middleware.GetLedgerID(c),
+		UserID:   userID,
+		Name:     names[0],
+	}
+
+	if err := s.tagRepo.Create(c.Request().Context(), t); err != nil {
+		return err
+	}
+
+	return c.JSON(http.StatusCreated, t)
+}
+
+func (s *Service) GetTags(c echo.Context) error {
+	userID := middleware.GetUserID(c)
+	if userID == 0 {
+		return apperr.ErrUnauthorized
+	}
+
+	tags, err := s.tagRepo.GetAll(c.Request().Context(), middleware.GetLedgerID(c), userID)
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"items": tags,
+	})
+}
+
+func (s *Service) UpdateTag(c echo.Context) error {
+	userID := middleware.GetUserID(c)
+	if userID == 0 {
+		return apperr.ErrUnauthorized
+	}
+
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		return apperr.ErrInvalidParams
+	}
+
+	var req struct {
+		Name string `json:"name" validate:"required,max=50"`
+	}
+
+	if err := validate.Bind(c, &req); err != nil {
+		return err
+	}
+
+	names, err := tag.Normalize([]string{req.Name})
+	if err != nil {
+		return err
+	}
+
+	t, err := s.tagRepo.GetByID(c.Request().Context(), id, userID)
+	if err != nil {
+		return err
+	}
+	t.Name = names[0]
+
+	if err := s.tagRepo.Update(c.Request().Context(), t, userID); err != nil {
+		return err
+	}
+
+	return c.JSON(http.StatusOK, t)
+}
+
+func (s *Service) DeleteTag(c echo.Context) error {
+	userID := middleware.GetUserID(c)
+	if userID == 0 {
+		return apperr.ErrUnauthorized
+	}
+
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		return apperr.ErrInvalidParams
+	}
+
+	if err := s.tagRepo.Delete(c.Request().Context(), id, userID); err != nil {
+		return err
+	}
+
+	return c.JSON(http.StatusOK, map[string]string{
+		"status": "success",
+	})
+}
@@ -0,0 +1,103 @@
+package service
+
+import (
+	"net/http"
+	"search-job/internal/middleware"
+	"search-job/internal/models"
+	"search-job/internal/pkg/apperr"
+	"search-job/internal/trash"
+	"strconv"
+	"time"
+
+	"github.com/labstack/echo/v4"
+)
+
+// GetTrash lists deleted expenses and categories. type=expense or
+// type=category limits the list to one kind.
+func (s *Service) GetTrash(c echo.Context) error {
+	userID := middleware.GetUserID(c)
+	if userID == 0 {
+		return apperr.ErrUnauthorized
+	}
+
+	q := newQuery(c, time.UTC)
+	itemType := q.oneOf("type", "", trash.TypeExpense, trash.TypeCategory)
+	page, limit, offset := q.page()
+	if err := q.err(); err != nil {
+		return err
+	}
+
+	items, total, err := s.trashRepo.List(c.Request().Context(), middleware.GetLedgerID(c), userID, itemType, limit, offset)
+	if err != nil {
+		return err
+	}
+
+	if retention := s.cfg.Trash.Retention; retention > 0 {
+		for i := range items {
+			purgeAt := items[i].DeletedAt.Add(retention)
+			items[i].PurgeAt = &purgeAt
+		}
+	}
+
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"items": items,
+		"total": total,
+		"page":  page,
+		"limit": limit,
+	})
+}
+
+// RestoreExpense restores an expense. If its category, or that of one of
+// its allocations, is still in the trash, the expense is restored without
+// its category or allocations and the response says so with
+// category_cleared.
+func (s *Service) RestoreExpense(c echo.Context) error {
+	userID := middleware.GetUserID(c)
+	if userID == 0 {
+		return apperr.ErrUnauthorized
+	}
+
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		return apperr.ErrInvalidParams
+	}
+
+	ctx := c.Request().Context()
+
+	categoryCleared, err := s.expenseRepo.Restore(ctx, id, userID)
+	if err != nil {
+		return err
+	}
+
+	expense, err := s.expenseRepo.GetByID(ctx, id, userID)
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(http.StatusOK, struct {
+		*models.Expense
+		CategoryCleared bool `json:"category_cleared,omitempty"`
+	}{expense, categoryCleared})
+}
+
+// RestoreCategory restores a category and the subcategories deleted with
+// it. The response shows the name it was restored under, which gets a
+// numbered suffix if the original one has been reused.
+func (s *Service) RestoreCategory(c echo.Context) error {
+	userID := middleware.GetUserID(c)
+	if userID == 0 {
+		return apperr.ErrUnauthorized
+	}
+
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		return apperr.ErrInvalidParams
+	}
+
+	category, err := s.categoryRepo.Restore(c.Request().Context(), id, userID)
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(http.StatusOK, category)
+}
@@ -0,0 +1,65 @@
+package service
+
+import (
+	"net/http"
+	"search-job/internal/middleware"
+	"search-job/internal/pkg/apperr"
+	"search-job/internal/pkg/money"
+	"search-job/internal/pkg/validate"
+	"strings"
+
+	"github.com/labstack/echo/v4"
+)
+
+func (s *Service) GetProfile(c echo.Context) error {
+	userID := middleware.GetUserID(c)
+	if userID == 0 {
+		return apperr.ErrUnauthorized
+	}
+
+	user, err := s.userRepo.GetByID(c.Request().Context(), userID)
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(http.StatusOK, user)
+}
+
+func (s *Service) UpdateProfile(c echo.Context) error {
+	userID := middleware.GetUserID(c)
+	if userID == 0 {
+		return apperr.ErrUnauthorized
+	}
+
+	var req struct {
+		// BaseCurrency is accepted in any case.
+		BaseCurrency *string `json:"base_currency" validate:"notblank"`
+		Timezone     *string `json:"timezone" validate:"notblank,timezone"`
+	}
+
+	if err := validate.Bind(c, &req); err != nil {
+		return err
+	}
+
+	user, err := s.userRepo.GetByID(c.Request().Context(), userID)
+	if err != nil {
+		return err
+	}
+
+	if req.BaseCurrency != nil {
+		currency := strings.ToUpper(*req.BaseCurrency)
+		if !money.IsValidCurrency(currency) {
+			return validate.Failed(apperr.FieldError{Field: "base_currency", Message: "must be an ISO 4217 currency code"})
+		}
+		user.BaseCurrency = currency
+	}
+	if req.Timezone != nil {
+		user.Timezone = *req.Timezone
+	}
+
+	if err := s.userRepo.UpdateSettings(c.Request().Context(), user); err != nil {
+		return err
+	}
+
+	return c.JSON(http.StatusOK, user)
+}
@@ -0,0 +1,341 @@
+package expense
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"math/big"
+	"search-job/internal/models"
+	"search-job/internal/pkg/apperr"
+	"search-job/internal/pkg/money"
+	"search-job/internal/rates"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+const (
+	GroupByCategory = "category"
+	GroupByCurrency = "currency"
+	GroupByDay      = "day"
+	GroupByWeek     = "week"
+	GroupByMonth    = "month"
+	GroupByYear     = "year"
+)
+
+var ErrInvalidGroupBy = apperr.Validation("invalid_group_by", "invalid group_by")
+
+type SummaryParams struct {
+	Filter  GetExpensesParams
+	GroupBy []string
+	// Location is the time zone periods are aligned to.
+	Location *time.Location
+	// Compare adds the figures of the preceding period to every row.
+	Compare bool
+}
+
+// Summary aggregates the expenses matching the filter. Without a base
+// currency in the filter rows are always split by currency, since amounts
+// in different currencies cannot be added up.
+func (r *Repo) Summary(ctx context.Context, params SummaryParams) ([]models.SummaryRow, error) {
+	var byCategory, byCurrency bool
+	var unit string
+	for _, g := range params.GroupBy {
+		switch g {
+		case GroupByCategory:
+			byCategory = true
+		case GroupByCurrency:
+			byCurrency = true
+		case GroupByDay, GroupByWeek, GroupByMonth, GroupByYear:
+			if unit != "" {
+				return nil, fmt.Errorf("%w: only one time period is allowed", ErrInvalidGroupBy)
+			}
+			unit = g
+		default:
+			return nil, fmt.Errorf("%w: %q", ErrInvalidGroupBy, g)
+		}
+	}
+	if params.Filter.BaseCurrency == "" {
+		byCurrency = true
+	}
+	if params.Location == nil {
+		params.Location = time.UTC
+	}
+
+	if !params.Compare {
+		return r.summary(ctx, params.Filter, byCategory, byCurrency, unit, params.Location)
+	}
+
+	if unit == "" {
+		return r.compareWindows(ctx, params.Filter, byCategory, byCurrency, params.Location)
+	}
+	return r.compareBuckets(ctx, params.Filter, byCategory, byCurrency, unit, params.Location)
+}
+
+// compareWindows compares the filtered window with the window of the same
+// length right before it.
+func (r *Repo) compareWindows(ctx context.Context, filter GetExpensesParams, byCategory, byCurrency bool, loc *time.Location) ([]models.SummaryRow, error) {
+	if filter.From == nil || filter.To == nil {
+		return nil, fmt.Errorf("%w: comparing without a period requires from and to", ErrInvalidGroupBy)
+	}
+
+	current, err := r.summary(ctx, filter, byCategory, byCurrency, "", loc)
+	if err != nil {
+		return nil, err
+	}
+
+	prevFrom := filter.From.Add(-filter.To.Sub(*filter.From))
+	prevTo := filter.From.Add(-time.Microsecond)
+	prevFilter := filter
+	prevFilter.From, prevFilter.To = &prevFrom, &prevTo
+
+	previous, err := r.summary(ctx, prevFilter, byCategory, byCurrency, "", loc)
+	if err != nil {
+		return nil, err
+	}
+
+	byKey := make(map[string]models.SummaryRow, len(previous))
+	for _, row := range previous {
+		byKey[summaryKey(row, nil)] = row
+	}
+	for i := range current {
+		prev, ok := byKey[summaryKey(current[i], nil)]
+		current[i].Previous = comparison(current[i], prev, ok)
+	}
+
+	return current, nil
+}
+
+// compareBuckets compares every period bucket with the bucket right before
+// it. The query window is widened by one bucket so that the first bucket
+// has something to be compared with.
+func (r *Repo) compareBuckets(ctx context.Context, filter GetExpensesParams, byCategory, byCurrency bool, unit string, loc *time.Location) ([]models.SummaryRow, error) {
+	extended := filter
+	if filter.From != nil {
+		from := shiftBucket(unit, truncateBucket(unit, *filter.From, loc), -1)
+		extended.From = &from
+	}
+
+	rows, err := r.summary(ctx, extended, byCategory, byCurrency, unit, loc)
+	if err != nil {
+		return nil, err
+	}
+
+	byKey := make(map[string]models.SummaryRow, len(rows))
+	for _, row := range rows {
+		byKey[summaryKey(row, row.Period)] = row
+	}
+
+	result := make([]models.SummaryRow, 0, len(rows))
+	for _, row := range rows {
+		if filter.From != nil && row.Period.Before(truncateBucket(unit, *filter.From, loc)) {
+			continue
+		}
+		prevPeriod := shiftBucket(unit, row.Period.In(loc), -1)
+		prev, ok := byKey[summaryKey(row, &prevPeriod)]
+		row.Previous = comparison(row, prev, ok)
+		result = append(result, row)
+	}
+
+	return result, nil
+}
+
+// summary aggregates the category lines of the expenses, so that the parts
+// of a divided expense go to their own categories. Count is the number of
+// expenses, however many lines they have.
+func (r *Repo) summary(ctx context.Context, filter GetExpensesParams, byCategory, byCurrency bool, unit string, loc *time.Location) ([]models.SummaryRow, error) {
+	where, args := lineConditions(filter)
+	arg := func(v interface{}) string {
+		args = append(args, v)
+		return fmt.Sprintf("$%d", len(args))
+	}
+
+	var keys []string
+	if byCategory {
+		keys = append(keys, "l.category_id", "c.name")
+	}
+	if unit != "" {
+		tz := arg(loc.String())
+		keys = append(keys, fmt.Sprintf("date_trunc('%s', e.occurred_at AT TIME ZONE %s) AT TIME ZONE %s", unit, tz, tz))
+	}
+	if byCurrency {
+		keys = append(keys, "e.currency")
+	}
+
+	total := "SUM(l.amount)"
+	unconverted := "0"
+	if filter.BaseCurrency != "" {
+		scale, err := money.Scale(filter.BaseCurrency)
+		if err != nil {
+			return nil, err
+		}
+		converted := convertedAmount("l.amount", arg(filter.BaseCurrency))
+		total = fmt.Sprintf("ROUND(COALESCE(SUM(%s), 0), %s)", converted, arg(scale))
+		unconverted = fmt.Sprintf("COUNT(DISTINCT e.id) FILTER (WHERE (%s) IS NULL)", converted)
+	}
+
+	groupBy := ""
+	if len(keys) > 0 {
+		positions := make([]string, len(keys))
+		for i := range keys {
+			positions[i] = fmt.Sprint(i + 1)
+		}
+		groupBy = "GROUP BY " + strings.Join(positions, ", ") + " ORDER BY " + strings.Join(positions, ", ")
+	}
+
+	selectKeys := ""
+	if len(keys) > 0 {
+		selectKeys = strings.Join(keys, ", ") + ", "
+	}
+
+	query := fmt.Sprintf(`
+		SELECT %s%s, COUNT(DISTINCT e.id), %s
+		FROM expenses e
+		CROSS JOIN LATERAL %s l
+		LEFT JOIN categories c ON l.category_id = c.id AND c.ledger_id = e.ledger_id AND c.deleted_at IS NULL
+		WHERE %s
+		%s
+	`, selectKeys, total, unconverted, expenseLines, strings.Join(where, " AND "), groupBy)
+
+	rows, err := r.db.Query(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var result []models.SummaryRow
+	for rows.Next() {
+		var row models.SummaryRow
+		var period time.Time
+		var sum pgtype.Numeric
+
+		var dest []any
+		if byCategory {
+			dest = append(dest, &row.CategoryID, &row.CategoryName)
+		}
+		if unit != "" {
+			dest = append(dest, &period)
+		}
+		if byCurrency {
+			dest = append(dest, &row.Currency)
+		}
+		dest = append(dest, &sum, &row.Count, &row.Unconverted)
+
+		if err := rows.Scan(dest...); err != nil {
+			return nil, err
+		}
+
+		if unit != "" {
+			period = period.In(loc)
+			row.Period = &period
+		}
+		currency := row.Currency
+		if filter.BaseCurrency != "" {
+			currency = filter.BaseCurrency
+		}
+		if row.Total, err = money.FromNumeric(sum, currency); err != nil {
+			return nil, err
+		}
+		if !byCurrency {
+			row.Currency = currency
+		}
+		if row.Average, err = average(row.Total, row.Count); err != nil {
+			return nil, err
+		}
+
+		result = append(result, row)
+	}
+
+	return result, rows.Err()
+}
+
+// lineConditions is filterConditions for queries over expenseLines aliased
+// as l: the category filter picks the matching lines rather than whole
+// expenses.
+func lineConditions(filter GetExpensesParams) ([]string, []interface{}) {
+	expenseFilter := filter
+	expenseFilter.CategoryID = nil
+	where, args := filterConditions(expenseFilter)
+
+	if filter.CategoryID != nil {
+		args = append(args, *filter.CategoryID)
+		where = append(where, categoryCondition("l.category_id", fmt.Sprintf("$%d", len(args)), filter.IncludeSubcategories))
+	}
+
+	return where, args
+}
+
+// convertedAmount converts amount of the expense aliased as e into the
+// currency base at the rate of the day it occurred. It is NULL when the
+// rate is not known.
+func convertedAmount(amount, base string) string {
+	return fmt.Sprintf("CASE WHEN e.currency = %s THEN %s ELSE %s * (%s) / (%s) END",
+		base, amount, amount, rates.RateQuery(base+"::varchar", "e.occurred_at"), rates.RateQuery("e.currency", "e.occurred_at"))
+}
+
+func average(total money.Money, count int) (money.Money, error) {
+	if count == 0 {
+		return money.Money{Currency: total.Currency}, nil
+	}
+	return total.Convert(big.NewRat(1, int64(count)), total.Currency)
+}
+
+func comparison(current, prev models.SummaryRow, ok bool) *models.SummaryComparison {
+	cmp := &models.SummaryComparison{
+		Total: money.Money{Currency: current.Total.Currency},
+	}
+	if !ok {
+		return cmp
+	}
+
+	cmp.Total = prev.Total
+	cmp.Count = prev.Count
+	if prev.Total.Amount != 0 {
+		change := math.Round(float64(current.Total.Amount-prev.Total.Amount)/float64(prev.Total.Amount)*10000) / 100
+		cmp.ChangePercent = &change
+	}
+	return cmp
+}
+
+func summaryKey(row models.SummaryRow, period *time.Time) string {
+	var b strings.Builder
+	if row.CategoryID != nil {
+		fmt.Fprintf(&b, "c%d", *row.CategoryID)
+	}
+	if period != nil {
+		fmt.Fprintf(&b, "p%d", period.Unix())
+	}
+	b.WriteString(row.Currency)
+	return b.String()
+}
+
+func truncateBucket(unit string, t time.Time, loc *time.Location) time.Time {
+	t = t.In(loc)
+	year, month, day := t.Date()
+
+	switch unit {
+	case GroupByWeek:
+		offset := (int(t.Weekday()) + 6) % 7
+		return time.Date(year, month, day-offset, 0, 0, 0, 0, loc)
+	case GroupByMonth:
+		return time.Date(year, month, 1, 0, 0, 0, 0, loc)
+	case GroupByYear:
+		return time.Date(year, time.January, 1, 0, 0, 0, 0, loc)
+	default:
+		return time.Date(year, month, day, 0, 0, 0, 0, loc)
+	}
+}
+
+func shiftBucket(unit string, t time.Time, n int) time.Time {
+	switch unit {
+	case GroupByWeek:
+		return t.AddDate(0, 0, 7*n)
+	case GroupByMonth:
+		return t.AddDate(0, n, 0)
+	case GroupByYear:
+		return t.AddDate(n, 0, 0)
+	default:
+		return t.AddDate(0, 0, n)
+	}
+}
@@ -0,0 +1,216 @@
+package export
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"io"
+	"search-job/internal/models"
+	"search-job/internal/pkg/apperr"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/xuri/excelize/v2"
+)
+
+const (
+	FormatCSV   = "csv"
+	FormatJSONL = "jsonl"
+	FormatXLSX  = "xlsx"
+)
+
+var ErrUnknownFormat = apperr.Validation("export_unknown_format", "unknown export format")
+
+// Writer writes expenses one at a time. Close must be called to flush
+// whatever the format keeps buffered.
+type Writer interface {
+	Write(e models.Expense) error
+	Close() error
+}
+
+// NewWriter returns a writer for format. Times are written in loc.
+func NewWriter(format string, w io.Writer, loc *time.Location) (Writer, error) {
+	switch format {
+	case FormatCSV:
+		return newCSVWriter(w, loc)
+	case FormatJSONL:
+		return &jsonlWriter{enc: json.NewEncoder(w), loc: loc}, nil
+	case FormatXLSX:
+		return newXLSXWriter(w, loc)
+	default:
+		return nil, ErrUnknownFormat
+	}
+}
+
+func IsValidFormat(format string) bool {
+	return format == FormatCSV || format == FormatJSONL || format == FormatXLSX
+}
+
+// ContentType returns the media type of format.
+func ContentType(format string) string {
+	switch format {
+	case FormatCSV:
+		return "text/csv; charset=utf-8"
+	case FormatJSONL:
+		return "application/jsonl; charset=utf-8"
+	case FormatXLSX:
+		return "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet"
+	default:
+		return "application/octet-stream"
+	}
+}
+
+var header = []string{
+	"id", "occurred_at", "amount", "currency", "category_id", "category",
+	"comment", "amount_in_base", "base_currency", "recurring_id", "tags", "kind",
+}
+
+// record returns the columns of header for e as strings.
+func record(e models.Expense, loc *time.Location) []string {
+	rec := []string{
+		strconv.FormatInt(e.ID, 10),
+		e.OccurredAt.In(loc).Format(time.RFC3339),
+		e.Amount.Decimal(),
+		e.Amount.Currency,
+		optionalInt(e.CategoryID),
+		optionalString(e.CategoryName),
+		optionalString(e.Comment),
+		"",
+		"",
+		optionalInt(e.RecurringID),
+		strings.Join(e.Tags, ", "),
+		e.Kind,
+	}
+	if e.AmountInBase != nil {
+		rec[7], rec[8] = e.AmountInBase.Decimal(), e.AmountInBase.Currency
+	}
+	return rec
+}
+
+type csvWriter struct {
+	w   *csv.Writer
+	loc *time.Location
+}
+
+func newCSVWriter(w io.Writer, loc *time.Location) (*csvWriter, error) {
+	cw := &csvWriter{w: csv.NewWriter(w), loc: loc}
+	if err := cw.w.Write(header); err != nil {
+		return nil, err
+	}
+	return cw, nil
+}
+
+func (cw *csvWriter) Write(e models.Expense) error {
+	return cw.w.Write(record(e, cw.loc))
+}
+
+func (cw *csvWriter) Close() error {
+	cw.w.Flush()
+	return cw.w.Error()
+}
+
+type jsonlWriter struct {
+	enc *json.Encoder
+	loc *time.Location
+}
+
+func (jw *jsonlWriter) Write(e models.Expense) error {
+	e.OccurredAt = e.OccurredAt.In(jw.loc)
+	return jw.enc.Encode(e)
+}
+
+func (jw *jsonlWriter) Close() error {
+	return nil
+}
+
+// xlsxWriter uses the excelize stream writer, which keeps rows in a
+// temporary file instead of memory. The workbook can only be written out
+// once complete, so nothing reaches w before Close.
+type xlsxWriter struct {
+	w      io.Writer
+	file   *excelize.File
+	stream *excelize.StreamWriter
+	loc    *time.Location
+	row    int
+	// dateStyle displays occurred_at as a date and time
+	dateStyle int
+}
+
+func newXLSXWriter(w io.Writer, loc *time.Location) (*xlsxWriter, error) {
+	file := excelize.NewFile()
+	stream, err := file.NewStreamWriter("Sheet1")
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+
+	dateFormat := "yyyy-mm-dd hh:mm:ss"
+	dateStyle, err := file.NewStyle(&excelize.Style{CustomNumFmt: &dateFormat})
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+
+	xw := &xlsxWriter{w: w, file: file, stream: stream, loc: loc, row: 1, dateStyle: dateStyle}
+	cells := make([]interface{}, len(header))
+	for i, h := range header {
+		cells[i] = h
+	}
+	if err := xw.writeRow(cells); err != nil {
+		file.Close()
+		return nil, err
+	}
+	return xw, nil
+}
+
+func (xw *xlsxWriter) Write(e models.Expense) error {
+	rec := record(e, xw.loc)
+	cells := make([]interface{}, len(rec))
+	for i, v := range rec {
+		cells[i] = v
+	}
+	// numbers and dates are stored natively so that they can be summed and
+	// sorted in the spreadsheet
+	cells[0] = e.ID
+	// excelize stores the wall clock of the time, which is what the user
+	// expects to see in their time zone
+	cells[1] = excelize.Cell{StyleID: xw.dateStyle, Value: e.OccurredAt.In(xw.loc)}
+	if amount, err := strconv.ParseFloat(rec[2], 64); err == nil {
+		cells[2] = amount
+	}
+	if amount, err := strconv.ParseFloat(rec[7], 64); err == nil {
+		cells[7] = amount
+	}
+	return xw.writeRow(cells)
+}
+
+func (xw *xlsxWriter) writeRow(cells []interface{}) error {
+	cell, err := excelize.CoordinatesToCellName(1, xw.row)
+	if err != nil {
+		return err
+	}
+	xw.row++
+	return xw.stream.SetRow(cell, cells)
+}
+
+func (xw *xlsxWriter) Close() error {
+	defer xw.file.Close()
+	if err := xw.stream.Flush(); err != nil {
+		return err
+	}
+	return xw.file.Write(xw.w)
+}
+
+func optionalInt(v *int64) string {
+	if v == nil {
+		return ""
+	}
+	return strconv.FormatInt(*v, 10)
+}
+
+func optionalString(v *string) string {
+	if v == nil {
+		return ""
+	}
+	return *v
+}
@@ -0,0 +1,319 @@
+package importer
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"search-job/internal/category"
+	"search-job/internal/pkg/apperr"
+	"search-job/internal/pkg/money"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+const (
+	SignAsIs   = "as_is"
+	SignNegate = "negate"
+	SignAbs    = "abs"
+
+	MaxRows = 50000
+
+	pathSeparator = " > "
+)
+
+var ErrInvalidMapping = apperr.Validation("import_invalid_mapping", "invalid mapping")
+
+// Mapping describes how the columns of an uploaded CSV file map onto
+// expense fields. Columns are referenced by header name, or by zero based
+// index when the file has no header.
+type Mapping struct {
+	Columns            Columns `json:"columns"`
+	HasHeader          *bool   `json:"has_header"`
+	Delimiter          string  `json:"delimiter"`
+	DateFormat         string  `json:"date_format"`
+	DecimalSeparator   string  `json:"decimal_separator"`
+	ThousandsSeparator string  `json:"thousands_separator"`
+	// AmountSign is as_is, negate (for bank exports where spending is
+	// negative) or abs. Rows whose amount is not positive afterwards are
+	// reported as errors.
+	AmountSign       string `json:"amount_sign"`
+	DefaultCurrency  string `json:"default_currency"`
+	CreateCategories bool   `json:"create_categories"`
+}
+
+type Columns struct {
+	Date     string `json:"date"`
+	Amount   string `json:"amount"`
+	Currency string `json:"currency"`
+	Category string `json:"category"`
+	Comment  string `json:"comment"`
+}
+
+type Row struct {
+	Line       int
+	OccurredAt time.Time
+	Amount     money.Money
+	// CategoryName is a category name or a path of names like
+	// "Food > Restaurants".
+	CategoryName string
+	Comment      *string
+}
+
+type RowError struct {
+	Row     int    `json:"row"`
+	Field   string `json:"field,omitempty"`
+	Message string `json:"message"`
+}
+
+// Parse reads the whole file and returns the rows that could be parsed
+// together with an error for every row that could not. Dates without an
+// offset are read in loc.
+func Parse(r io.Reader, m Mapping, loc *time.Location) ([]Row, []RowError, error) {
+	if err := m.normalize(); err != nil {
+		return nil, nil, err
+	}
+
+	reader := csv.NewReader(r)
+	reader.Comma, _ = utf8.DecodeRuneInString(m.Delimiter)
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+
+	var index map[string]int
+	line := 0
+	if *m.HasHeader {
+		header, err := reader.Read()
+		if err != nil {
+			return nil, nil, fmt.Errorf("%w: cannot read header: %v", ErrInvalidMapping, err)
+		}
+		line++
+		index = make(map[string]int, len(header))
+		for i, name := range header {
+			index[strings.TrimSpace(strings.TrimPrefix(name, "\ufeff"))] = i
+		}
+	}
+
+	cols, err := m.Columns.resolve(index)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	layouts := dateLayouts(m.DateFormat)
+
+	var rows []Row
+	var rowErrors []RowError
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		line++
+		if err != nil {
+			rowErrors = append(rowErrors, RowError{Row: line, Message: err.Error()})
+			continue
+		}
+		if line > MaxRows {
+			return nil, nil, fmt.Errorf("%w: more than %d rows", ErrInvalidMapping, MaxRows)
+		}
+
+		row, rowErr := parseRecord(record, cols, m, layouts, loc)
+		if rowErr != nil {
+			rowErr.Row = line
+			rowErrors = append(rowErrors, *rowErr)
+			continue
+		}
+		row.Line = line
+		rows = append(rows, row)
+	}
+
+	return rows, rowErrors, nil
+}
+
+func parseRecord(record []string, cols resolvedColumns, m Mapping, layouts []string, loc *time.Location) (Row, *RowError) {
+	field := func(i int) string {
+		if i < 0 || i >= len(record) {
+			return ""
+		}
+		return strings.TrimSpace(record[i])
+	}
+
+	var row Row
+
+	rawDate := field(cols.date)
+	occurredAt, ok := parseDate(rawDate, layouts, loc)
+	if !ok {
+		return row, &RowError{Field: "date", Message: fmt.Sprintf("cannot parse date %q", rawDate)}
+	}
+	row.OccurredAt = occurredAt
+
+	currency := strings.ToUpper(field(cols.currency))
+	if currency == "" {
+		currency = m.DefaultCurrency
+	}
+	if !money.IsValidCurrency(currency) {
+		return row, &RowError{Field: "currency", Message: fmt.Sprintf("unknown currency %q", currency)}
+	}
+
+	rawAmount := field(cols.amount)
+	amount, err := money.Parse(normalizeAmount(rawAmount, m), currency)
+	if err != nil {
+		return row, &RowError{Field: "amount", Message: fmt.Sprintf("cannot parse amount %q: %v", rawAmount, err)}
+	}
+	switch m.AmountSign {
+	case SignNegate:
+		amount = amount.Neg()
+	case SignAbs:
+		if amount.IsNegative() {
+			amount = amount.Neg()
+		}
+	}
+	// expenses are positive; refunds and incomes in a bank export come
+	// out negative and are reported rather than imported
+	if amount.IsZero() || amount.IsNegative() {
+		return row, &RowError{Field: "amount", Message: fmt.Sprintf("amount %q must be greater than zero after amount_sign %s", rawAmount, m.AmountSign)}
+	}
+	row.Amount = amount
+
+	row.CategoryName = strings.Join(splitPath(field(cols.category)), pathSeparator)
+	if len(splitPath(row.CategoryName)) > category.MaxDepth {
+		return row, &RowError{Field: "category", Message: category.ErrTooDeep.Error()}
+	}
+	if comment := field(cols.comment); comment != "" {
+		row.Comment = &comment
+	}
+
+	return row, nil
+}
+
+func (m *Mapping) normalize() error {
+	if m.HasHeader == nil {
+		hasHeader := true
+		m.HasHeader = &hasHeader
+	}
+	if m.Delimiter == "" {
+		m.Delimiter = ","
+	}
+	if utf8.RuneCountInString(m.Delimiter) != 1 {
+		return fmt.Errorf("%w: delimiter must be a single character", ErrInvalidMapping)
+	}
+	if m.DecimalSeparator == "" {
+		m.DecimalSeparator = "."
+	}
+	if m.DecimalSeparator != "." && m.DecimalSeparator != "," {
+		return fmt.Errorf("%w: decimal_separator must be \".\" or \",\"", ErrInvalidMapping)
+	}
+	if m.ThousandsSeparator == m.DecimalSeparator {
+		return fmt.Errorf("%w: thousands_separator must differ from decimal_separator", ErrInvalidMapping)
+	}
+	switch m.AmountSign {
+	case "":
+		m.AmountSign = SignAsIs
+	case SignAsIs, SignNegate, SignAbs:
+	default:
+		return fmt.Errorf("%w: amount_sign must be one of as_is, negate, abs", ErrInvalidMapping)
+	}
+	m.DefaultCurrency = strings.ToUpper(m.DefaultCurrency)
+	if m.Columns.Currency == "" && !money.IsValidCurrency(m.DefaultCurrency) {
+		return fmt.Errorf("%w: default_currency is required without a currency column", ErrInvalidMapping)
+	}
+	if m.Columns.Date == "" || m.Columns.Amount == "" {
+		return fmt.Errorf("%w: date and amount columns are required", ErrInvalidMapping)
+	}
+	return nil
+}
+
+type resolvedColumns struct {
+	date, amount, currency, category, comment int
+}
+
+func (c Columns) resolve(header map[string]int) (resolvedColumns, error) {
+	lookup := func(name string) (int, error) {
+		if name == "" {
+			return -1, nil
+		}
+		if header != nil {
+			if i, ok := header[name]; ok {
+				return i, nil
+			}
+		}
+		if i, err := strconv.Atoi(name); err == nil && i >= 0 {
+			return i, nil
+		}
+		return -1, fmt.Errorf("%w: column %q not found", ErrInvalidMapping, name)
+	}
+
+	var res resolvedColumns
+	var err error
+	if res.date, err = lookup(c.Date); err != nil {
+		return res, err
+	}
+	if res.amount, err = lookup(c.Amount); err != nil {
+		return res, err
+	}
+	if res.currency, err = lookup(c.Currency); err != nil {
+		return res, err
+	}
+	if res.category, err = lookup(c.Category); err != nil {
+		return res, err
+	}
+	if res.comment, err = lookup(c.Comment); err != nil {
+		return res, err
+	}
+	return res, nil
+}
+
+func normalizeAmount(s string, m Mapping) string {
+	// banks often group thousands with regular or non-breaking spaces
+	s = strings.NewReplacer(" ", "", "\u00a0", "").Replace(s)
+	if m.ThousandsSeparator != "" {
+		s = strings.ReplaceAll(s, m.ThousandsSeparator, "")
+	}
+	if m.DecimalSeparator == "," {
+		s = strings.ReplaceAll(s, ",", ".")
+	}
+	return s
+}
+
+// dateLayouts converts a format like DD.MM.YYYY HH:mm into a Go layout. An
+// empty format accepts RFC 3339 and ISO dates.
+func dateLayouts(format string) []string {
+	if format == "" {
+		return []string{time.RFC3339, time.DateTime, "2006-01-02T15:04:05", time.DateOnly}
+	}
+
+	layout := strings.NewReplacer(
+		"YYYY", "2006",
+		"YY", "06",
+		"MM", "01",
+		"DD", "02",
+		"HH", "15",
+		"mm", "04",
+		"ss", "05",
+	).Replace(format)
+	return []string{layout}
+}
+
+func parseDate(s string, layouts []string, loc *time.Location) (time.Time, bool) {
+	for _, layout := range layouts {
+		if t, err := time.ParseInLocation(layout, s, loc); err == nil {
+			return t, true
+		}
+	}
+	return time.Time{}, false
+}
+
+// CategoryKey normalizes a category path for case insensitive matching.
+func CategoryKey(path string) string {
+	return strings.ToLower(strings.Join(splitPath(path), pathSeparator))
+}
+
+func splitPath(path string) []string {
+	var segments []string
+	for _, s := range strings.Split(path, ">") {
+		if s = strings.TrimSpace(s); s != "" {
+			segments = append(segments, s)
+		}
+	}
+	return segments
+}
@@ -0,0 +1,242 @@
+package importer
+
+import (
+	"context"
+	"fmt"
+	"search-job/internal/audit"
+	"search-job/internal/ledger"
+	"search-job/internal/models"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// copyBatchSize is the number of rows sent with a single COPY.
+const copyBatchSize = 1000
+
+type Repo struct {
+	db *pgxpool.Pool
+}
+
+func NewRepo(db *pgxpool.Pool) *Repo {
+	return &Repo{db: db}
+}
+
+// Categories returns the ids of the ledger's expense categories keyed by
+// CategoryKey of their full path. A bare name is a key too, as long as no
+// other category has the same name. The user must be a member of the
+// ledger.
+func (r *Repo) Categories(ctx context.Context, ledgerID, userID int64) (map[string]int64, error) {
+	return categories(ctx, r.db, ledgerID, userID)
+}
+
+// Commit inserts the rows in a single transaction. Categories that do not
+// exist yet are created, including their missing parents, when
+// createCategories is set, otherwise rows referencing them are stored
+// without a category; callers are expected to reject such rows beforehand.
+// It returns the paths of the created categories. ledger.ErrForbidden is
+// returned unless the user may write to the ledger.
+func (r *Repo) Commit(ctx context.Context, ledgerID, userID int64, rows []Row, createCategories bool) ([]string, error) {
+	tx, err := r.db.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback(ctx)
+
+	var allowed bool
+	err = tx.QueryRow(ctx, "SELECT "+ledger.AccessCondition("$1", "$2", ledger.Write), ledgerID, userID).Scan(&allowed)
+	if err != nil {
+		return nil, err
+	}
+	if !allowed {
+		return nil, ledger.ErrForbidden
+	}
+
+	ids, err := categories(ctx, tx, ledgerID, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	var created []string
+	var events []audit.Event
+	if createCategories {
+		for _, path := range MissingCategories(rows, ids) {
+			var parentID *int64
+			segments := splitPath(path)
+			for i, name := range segments {
+				key := CategoryKey(strings.Join(segments[:i+1], pathSeparator))
+				if id, ok := ids[key]; ok {
+					parentID = &id
+					continue
+				}
+
+				c := models.Category{LedgerID: ledgerID, UserID: userID, ParentID: parentID, Kind: models.KindExpense, Name: name}
+				err := tx.QueryRow(ctx, `
+					INSERT INTO categories (ledger_id, user_id, parent_id, kind, name, created_at, updated_at)
+					VALUES ($1, $2, $3, $4, $5, NOW(), NOW())
+					RETURNING id, created_at, updated_at
+				`, ledgerID, userID, parentID, c.Kind, name).Scan(&c.ID, &c.CreatedAt, &c.UpdatedAt)
+				if err != nil {
+					return nil, err
+				}
+				id := c.ID
+				ids[key] = id
+				parentID = &id
+				created = append(created, strings.Join(segments[:i+1], pathSeparator))
+				events = append(events, audit.Event{
+					LedgerID:   ledgerID,
+					OwnerID:    userID,
+					EntityType: audit.EntityCategory,
+					EntityID:   c.ID,
+					Action:     audit.ActionCreate,
+					After:      c,
+				})
+			}
+		}
+	}
+
+	// the timestamp identifies the inserted rows afterwards, so it must
+	// survive the round trip at the precision of the database
+	now := time.Now().Truncate(time.Microsecond)
+	expenses := make([]models.Expense, len(rows))
+	columns := []string{"ledger_id", "user_id", "category_id", "amount", "currency", "occurred_at", "comment", "created_at", "updated_at"}
+	for start := 0; start < len(rows); start += copyBatchSize {
+		end := min(start+copyBatchSize, len(rows))
+
+		_, err := tx.CopyFrom(ctx, pgx.Identifier{"expenses"}, columns,
+			pgx.CopyFromSlice(end-start, func(i int) ([]any, error) {
+				row := rows[start+i]
+				var categoryID *int64
+				if id, ok := ids[CategoryKey(row.CategoryName)]; ok && row.CategoryName != "" {
+					categoryID = &id
+				}
+				expenses[start+i] = models.Expense{
+					LedgerID:   ledgerID,
+					UserID:     userID,
+					Kind:       models.KindExpense,
+					CategoryID: categoryID,
+					Amount:     row.Amount,
+					OccurredAt: row.OccurredAt,
+					Comment:    row.Comment,
+					CreatedAt:  now,
+					UpdatedAt:  now,
+					Tags:       []string{},
+				}
+				return []any{
+					ledgerID, userID, categoryID, row.Amount.Numeric(), row.Amount.Currency,
+					row.OccurredAt, row.Comment, now, now,
+				}, nil
+			}))
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// COPY does not return the ids; they were taken from the sequence in
+	// the order of the rows
+	idRows, err := tx.Query(ctx, `
+		SELECT id FROM expenses WHERE ledger_id = $1 AND user_id = $2 AND created_at = $3 ORDER BY id
+	`, ledgerID, userID, now)
+	if err != nil {
+		return nil, err
+	}
+	for i := 0; i < len(expenses) && idRows.Next(); i++ {
+		if err := idRows.Scan(&expenses[i].ID); err != nil {
+			idRows.Close()
+			return nil, err
+		}
+		events = append(events, audit.Event{
+			LedgerID:   ledgerID,
+			OwnerID:    userID,
+			EntityType: audit.EntityExpense,
+			EntityID:   expenses[i].ID,
+			Action:     audit.ActionCreate,
+			After:      expenses[i],
+		})
+	}
+	idRows.Close()
+	if err := idRows.Err(); err != nil {
+		return nil, err
+	}
+
+	if err := audit.Record(ctx, tx, events...); err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return nil, err
+	}
+
+	return created, nil
+}
+
+// MissingCategories returns the distinct category paths of rows that are
+// not in ids, in the order they first appear.
+func MissingCategories(rows []Row, ids map[string]int64) []string {
+	seen := make(map[string]bool)
+	var missing []string
+	for _, row := range rows {
+		key := CategoryKey(row.CategoryName)
+		if row.CategoryName == "" || seen[key] {
+			continue
+		}
+		seen[key] = true
+		if _, ok := ids[key]; !ok {
+			missing = append(missing, row.CategoryName)
+		}
+	}
+	return missing
+}
+
+type querier interface {
+	Query(ctx context.Context, sql string, args ...any) (pgx.Rows, error)
+}
+
+func categories(ctx context.Context, q querier, ledgerID, userID int64) (map[string]int64, error) {
+	rows, err := q.Query(ctx, fmt.Sprintf(`
+		SELECT id, parent_id, name FROM categories
+		WHERE ledger_id = $1 AND kind = $3 AND deleted_at IS NULL AND %s
+	`, ledger.AccessCondition("categories.ledger_id", "$2", ledger.Read)), ledgerID, userID, models.KindExpense)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	type node struct {
+		parentID *int64
+		name     string
+	}
+	nodes := make(map[int64]node)
+	for rows.Next() {
+		var id int64
+		var n node
+		if err := rows.Scan(&id, &n.parentID, &n.name); err != nil {
+			return nil, err
+		}
+		nodes[id] = n
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	ids := make(map[string]int64, len(nodes))
+	names := make(map[string]int)
+	for id, n := range nodes {
+		path := n.name
+		for p := n.parentID; p != nil; p = nodes[*p].parentID {
+			path = nodes[*p].name + pathSeparator + path
+		}
+		ids[CategoryKey(path)] = id
+		names[CategoryKey(n.name)]++
+	}
+	for id, n := range nodes {
+		key := CategoryKey(n.name)
+		if _, ok := ids[key]; !ok && names[key] == 1 {
+			ids[key] = id
+		}
+	}
+
+	return ids, nil
+}
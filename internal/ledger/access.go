@@ -0,0 +1,68 @@
+package ledger
+
+import (
+	"fmt"
+	"strings"
+)
+
+const (
+	RoleOwner  = "owner"
+	RoleEditor = "editor"
+	RoleViewer = "viewer"
+)
+
+func IsValidRole(role string) bool {
+	return role == RoleOwner || role == RoleEditor || role == RoleViewer
+}
+
+// Access is what a user wants to do with the contents of a ledger.
+type Access int
+
+const (
+	// Read allows listing and viewing, granted to every member.
+	Read Access = iota
+	// Write allows changing categories and expenses, granted to owners
+	// and editors.
+	Write
+	// Manage allows renaming the ledger and managing its members, granted
+	// to owners only.
+	Manage
+)
+
+func (a Access) roles() []string {
+	switch a {
+	case Manage:
+		return []string{RoleOwner}
+	case Write:
+		return []string{RoleOwner, RoleEditor}
+	default:
+		return []string{RoleOwner, RoleEditor, RoleViewer}
+	}
+}
+
+// Allows reports whether a member with the role has the access.
+func (a Access) Allows(role string) bool {
+	for _, r := range a.roles() {
+		if r == role {
+			return true
+		}
+	}
+	return false
+}
+
+// AccessCondition returns an SQL condition that holds when the user
+// userExpr is a member of the ledger ledgerExpr with the given access.
+// Columns must be qualified with their table, since the condition is a
+// subquery over ledger_members, whose own columns would shadow them.
+func AccessCondition(ledgerExpr, userExpr string, access Access) string {
+	roles := access.roles()
+	quoted := make([]string, len(roles))
+	for i, role := range roles {
+		quoted[i] = "'" + role + "'"
+	}
+
+	return fmt.Sprintf(`EXISTS (
+		SELECT 1 FROM ledger_members lm
+		WHERE lm.ledger_id = %s AND lm.user_id = %s AND lm.role IN (%s)
+	)`, ledgerExpr, userExpr, strings.Join(quoted, ", "))
+}
@@ -0,0 +1,473 @@
+package ledger
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"search-job/internal/models"
+	"search-job/internal/pkg/apperr"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// DefaultName is the name of the ledger every user gets on registration.
+const DefaultName = "Personal"
+
+const InvitationTTL = 7 * 24 * time.Hour
+
+var (
+	ErrForbidden         = apperr.Forbidden("ledger_forbidden", "not allowed in this ledger")
+	ErrNotMember         = apperr.Forbidden("ledger_not_member", "not a member of this ledger")
+	ErrLastOwner         = apperr.Conflict("ledger_last_owner", "ledger must keep at least one owner")
+	ErrAlreadyMember     = apperr.Conflict("ledger_already_member", "user is already a member of the ledger")
+	ErrInvitationInvalid = apperr.NotFound("invitation_invalid", "invitation is invalid or has expired")
+)
+
+type Repo struct {
+	db *pgxpool.Pool
+}
+
+func NewRepo(db *pgxpool.Pool) *Repo {
+	return &Repo{db: db}
+}
+
+// CreateDefault creates the personal ledger of a new user within tx.
+func CreateDefault(ctx context.Context, tx pgx.Tx, userID int64) error {
+	l := &models.Ledger{Name: DefaultName}
+	return create(ctx, tx, l, userID)
+}
+
+// Create creates a ledger owned by the user.
+func (r *Repo) Create(ctx context.Context, l *models.Ledger, userID int64) error {
+	tx, err := r.db.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	if err := create(ctx, tx, l, userID); err != nil {
+		return err
+	}
+
+	return tx.Commit(ctx)
+}
+
+func create(ctx context.Context, tx pgx.Tx, l *models.Ledger, userID int64) error {
+	err := tx.QueryRow(ctx, `
+		INSERT INTO ledgers (name, created_by, created_at, updated_at)
+		VALUES ($1, $2, NOW(), NOW())
+		RETURNING id, created_at, updated_at
+	`, l.Name, userID).Scan(&l.ID, &l.CreatedAt, &l.UpdatedAt)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(ctx, `
+		INSERT INTO ledger_members (ledger_id, user_id, role, created_at)
+		VALUES ($1, $2, $3, NOW())
+	`, l.ID, userID, RoleOwner)
+	if err != nil {
+		return err
+	}
+
+	l.CreatedBy = &userID
+	l.Role = RoleOwner
+	return nil
+}
+
+// GetAll returns the ledgers the user is a member of in the order they
+// were joined.
+func (r *Repo) GetAll(ctx context.Context, userID int64) ([]models.Ledger, error) {
+	rows, err := r.db.Query(ctx, `
+		SELECT l.id, l.name, l.created_by, m.role, l.created_at, l.updated_at
+		FROM ledgers l
+		JOIN ledger_members m ON m.ledger_id = l.id
+		WHERE m.user_id = $1
+		ORDER BY m.created_at, l.id
+	`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	ledgers := []models.Ledger{}
+	for rows.Next() {
+		var l models.Ledger
+		if err := rows.Scan(&l.ID, &l.Name, &l.CreatedBy, &l.Role, &l.CreatedAt, &l.UpdatedAt); err != nil {
+			return nil, err
+		}
+		ledgers = append(ledgers, l)
+	}
+
+	return ledgers, rows.Err()
+}
+
+func (r *Repo) GetByID(ctx context.Context, id, userID int64) (*models.Ledger, error) {
+	return getByID(ctx, r.db, id, userID)
+}
+
+type querier interface {
+	QueryRow(ctx context.Context, sql string, args ...any) pgx.Row
+}
+
+func getByID(ctx context.Context, q querier, id, userID int64) (*models.Ledger, error) {
+	var l models.Ledger
+	err := q.QueryRow(ctx, `
+		SELECT l.id, l.name, l.created_by, m.role, l.created_at, l.updated_at
+		FROM ledgers l
+		JOIN ledger_members m ON m.ledger_id = l.id
+		WHERE l.id = $1 AND m.user_id = $2
+	`, id, userID).Scan(&l.ID, &l.Name, &l.CreatedBy, &l.Role, &l.CreatedAt, &l.UpdatedAt)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, sql.ErrNoRows
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return &l, nil
+}
+
+// Role returns the role of the user in the ledger, or sql.ErrNoRows when
+// the user is not a member.
+func (r *Repo) Role(ctx context.Context, id, userID int64) (string, error) {
+	return role(ctx, r.db, id, userID)
+}
+
+func role(ctx context.Context, q querier, id, userID int64) (string, error) {
+	var role string
+	err := q.QueryRow(ctx, `
+		SELECT role FROM ledger_members WHERE ledger_id = $1 AND user_id = $2
+	`, id, userID).Scan(&role)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return "", sql.ErrNoRows
+	}
+
+	return role, err
+}
+
+// Default returns the ledger the user joined first, normally the one
+// created on registration.
+func (r *Repo) Default(ctx context.Context, userID int64) (int64, error) {
+	var id int64
+	err := r.db.QueryRow(ctx, `
+		SELECT ledger_id FROM ledger_members
+		WHERE user_id = $1
+		ORDER BY created_at, ledger_id
+		LIMIT 1
+	`, userID).Scan(&id)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return 0, sql.ErrNoRows
+	}
+
+	return id, err
+}
+
+// authorize returns sql.ErrNoRows when the user is not a member of the
+// ledger and ErrForbidden when the role does not grant the access.
+func authorize(ctx context.Context, q querier, id, userID int64, access Access) error {
+	role, err := role(ctx, q, id, userID)
+	if err != nil {
+		return err
+	}
+	if !access.Allows(role) {
+		return ErrForbidden
+	}
+	return nil
+}
+
+// Update renames the ledger.
+func (r *Repo) Update(ctx context.Context, l *models.Ledger, userID int64) error {
+	if err := authorize(ctx, r.db, l.ID, userID, Manage); err != nil {
+		return err
+	}
+
+	err := r.db.QueryRow(ctx, `
+		UPDATE ledgers SET name = $1, updated_at = NOW()
+		WHERE id = $2
+		RETURNING updated_at
+	`, l.Name, l.ID).Scan(&l.UpdatedAt)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return sql.ErrNoRows
+	}
+
+	return err
+}
+
+func (r *Repo) Members(ctx context.Context, id, userID int64) ([]models.LedgerMember, error) {
+	if err := authorize(ctx, r.db, id, userID, Read); err != nil {
+		return nil, err
+	}
+
+	rows, err := r.db.Query(ctx, `
+		SELECT m.ledger_id, m.user_id, u.email, m.role, m.created_at
+		FROM ledger_members m
+		JOIN users u ON u.id = m.user_id
+		WHERE m.ledger_id = $1
+		ORDER BY m.created_at, m.user_id
+	`, id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	members := []models.LedgerMember{}
+	for rows.Next() {
+		var m models.LedgerMember
+		if err := rows.Scan(&m.LedgerID, &m.UserID, &m.Email, &m.Role, &m.CreatedAt); err != nil {
+			return nil, err
+		}
+		members = append(members, m)
+	}
+
+	return members, rows.Err()
+}
+
+// UpdateMember changes the role of a member. The last owner cannot be
+// demoted.
+func (r *Repo) UpdateMember(ctx context.Context, id, userID, memberID int64, newRole string) error {
+	tx, err := r.db.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	if err := authorize(ctx, tx, id, userID, Manage); err != nil {
+		return err
+	}
+	if err := lockMembers(ctx, tx, id); err != nil {
+		return err
+	}
+
+	result, err := tx.Exec(ctx, `
+		UPDATE ledger_members SET role = $1 WHERE ledger_id = $2 AND user_id = $3
+	`, newRole, id, memberID)
+	if err != nil {
+		return err
+	}
+	if result.RowsAffected() == 0 {
+		return sql.ErrNoRows
+	}
+
+	if err := ensureOwner(ctx, tx, id); err != nil {
+		return err
+	}
+
+	return tx.Commit(ctx)
+}
+
+// RemoveMember removes a member from the ledger. Owners can remove anyone,
+// every member can leave. The last owner cannot leave.
+func (r *Repo) RemoveMember(ctx context.Context, id, userID, memberID int64) error {
+	tx, err := r.db.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	access := Manage
+	if memberID == userID {
+		access = Read
+	}
+	if err := authorize(ctx, tx, id, userID, access); err != nil {
+		return err
+	}
+	if err := lockMembers(ctx, tx, id); err != nil {
+		return err
+	}
+
+	result, err := tx.Exec(ctx, `
+		DELETE FROM ledger_members WHERE ledger_id = $1 AND user_id = $2
+	`, id, memberID)
+	if err != nil {
+		return err
+	}
+	if result.RowsAffected() == 0 {
+		return sql.ErrNoRows
+	}
+
+	if err := ensureOwner(ctx, tx, id); err != nil {
+		return err
+	}
+
+	return tx.Commit(ctx)
+}
+
+// lockMembers serializes membership changes of a ledger, so that two
+// owners cannot demote each other at the same time.
+func lockMembers(ctx context.Context, tx pgx.Tx, id int64) error {
+	_, err := tx.Exec(ctx, `SELECT id FROM ledgers WHERE id = $1 FOR UPDATE`, id)
+	return err
+}
+
+func ensureOwner(ctx context.Context, tx pgx.Tx, id int64) error {
+	var owners int
+	err := tx.QueryRow(ctx, `
+		SELECT COUNT(*) FROM ledger_members WHERE ledger_id = $1 AND role = $2
+	`, id, RoleOwner).Scan(&owners)
+	if err != nil {
+		return err
+	}
+	if owners == 0 {
+		return ErrLastOwner
+	}
+	return nil
+}
+
+// Invite creates an invitation and fills its Token, which is not stored
+// and has to be passed on to the invited person.
+func (r *Repo) Invite(ctx context.Context, inv *models.LedgerInvitation, userID int64) error {
+	if err := authorize(ctx, r.db, inv.LedgerID, userID, Manage); err != nil {
+		return err
+	}
+
+	token, hash, err := newToken()
+	if err != nil {
+		return err
+	}
+
+	inv.Email = strings.TrimSpace(inv.Email)
+	inv.InvitedBy = &userID
+	inv.ExpiresAt = time.Now().Add(InvitationTTL)
+
+	err = r.db.QueryRow(ctx, `
+		INSERT INTO ledger_invitations (ledger_id, email, role, token_hash, invited_by, expires_at, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6, NOW())
+		RETURNING id, created_at
+	`, inv.LedgerID, inv.Email, inv.Role, hash, userID, inv.ExpiresAt).Scan(&inv.ID, &inv.CreatedAt)
+	if err != nil {
+		return err
+	}
+
+	inv.Token = token
+	return nil
+}
+
+// Invitations returns the pending invitations of the ledger.
+func (r *Repo) Invitations(ctx context.Context, id, userID int64) ([]models.LedgerInvitation, error) {
+	if err := authorize(ctx, r.db, id, userID, Manage); err != nil {
+		return nil, err
+	}
+
+	rows, err := r.db.Query(ctx, `
+		SELECT id, ledger_id, email, role, invited_by, expires_at, accepted_at, created_at
+		FROM ledger_invitations
+		WHERE ledger_id = $1 AND accepted_at IS NULL AND expires_at > NOW()
+		ORDER BY created_at, id
+	`, id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	invitations := []models.LedgerInvitation{}
+	for rows.Next() {
+		var inv models.LedgerInvitation
+		err := rows.Scan(&inv.ID, &inv.LedgerID, &inv.Email, &inv.Role, &inv.InvitedBy,
+			&inv.ExpiresAt, &inv.AcceptedAt, &inv.CreatedAt)
+		if err != nil {
+			return nil, err
+		}
+		invitations = append(invitations, inv)
+	}
+
+	return invitations, rows.Err()
+}
+
+// RevokeInvitation deletes a pending invitation.
+func (r *Repo) RevokeInvitation(ctx context.Context, id, invitationID, userID int64) error {
+	if err := authorize(ctx, r.db, id, userID, Manage); err != nil {
+		return err
+	}
+
+	result, err := r.db.Exec(ctx, `
+		DELETE FROM ledger_invitations
+		WHERE id = $1 AND ledger_id = $2 AND accepted_at IS NULL
+	`, invitationID, id)
+	if err != nil {
+		return err
+	}
+	if result.RowsAffected() == 0 {
+		return sql.ErrNoRows
+	}
+
+	return nil
+}
+
+// Accept adds the user to the ledger of the invitation. The invitation
+// must have been sent to the email of the user and can be used once.
+func (r *Repo) Accept(ctx context.Context, token string, userID int64) (*models.Ledger, error) {
+	tx, err := r.db.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback(ctx)
+
+	var invitationID, ledgerID int64
+	var invitedRole string
+	err = tx.QueryRow(ctx, `
+		SELECT i.id, i.ledger_id, i.role
+		FROM ledger_invitations i
+		JOIN users u ON u.id = $2 AND lower(u.email) = lower(i.email)
+		WHERE i.token_hash = $1 AND i.accepted_at IS NULL AND i.expires_at > NOW()
+		FOR UPDATE OF i
+	`, hashToken(token), userID).Scan(&invitationID, &ledgerID, &invitedRole)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrInvitationInvalid
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	result, err := tx.Exec(ctx, `
+		INSERT INTO ledger_members (ledger_id, user_id, role, created_at)
+		VALUES ($1, $2, $3, NOW())
+		ON CONFLICT (ledger_id, user_id) DO NOTHING
+	`, ledgerID, userID, invitedRole)
+	if err != nil {
+		return nil, err
+	}
+	if result.RowsAffected() == 0 {
+		return nil, ErrAlreadyMember
+	}
+
+	_, err = tx.Exec(ctx, `UPDATE ledger_invitations SET accepted_at = NOW() WHERE id = $1`, invitationID)
+	if err != nil {
+		return nil, err
+	}
+
+	l, err := getByID(ctx, tx, ledgerID, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return nil, err
+	}
+
+	return l, nil
+}
+
+// newToken returns an opaque invitation token and the hash stored instead
+// of it.
+func newToken() (string, string, error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", "", err
+	}
+
+	token := base64.RawURLEncoding.EncodeToString(buf)
+	return token, hashToken(token), nil
+}
+
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
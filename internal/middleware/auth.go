@@ -1,38 +1,54 @@
 package middleware
 
 import (
-	"net/http"
+	"search-job/internal/audit"
+	"search-job/internal/pkg/apperr"
 	"search-job/internal/pkg/jwt"
+	"search-job/internal/session"
 	"strings"
 
 	"github.com/labstack/echo/v4"
 )
 
-func AuthMiddleware(next echo.HandlerFunc) echo.HandlerFunc {
-	return func(c echo.Context) error {
-		authHeader := c.Request().Header.Get("Authorization")
-		if authHeader == "" {
-			return c.JSON(http.StatusUnauthorized, map[string]string{
-				"error": "missing authorization header",
-			})
-		}
+func AuthMiddleware(keys *jwt.KeyManager, sessions *session.Repo) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			authHeader := c.Request().Header.Get("Authorization")
+			if authHeader == "" {
+				return apperr.Unauthorized("missing_authorization", "missing authorization header")
+			}
 
-		parts := strings.Split(authHeader, " ")
-		if len(parts) != 2 || parts[0] != "Bearer" {
-			return c.JSON(http.StatusUnauthorized, map[string]string{
-				"error": "invalid authorization header format",
-			})
-		}
+			parts := strings.Split(authHeader, " ")
+			if len(parts) != 2 || parts[0] != "Bearer" {
+				return apperr.Unauthorized("invalid_authorization", "invalid authorization header format")
+			}
 
-		claims, err := jwt.ParseToken(parts[1])
-		if err != nil {
-			return c.JSON(http.StatusUnauthorized, map[string]string{
-				"error": "invalid or expired token",
-			})
-		}
+			claims, err := keys.ParseToken(parts[1])
+			if err != nil {
+				return apperr.Unauthorized("invalid_token", "invalid or expired token")
+			}
+
+			active, err := sessions.IsActive(c.Request().Context(), claims.SessionID)
+			if err != nil {
+				return err
+			}
+			if !active {
+				return apperr.Unauthorized("session_revoked", "session has been revoked")
+			}
 
-		c.Set("user_id", claims.UserID)
-		return next(c)
+			c.Set("user_id", claims.UserID)
+
+			// repositories read the actor from the context to record who
+			// made a change
+			req := c.Request()
+			c.SetRequest(req.WithContext(audit.WithActor(req.Context(), audit.Actor{
+				UserID:    claims.UserID,
+				RequestID: c.Response().Header().Get(echo.HeaderXRequestID),
+				IP:        c.RealIP(),
+			})))
+
+			return next(c)
+		}
 	}
 }
 
@@ -0,0 +1,101 @@
+package middleware
+
+import (
+	"errors"
+	"net/http"
+	"search-job/internal/pkg/apperr"
+	"strings"
+
+	"github.com/labstack/echo/v4"
+	"github.com/labstack/gommon/log"
+)
+
+const MIMEProblemJSON = "application/problem+json"
+
+// Problem is an RFC 7807 error body. Code is the stable apperr code and
+// Errors lists what is wrong with each field of a request.
+type Problem struct {
+	Type      string              `json:"type"`
+	Title     string              `json:"title"`
+	Status    int                 `json:"status"`
+	Detail    string              `json:"detail,omitempty"`
+	Instance  string              `json:"instance,omitempty"`
+	Code      string              `json:"code"`
+	RequestID string              `json:"request_id,omitempty"`
+	Errors    []apperr.FieldError `json:"errors,omitempty"`
+}
+
+// ErrorHandler writes every error returned by handlers and middleware as a
+// problem. Internal errors are logged and their details left out of the
+// response.
+func ErrorHandler(logger *log.Logger) echo.HTTPErrorHandler {
+	return func(err error, c echo.Context) {
+		if c.Response().Committed {
+			return
+		}
+
+		problem := newProblem(err)
+		if problem.Status == http.StatusInternalServerError {
+			logger.Errorf("%s %s: %v", c.Request().Method, c.Request().URL.Path, err)
+		}
+		problem.Instance = c.Request().URL.Path
+		problem.RequestID = c.Response().Header().Get(echo.HeaderXRequestID)
+
+		if c.Request().Method == http.MethodHead {
+			err = c.NoContent(problem.Status)
+		} else {
+			c.Response().Header().Set(echo.HeaderContentType, MIMEProblemJSON)
+			err = c.JSON(problem.Status, problem)
+		}
+		if err != nil {
+			logger.Error(err)
+		}
+	}
+}
+
+func newProblem(err error) Problem {
+	// errors of echo itself, such as an unknown route or a body that is too
+	// large, keep their status
+	var he *echo.HTTPError
+	if errors.As(err, &he) {
+		detail := http.StatusText(he.Code)
+		if m, ok := he.Message.(string); ok {
+			detail = m
+		}
+		return Problem{
+			Type:   "about:blank",
+			Title:  http.StatusText(he.Code),
+			Status: he.Code,
+			Detail: detail,
+			Code:   strings.ToLower(strings.ReplaceAll(http.StatusText(he.Code), " ", "_")),
+		}
+	}
+
+	e := apperr.From(err)
+	status := statusOf(e.Kind)
+	return Problem{
+		Type:   "about:blank",
+		Title:  http.StatusText(status),
+		Status: status,
+		Detail: e.Message,
+		Code:   e.Code,
+		Errors: e.Fields,
+	}
+}
+
+func statusOf(kind apperr.Kind) int {
+	switch kind {
+	case apperr.KindNotFound:
+		return http.StatusNotFound
+	case apperr.KindConflict:
+		return http.StatusConflict
+	case apperr.KindValidation:
+		return http.StatusUnprocessableEntity
+	case apperr.KindUnauthorized:
+		return http.StatusUnauthorized
+	case apperr.KindForbidden:
+		return http.StatusForbidden
+	default:
+		return http.StatusInternalServerError
+	}
+}
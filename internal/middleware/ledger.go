@@ -0,0 +1,69 @@
+package middleware
+
+import (
+	"database/sql"
+	"errors"
+	"search-job/internal/ledger"
+	"search-job/internal/pkg/apperr"
+	"strconv"
+
+	"github.com/labstack/echo/v4"
+)
+
+const HeaderLedgerID = "X-Ledger-ID"
+
+// LedgerMiddleware selects the ledger a request works on: the one given in
+// the X-Ledger-ID header or the ledger_id query parameter, or else the
+// ledger the user joined first. It must run after AuthMiddleware.
+func LedgerMiddleware(ledgers *ledger.Repo) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			userID := GetUserID(c)
+			ctx := c.Request().Context()
+
+			value := c.Request().Header.Get(HeaderLedgerID)
+			if value == "" {
+				value = c.QueryParam("ledger_id")
+			}
+
+			if value == "" {
+				id, err := ledgers.Default(ctx, userID)
+				if errors.Is(err, sql.ErrNoRows) {
+					// a user who left every ledger can still create a new one
+					return next(c)
+				}
+				if err != nil {
+					return err
+				}
+				c.Set("ledger_id", id)
+				return next(c)
+			}
+
+			id, err := strconv.ParseInt(value, 10, 64)
+			if err != nil || id <= 0 {
+				return apperr.Validation("invalid_ledger_id", "invalid ledger id")
+			}
+
+			_, err = ledgers.Role(ctx, id, userID)
+			if errors.Is(err, sql.ErrNoRows) {
+				return ledger.ErrNotMember
+			}
+			if err != nil {
+				return err
+			}
+
+			c.Set("ledger_id", id)
+			return next(c)
+		}
+	}
+}
+
+// GetLedgerID returns the ledger selected by LedgerMiddleware, or 0 when
+// the user has none.
+func GetLedgerID(c echo.Context) int64 {
+	ledgerID, ok := c.Get("ledger_id").(int64)
+	if !ok {
+		return 0
+	}
+	return ledgerID
+}
@@ -0,0 +1,40 @@
+package models
+
+import (
+	"search-job/internal/pkg/money"
+	"time"
+)
+
+// Account is a card, a wallet or any other place money is paid from. Its
+// currency is that of OpeningBalance.
+type Account struct {
+	ID             int64       `json:"id" db:"id"`
+	LedgerID       int64       `json:"ledger_id" db:"ledger_id"`
+	UserID         int64       `json:"user_id" db:"user_id"`
+	Name           string      `json:"name" db:"name"`
+	Type           string      `json:"type" db:"type"`
+	OpeningBalance money.Money `json:"opening_balance" db:"opening_balance"`
+	ArchivedAt     *time.Time  `json:"archived_at,omitempty" db:"archived_at"`
+	CreatedAt      time.Time   `json:"created_at" db:"created_at"`
+	UpdatedAt      time.Time   `json:"updated_at" db:"updated_at"`
+
+	// Balance is the opening balance moved by all transactions and
+	// transfers of the account up to BalanceAt.
+	Balance   *money.Money `json:"balance,omitempty" db:"-"`
+	BalanceAt *time.Time   `json:"balance_at,omitempty" db:"-"`
+}
+
+// AccountTransfer moves money between two accounts of a ledger. ToAmount
+// is what arrives in the currency of the receiving account.
+type AccountTransfer struct {
+	ID            int64       `json:"id" db:"id"`
+	LedgerID      int64       `json:"ledger_id" db:"ledger_id"`
+	UserID        int64       `json:"user_id" db:"user_id"`
+	FromAccountID int64       `json:"from_account_id" db:"from_account_id"`
+	ToAccountID   int64       `json:"to_account_id" db:"to_account_id"`
+	Amount        money.Money `json:"amount" db:"amount"`
+	ToAmount      money.Money `json:"to_amount" db:"to_amount"`
+	OccurredAt    time.Time   `json:"occurred_at" db:"occurred_at"`
+	Comment       *string     `json:"comment,omitempty" db:"comment"`
+	CreatedAt     time.Time   `json:"created_at" db:"created_at"`
+}
@@ -0,0 +1,14 @@
+package models
+
+import "time"
+
+type Attachment struct {
+	ID          int64     `json:"id" db:"id"`
+	UserID      int64     `json:"user_id" db:"user_id"`
+	ExpenseID   int64     `json:"expense_id" db:"expense_id"`
+	StorageKey  string    `json:"-" db:"storage_key"`
+	Filename    string    `json:"filename" db:"filename"`
+	ContentType string    `json:"content_type" db:"content_type"`
+	Size        int64     `json:"size" db:"size"`
+	CreatedAt   time.Time `json:"created_at" db:"created_at"`
+}
@@ -0,0 +1,27 @@
+package models
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// AuditEvent is a recorded change of an expense or category. Before and
+// After are snapshots of the entity; Changes maps every field that differs
+// between them to its old and new value.
+type AuditEvent struct {
+	ID         int64           `json:"id" db:"id"`
+	LedgerID   *int64          `json:"ledger_id,omitempty" db:"ledger_id"`
+	UserID     int64           `json:"user_id" db:"user_id"`
+	ActorID    *int64          `json:"actor_id,omitempty" db:"actor_id"`
+	EntityType string          `json:"entity_type" db:"entity_type"`
+	EntityID   int64           `json:"entity_id" db:"entity_id"`
+	Action     string          `json:"action" db:"action"`
+	Before     json.RawMessage `json:"before,omitempty" db:"before"`
+	After      json.RawMessage `json:"after,omitempty" db:"after"`
+	Changes    json.RawMessage `json:"changes,omitempty" db:"changes"`
+	// RequestID and IP are empty in events of other members unless the
+	// reader owns the ledger.
+	RequestID *string   `json:"request_id,omitempty" db:"request_id"`
+	IP        *string   `json:"ip,omitempty" db:"ip"`
+	CreatedAt time.Time `json:"created_at" db:"created_at"`
+}
@@ -0,0 +1,33 @@
+package models
+
+import (
+	"search-job/internal/pkg/money"
+	"time"
+)
+
+type Budget struct {
+	ID         int64       `json:"id" db:"id"`
+	LedgerID   int64       `json:"ledger_id" db:"ledger_id"`
+	UserID     int64       `json:"user_id" db:"user_id"`
+	CategoryID *int64      `json:"category_id,omitempty" db:"category_id"`
+	Amount     money.Money `json:"amount" db:"amount"`
+	Period     string      `json:"period" db:"period"`
+	Rollover   bool        `json:"rollover" db:"rollover"`
+	CreatedAt  time.Time   `json:"created_at" db:"created_at"`
+	UpdatedAt  time.Time   `json:"updated_at" db:"updated_at"`
+}
+
+type BudgetStatus struct {
+	Budget      Budget      `json:"budget"`
+	PeriodStart time.Time   `json:"period_start"`
+	PeriodEnd   time.Time   `json:"period_end"`
+	CarriedOver money.Money `json:"carried_over"`
+	Limit       money.Money `json:"limit"`
+	Spent       money.Money `json:"spent"`
+	Remaining   money.Money `json:"remaining"`
+	Percent     float64     `json:"percent"`
+	Overspent   bool        `json:"overspent"`
+	// Unconverted counts expenses left out of Spent because no exchange
+	// rate into the budget currency was available.
+	Unconverted int `json:"unconverted"`
+}
@@ -1,24 +1,89 @@
 package models
 
-import "time"
+import (
+	"search-job/internal/pkg/money"
+	"time"
+)
 
+// Kinds of transactions and of the categories they are filed under.
+const (
+	KindExpense = "expense"
+	KindIncome  = "income"
+)
+
+// Expense is a transaction of the kind KindExpense or KindIncome.
 type Expense struct {
-	ID         int64     `json:"id" db:"id"`
-	UserID     int64     `json:"user_id" db:"user_id"`
-	CategoryID *int64    `json:"category_id,omitempty" db:"category_id"`
-	Amount     float64   `json:"amount" db:"amount"`
-	Currency   string    `json:"currency" db:"currency"`
-	OccurredAt time.Time `json:"occurred_at" db:"occurred_at"`
-	Comment    *string   `json:"comment,omitempty" db:"comment"`
-	CreatedAt  time.Time `json:"created_at" db:"created_at"`
-	UpdatedAt  time.Time `json:"updated_at" db:"updated_at"`
+	ID         int64  `json:"id" db:"id"`
+	LedgerID   int64  `json:"ledger_id" db:"ledger_id"`
+	UserID     int64  `json:"user_id" db:"user_id"`
+	Kind       string `json:"kind" db:"kind"`
+	CategoryID *int64 `json:"category_id,omitempty" db:"category_id"`
+	// CategoryName is empty when the category has been deleted.
+	CategoryName *string     `json:"category_name,omitempty" db:"category_name"`
+	AccountID    *int64      `json:"account_id,omitempty" db:"account_id"`
+	Amount       money.Money `json:"amount" db:"amount"`
+	OccurredAt   time.Time   `json:"occurred_at" db:"occurred_at"`
+	// Merchant is who was paid, or who paid an income.
+	Merchant    *string   `json:"merchant,omitempty" db:"merchant"`
+	Comment     *string   `json:"comment,omitempty" db:"comment"`
+	RecurringID *int64    `json:"recurring_id,omitempty" db:"recurring_id"`
+	CreatedAt   time.Time `json:"created_at" db:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at" db:"updated_at"`
+	Tags        []string  `json:"tags" db:"-"`
+	// Allocations divide the expense between several categories, in which
+	// case CategoryID is empty.
+	Allocations []Allocation `json:"allocations,omitempty" db:"-"`
+	// Participants share the expense paid by its author. They are only
+	// loaded for a single expense.
+	Participants []Participant `json:"participants,omitempty" db:"-"`
+
+	AmountInBase *money.Money `json:"amount_in_base,omitempty" db:"-"`
+	// Search tells how an expense found by a text search matched.
+	Search *SearchMatch `json:"search,omitempty" db:"-"`
+}
+
+// SearchMatch is the rank of an expense found by a text search, higher for
+// better matches, and the fragments of its fields with the matched words
+// highlighted in HTML mark elements. Fields without such words are empty.
+type SearchMatch struct {
+	Rank         float64 `json:"rank"`
+	Merchant     *string `json:"merchant,omitempty"`
+	Comment      *string `json:"comment,omitempty"`
+	CategoryName *string `json:"category_name,omitempty"`
+}
+
+// Allocation is the part of an expense that belongs to one category.
+type Allocation struct {
+	CategoryID *int64 `json:"category_id,omitempty" db:"category_id"`
+	// CategoryName is empty when the category has been deleted.
+	CategoryName *string     `json:"category_name,omitempty" db:"category_name"`
+	Amount       money.Money `json:"amount" db:"amount"`
+	Comment      *string     `json:"comment,omitempty" db:"comment"`
+}
+
+type Tag struct {
+	ID        int64     `json:"id" db:"id"`
+	LedgerID  int64     `json:"ledger_id" db:"ledger_id"`
+	UserID    int64     `json:"user_id" db:"user_id"`
+	Name      string    `json:"name" db:"name"`
+	Expenses  int       `json:"expenses" db:"-"`
+	CreatedAt time.Time `json:"created_at" db:"created_at"`
+	UpdatedAt time.Time `json:"updated_at" db:"updated_at"`
 }
 
 type Category struct {
 	ID        int64      `json:"id" db:"id"`
+	LedgerID  int64      `json:"ledger_id" db:"ledger_id"`
 	UserID    int64      `json:"user_id" db:"user_id"`
+	ParentID  *int64     `json:"parent_id,omitempty" db:"parent_id"`
+	Kind      string     `json:"kind" db:"kind"`
 	Name      string     `json:"name" db:"name"`
 	CreatedAt time.Time  `json:"created_at" db:"created_at"`
 	UpdatedAt time.Time  `json:"updated_at" db:"updated_at"`
 	DeletedAt *time.Time `json:"deleted_at,omitempty" db:"deleted_at"`
+
+	// Children and Total are only filled in the tree view. Total includes
+	// the expenses of all descendants.
+	Children []Category   `json:"children,omitempty" db:"-"`
+	Total    *money.Money `json:"total,omitempty" db:"-"`
 }
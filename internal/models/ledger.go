@@ -0,0 +1,37 @@
+package models
+
+import "time"
+
+// Ledger is a shared book of categories and expenses. Role is the role of
+// the user the ledger was loaded for.
+type Ledger struct {
+	ID        int64     `json:"id" db:"id"`
+	Name      string    `json:"name" db:"name"`
+	CreatedBy *int64    `json:"created_by,omitempty" db:"created_by"`
+	Role      string    `json:"role" db:"role"`
+	CreatedAt time.Time `json:"created_at" db:"created_at"`
+	UpdatedAt time.Time `json:"updated_at" db:"updated_at"`
+}
+
+type LedgerMember struct {
+	LedgerID  int64     `json:"ledger_id" db:"ledger_id"`
+	UserID    int64     `json:"user_id" db:"user_id"`
+	Email     string    `json:"email" db:"email"`
+	Role      string    `json:"role" db:"role"`
+	CreatedAt time.Time `json:"created_at" db:"created_at"`
+}
+
+// LedgerInvitation lets the holder of the token join a ledger. Token is
+// only known right after the invitation is created; the database keeps a
+// hash of it.
+type LedgerInvitation struct {
+	ID         int64      `json:"id" db:"id"`
+	LedgerID   int64      `json:"ledger_id" db:"ledger_id"`
+	Email      string     `json:"email" db:"email"`
+	Role       string     `json:"role" db:"role"`
+	Token      string     `json:"token,omitempty" db:"-"`
+	InvitedBy  *int64     `json:"invited_by,omitempty" db:"invited_by"`
+	ExpiresAt  time.Time  `json:"expires_at" db:"expires_at"`
+	AcceptedAt *time.Time `json:"accepted_at,omitempty" db:"accepted_at"`
+	CreatedAt  time.Time  `json:"created_at" db:"created_at"`
+}
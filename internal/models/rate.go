@@ -0,0 +1,14 @@
+package models
+
+import (
+	"time"
+
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+// ExchangeRate is the number of Currency units per one EUR on Date.
+type ExchangeRate struct {
+	Date     time.Time      `json:"date" db:"rate_date"`
+	Currency string         `json:"currency" db:"currency"`
+	Rate     pgtype.Numeric `json:"rate" db:"rate"`
+}
@@ -0,0 +1,23 @@
+package models
+
+import (
+	"search-job/internal/pkg/money"
+	"time"
+)
+
+type RecurringExpense struct {
+	ID               int64       `json:"id" db:"id"`
+	LedgerID         int64       `json:"ledger_id" db:"ledger_id"`
+	UserID           int64       `json:"user_id" db:"user_id"`
+	Kind             string      `json:"kind" db:"kind"`
+	CategoryID       *int64      `json:"category_id,omitempty" db:"category_id"`
+	Amount           money.Money `json:"amount" db:"amount"`
+	Comment          *string     `json:"comment,omitempty" db:"comment"`
+	RRule            string      `json:"rrule" db:"rrule"`
+	StartAt          time.Time   `json:"start_at" db:"start_at"`
+	Paused           bool        `json:"paused" db:"paused"`
+	NextIndex        int         `json:"-" db:"next_index"`
+	NextOccurrenceAt *time.Time  `json:"next_occurrence_at,omitempty" db:"next_occurrence_at"`
+	CreatedAt        time.Time   `json:"created_at" db:"created_at"`
+	UpdatedAt        time.Time   `json:"updated_at" db:"updated_at"`
+}
@@ -0,0 +1,40 @@
+package models
+
+import (
+	"search-job/internal/pkg/money"
+	"time"
+)
+
+type SummaryRow struct {
+	CategoryID   *int64      `json:"category_id,omitempty"`
+	CategoryName *string     `json:"category_name,omitempty"`
+	Period       *time.Time  `json:"period,omitempty"`
+	Currency     string      `json:"currency"`
+	Total        money.Money `json:"total"`
+	Count        int         `json:"count"`
+	Average      money.Money `json:"average"`
+	// Unconverted counts expenses left out of Total because no exchange
+	// rate into the requested currency was available.
+	Unconverted int                `json:"unconverted,omitempty"`
+	Previous    *SummaryComparison `json:"previous,omitempty"`
+}
+
+type SummaryComparison struct {
+	Total         money.Money `json:"total"`
+	Count         int         `json:"count"`
+	ChangePercent *float64    `json:"change_percent,omitempty"`
+}
+
+// CashFlowRow compares income with spending over one period. SavingsRate is
+// the share of income left after spending, in percent.
+type CashFlowRow struct {
+	Period      time.Time   `json:"period"`
+	Currency    string      `json:"currency"`
+	Income      money.Money `json:"income"`
+	Expenses    money.Money `json:"expenses"`
+	Net         money.Money `json:"net"`
+	SavingsRate *float64    `json:"savings_rate,omitempty"`
+	// Unconverted counts transactions left out because no exchange rate
+	// into the requested currency was available.
+	Unconverted int `json:"unconverted,omitempty"`
+}
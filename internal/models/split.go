@@ -0,0 +1,39 @@
+package models
+
+import (
+	"search-job/internal/pkg/money"
+	"time"
+)
+
+// Participant owes Share of a shared expense to its author.
+type Participant struct {
+	UserID int64       `json:"user_id" db:"user_id"`
+	Share  money.Money `json:"share" db:"share"`
+}
+
+// Settlement records that FromUserID paid Amount back to ToUserID.
+type Settlement struct {
+	ID         int64       `json:"id" db:"id"`
+	LedgerID   int64       `json:"ledger_id" db:"ledger_id"`
+	FromUserID int64       `json:"from_user_id" db:"from_user_id"`
+	ToUserID   int64       `json:"to_user_id" db:"to_user_id"`
+	Amount     money.Money `json:"amount" db:"amount"`
+	SettledAt  time.Time   `json:"settled_at" db:"settled_at"`
+	Comment    *string     `json:"comment,omitempty" db:"comment"`
+	CreatedBy  *int64      `json:"created_by,omitempty" db:"created_by"`
+	CreatedAt  time.Time   `json:"created_at" db:"created_at"`
+}
+
+// Balance is what a member of a ledger is owed in one currency; a negative
+// amount is what the member owes.
+type Balance struct {
+	UserID int64       `json:"user_id"`
+	Amount money.Money `json:"amount"`
+}
+
+// Transfer is a payment that settles debts between two members.
+type Transfer struct {
+	FromUserID int64       `json:"from_user_id"`
+	ToUserID   int64       `json:"to_user_id"`
+	Amount     money.Money `json:"amount"`
+}
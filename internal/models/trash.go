@@ -0,0 +1,18 @@
+package models
+
+import (
+	"search-job/internal/pkg/money"
+	"time"
+)
+
+// TrashItem is a deleted expense or category. Name holds the category name
+// or the comment of the expense.
+type TrashItem struct {
+	Type      string       `json:"type"`
+	ID        int64        `json:"id"`
+	Name      *string      `json:"name,omitempty"`
+	Amount    *money.Money `json:"amount,omitempty"`
+	DeletedAt time.Time    `json:"deleted_at"`
+	// PurgeAt is when the item is deleted for good, if retention is on.
+	PurgeAt *time.Time `json:"purge_at,omitempty"`
+}
@@ -6,6 +6,8 @@ type User struct {
 	ID           int64     `json:"id" db:"id"`
 	Email        string    `json:"email" db:"email"`
 	PasswordHash string    `json:"-" db:"password_hash"`
+	BaseCurrency string    `json:"base_currency" db:"base_currency"`
+	Timezone     string    `json:"timezone" db:"timezone"`
 	CreatedAt    time.Time `json:"created_at" db:"created_at"`
 	UpdatedAt    time.Time `json:"updated_at" db:"updated_at"`
 }
@@ -0,0 +1,149 @@
+// Package apperr describes failures by what they mean to the client, so that
+// handlers can return them as they are and a single error handler turns
+// them into responses.
+package apperr
+
+import (
+	"database/sql"
+	"errors"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+type Kind int
+
+const (
+	KindInternal Kind = iota
+	KindNotFound
+	KindConflict
+	KindValidation
+	KindUnauthorized
+	KindForbidden
+)
+
+func (k Kind) String() string {
+	switch k {
+	case KindNotFound:
+		return "not_found"
+	case KindConflict:
+		return "conflict"
+	case KindValidation:
+		return "validation"
+	case KindUnauthorized:
+		return "unauthorized"
+	case KindForbidden:
+		return "forbidden"
+	default:
+		return "internal"
+	}
+}
+
+// FieldError points at the part of a request that is wrong.
+type FieldError struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+// Error is a failure of a known kind. Code never changes once published, so
+// clients may match on it; Message is meant for people. Err is the cause,
+// which is logged but never shown to clients.
+type Error struct {
+	Kind    Kind
+	Code    string
+	Message string
+	Fields  []FieldError
+	Err     error
+}
+
+func (e *Error) Error() string {
+	if e.Err != nil {
+		return e.Message + ": " + e.Err.Error()
+	}
+	return e.Message
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// Is matches errors by code, so that a copy made by At is still the error
+// it was made from.
+func (e *Error) Is(target error) bool {
+	t, ok := target.(*Error)
+	return ok && t.Code != "" && t.Code == e.Code
+}
+
+// At returns a copy of the error that points at a field of the request,
+// for checks that know the field only where they are called from.
+func (e *Error) At(field string) *Error {
+	c := *e
+	c.Fields = []FieldError{{Field: field, Message: e.Message}}
+	return &c
+}
+
+func NotFound(code, message string) *Error {
+	return &Error{Kind: KindNotFound, Code: code, Message: message}
+}
+
+func Conflict(code, message string) *Error {
+	return &Error{Kind: KindConflict, Code: code, Message: message}
+}
+
+func Validation(code, message string, fields ...FieldError) *Error {
+	return &Error{Kind: KindValidation, Code: code, Message: message, Fields: fields}
+}
+
+func Unauthorized(code, message string) *Error {
+	return &Error{Kind: KindUnauthorized, Code: code, Message: message}
+}
+
+func Forbidden(code, message string) *Error {
+	return &Error{Kind: KindForbidden, Code: code, Message: message}
+}
+
+// Internal hides err from the client behind a generic message.
+func Internal(err error) *Error {
+	return &Error{Kind: KindInternal, Code: "internal", Message: "internal error", Err: err}
+}
+
+var (
+	ErrUnauthorized  = Unauthorized("unauthorized", "unauthorized")
+	ErrInvalidParams = Validation("invalid_params", "invalid params")
+	ErrNotFound      = NotFound("not_found", "not found")
+	ErrConflict      = Conflict("conflict", "already exists")
+	// ErrInvalidReference is a reference to a row that does not exist,
+	// such as an unknown category id.
+	ErrInvalidReference = Validation("invalid_reference", "referenced object does not exist")
+)
+
+// From classifies any error. Errors of this package are returned with the
+// details added by wrapping them, a missing row is NotFound and unique and
+// foreign key violations that escaped the repositories are Conflict and
+// Validation. Everything else is Internal.
+func From(err error) *Error {
+	var e *Error
+	if errors.As(err, &e) {
+		if err != error(e) && e.Kind != KindInternal {
+			wrapped := *e
+			wrapped.Message = err.Error()
+			return &wrapped
+		}
+		return e
+	}
+	if errors.Is(err, sql.ErrNoRows) || errors.Is(err, pgx.ErrNoRows) {
+		return ErrNotFound
+	}
+
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) {
+		switch pgErr.Code {
+		case "23505":
+			return ErrConflict
+		case "23503":
+			return ErrInvalidReference
+		}
+	}
+
+	return Internal(err)
+}
@@ -7,30 +7,46 @@ import (
 	"github.com/golang-jwt/jwt/v5"
 )
 
-var secretKey = []byte("your-secret-key-change-this-in-production")
+const AccessTokenTTL = 15 * time.Minute
 
 type Claims struct {
-	UserID int64 `json:"user_id"`
+	UserID    int64  `json:"user_id"`
+	SessionID string `json:"sid"`
 	jwt.RegisteredClaims
 }
 
-func GenerateToken(userID int64) (string, error) {
+func (m *KeyManager) GenerateToken(userID int64, sessionID string) (string, error) {
+	key := m.signingKey(time.Now())
+	if key == nil {
+		return "", errors.New("no active signing key")
+	}
+
 	claims := Claims{
 		userID,
+		sessionID,
 		jwt.RegisteredClaims{
-			ExpiresAt: jwt.NewNumericDate(time.Now().Add(24 * time.Hour)),
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(AccessTokenTTL)),
 			IssuedAt:  jwt.NewNumericDate(time.Now()),
 		},
 	}
 
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	return token.SignedString(secretKey)
+	token := jwt.NewWithClaims(key.method, claims)
+	token.Header["kid"] = key.kid
+	return token.SignedString(key.private)
 }
 
-func ParseToken(tokenString string) (*Claims, error) {
+func (m *KeyManager) ParseToken(tokenString string) (*Claims, error) {
 	token, err := jwt.ParseWithClaims(tokenString, &Claims{}, func(token *jwt.Token) (interface{}, error) {
-		return secretKey, nil
-	})
+		kid, _ := token.Header["kid"].(string)
+		key := m.verificationKey(kid, time.Now())
+		if key == nil {
+			return nil, errors.New("unknown signing key")
+		}
+		if token.Method.Alg() != key.method.Alg() {
+			return nil, errors.New("unexpected signing method")
+		}
+		return key.public, nil
+	}, jwt.WithValidMethods(supportedAlgorithms))
 
 	if err != nil {
 		return nil, err
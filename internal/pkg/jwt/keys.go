@@ -0,0 +1,238 @@
+package jwt
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+	"sort"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const (
+	AlgRS256 = "RS256"
+	AlgEdDSA = "EdDSA"
+)
+
+var supportedAlgorithms = []string{AlgRS256, AlgEdDSA}
+
+type KeyConfig struct {
+	KID            string
+	Algorithm      string
+	PrivateKeyPath string
+	// ActiveFrom is the moment the key starts signing tokens. Keys with a
+	// future ActiveFrom are already published in the JWKS so that verifiers
+	// pick them up before the rotation happens.
+	ActiveFrom time.Time
+}
+
+type KeyManagerConfig struct {
+	Keys []KeyConfig
+	// GracePeriod is how long a key keeps verifying tokens after the next
+	// key took over signing. It should not be shorter than AccessTokenTTL.
+	GracePeriod time.Duration
+	// AllowEphemeral lets the manager generate an in-memory key when none
+	// is configured. Tokens signed with it do not survive a restart.
+	AllowEphemeral bool
+}
+
+type signingKey struct {
+	kid        string
+	method     jwt.SigningMethod
+	private    crypto.Signer
+	public     crypto.PublicKey
+	activeFrom time.Time
+}
+
+// KeyManager holds the keys used to sign and verify access tokens. The key
+// with the latest ActiveFrom that is not in the future signs new tokens,
+// earlier keys stay valid for verification during the grace period.
+type KeyManager struct {
+	keys  []*signingKey
+	grace time.Duration
+}
+
+func NewKeyManager(cfg *KeyManagerConfig) (*KeyManager, error) {
+	m := &KeyManager{grace: cfg.GracePeriod}
+	if m.grace < AccessTokenTTL {
+		m.grace = AccessTokenTTL
+	}
+
+	seen := make(map[string]bool)
+	for _, kc := range cfg.Keys {
+		if kc.KID == "" {
+			return nil, errors.New("jwt key without kid")
+		}
+		if seen[kc.KID] {
+			return nil, fmt.Errorf("duplicate jwt key kid %q", kc.KID)
+		}
+		seen[kc.KID] = true
+
+		key, err := loadKey(kc)
+		if err != nil {
+			return nil, fmt.Errorf("jwt key %q: %w", kc.KID, err)
+		}
+		m.keys = append(m.keys, key)
+	}
+
+	if len(m.keys) == 0 {
+		if !cfg.AllowEphemeral {
+			return nil, errors.New("no jwt signing keys configured")
+		}
+		key, err := ephemeralKey()
+		if err != nil {
+			return nil, err
+		}
+		m.keys = append(m.keys, key)
+	}
+
+	sort.Slice(m.keys, func(i, j int) bool {
+		return m.keys[i].activeFrom.Before(m.keys[j].activeFrom)
+	})
+
+	return m, nil
+}
+
+func (m *KeyManager) signingKey(now time.Time) *signingKey {
+	var current *signingKey
+	for _, key := range m.keys {
+		if key.activeFrom.After(now) {
+			break
+		}
+		current = key
+	}
+	return current
+}
+
+func (m *KeyManager) verificationKey(kid string, now time.Time) *signingKey {
+	for i, key := range m.keys {
+		if key.kid != kid {
+			continue
+		}
+		if key.activeFrom.After(now) {
+			return nil
+		}
+		if i+1 < len(m.keys) {
+			retiredAt := m.keys[i+1].activeFrom
+			if !retiredAt.After(now) && now.After(retiredAt.Add(m.grace)) {
+				return nil
+			}
+		}
+		return key
+	}
+	return nil
+}
+
+type JWK struct {
+	KID string `json:"kid"`
+	Kty string `json:"kty"`
+	Alg string `json:"alg"`
+	Use string `json:"use"`
+	Crv string `json:"crv,omitempty"`
+	X   string `json:"x,omitempty"`
+	N   string `json:"n,omitempty"`
+	E   string `json:"e,omitempty"`
+}
+
+type JWKS struct {
+	Keys []JWK `json:"keys"`
+}
+
+// JWKS returns the public keys that verify tokens now or will sign them
+// later. Keys whose grace period is over are left out.
+func (m *KeyManager) JWKS() JWKS {
+	now := time.Now()
+	set := JWKS{Keys: []JWK{}}
+
+	for i, key := range m.keys {
+		if i+1 < len(m.keys) && now.After(m.keys[i+1].activeFrom.Add(m.grace)) {
+			continue
+		}
+
+		jwk := JWK{KID: key.kid, Alg: key.method.Alg(), Use: "sig"}
+		switch pub := key.public.(type) {
+		case *rsa.PublicKey:
+			jwk.Kty = "RSA"
+			jwk.N = base64.RawURLEncoding.EncodeToString(pub.N.Bytes())
+			jwk.E = base64.RawURLEncoding.EncodeToString(big.NewInt(int64(pub.E)).Bytes())
+		case ed25519.PublicKey:
+			jwk.Kty = "OKP"
+			jwk.Crv = "Ed25519"
+			jwk.X = base64.RawURLEncoding.EncodeToString(pub)
+		}
+		set.Keys = append(set.Keys, jwk)
+	}
+
+	return set
+}
+
+func loadKey(kc KeyConfig) (*signingKey, error) {
+	data, err := os.ReadFile(kc.PrivateKeyPath)
+	if err != nil {
+		return nil, err
+	}
+
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, errors.New("no PEM block found")
+	}
+
+	var parsed any
+	switch block.Type {
+	case "RSA PRIVATE KEY":
+		parsed, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+	default:
+		parsed, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	key := &signingKey{kid: kc.KID, activeFrom: kc.ActiveFrom}
+
+	switch kc.Algorithm {
+	case AlgRS256:
+		private, ok := parsed.(*rsa.PrivateKey)
+		if !ok {
+			return nil, errors.New("RS256 requires an RSA private key")
+		}
+		key.method = jwt.SigningMethodRS256
+		key.private = private
+		key.public = &private.PublicKey
+	case AlgEdDSA:
+		private, ok := parsed.(ed25519.PrivateKey)
+		if !ok {
+			return nil, errors.New("EdDSA requires an Ed25519 private key")
+		}
+		key.method = jwt.SigningMethodEdDSA
+		key.private = private
+		key.public = private.Public()
+	default:
+		return nil, fmt.Errorf("unsupported algorithm %q", kc.Algorithm)
+	}
+
+	return key, nil
+}
+
+func ephemeralKey() (*signingKey, error) {
+	public, private, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+
+	return &signingKey{
+		kid:     "ephemeral",
+		method:  jwt.SigningMethodEdDSA,
+		private: private,
+		public:  public,
+	}, nil
+}
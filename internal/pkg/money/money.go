@@ -0,0 +1,283 @@
+package money
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"strings"
+
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+var (
+	ErrUnknownCurrency  = errors.New("unknown currency")
+	ErrInvalidAmount    = errors.New("invalid amount")
+	ErrInvalidScale     = errors.New("amount has more decimal places than the currency allows")
+	ErrCurrencyMismatch = errors.New("currency mismatch")
+	ErrOverflow         = errors.New("amount overflow")
+)
+
+// Money is an exact amount in the minor units of its currency, e.g.
+// {Amount: 1234, Currency: "USD"} is 12.34 USD.
+type Money struct {
+	Amount   int64
+	Currency string
+}
+
+func New(minor int64, currency string) (Money, error) {
+	if !IsValidCurrency(currency) {
+		return Money{}, ErrUnknownCurrency
+	}
+	return Money{Amount: minor, Currency: currency}, nil
+}
+
+// Parse reads a decimal string such as "-12.34" in the given currency. It
+// rejects more fractional digits than the currency has minor units.
+func Parse(amount, currency string) (Money, error) {
+	scale, err := Scale(currency)
+	if err != nil {
+		return Money{}, err
+	}
+
+	n, exp, err := parseDecimal(amount)
+	if err != nil {
+		return Money{}, err
+	}
+	if -exp > scale {
+		return Money{}, ErrInvalidScale
+	}
+
+	n.Mul(n, pow10(scale+exp))
+	if !n.IsInt64() {
+		return Money{}, ErrOverflow
+	}
+
+	return Money{Amount: n.Int64(), Currency: currency}, nil
+}
+
+// ParseNumeric reads a decimal string into an exact numeric without tying it
+// to a currency, e.g. for amount range filters.
+func ParseNumeric(amount string) (pgtype.Numeric, error) {
+	n, exp, err := parseDecimal(amount)
+	if err != nil {
+		return pgtype.Numeric{}, err
+	}
+	return pgtype.Numeric{Int: n, Exp: exp, Valid: true}, nil
+}
+
+// FromNumeric converts a numeric scanned from the database. The conversion
+// fails instead of rounding if the value does not fit the currency scale.
+func FromNumeric(n pgtype.Numeric, currency string) (Money, error) {
+	scale, err := Scale(currency)
+	if err != nil {
+		return Money{}, err
+	}
+	if !n.Valid || n.NaN || n.InfinityModifier != pgtype.Finite || n.Int == nil {
+		return Money{}, ErrInvalidAmount
+	}
+
+	v := new(big.Int).Set(n.Int)
+	shift := n.Exp + scale
+	if shift >= 0 {
+		v.Mul(v, pow10(shift))
+	} else {
+		var rem big.Int
+		v.QuoRem(v, pow10(-shift), &rem)
+		if rem.Sign() != 0 {
+			return Money{}, ErrInvalidScale
+		}
+	}
+	if !v.IsInt64() {
+		return Money{}, ErrOverflow
+	}
+
+	return Money{Amount: v.Int64(), Currency: currency}, nil
+}
+
+// Numeric returns the value for writing into a NUMERIC column.
+func (m Money) Numeric() pgtype.Numeric {
+	return pgtype.Numeric{Int: big.NewInt(m.Amount), Exp: -m.scale(), Valid: true}
+}
+
+// Decimal formats the amount without the currency, e.g. "-12.34".
+func (m Money) Decimal() string {
+	scale := int(m.scale())
+	digits := new(big.Int).Abs(big.NewInt(m.Amount)).String()
+
+	var b strings.Builder
+	if m.Amount < 0 {
+		b.WriteByte('-')
+	}
+	if scale == 0 {
+		b.WriteString(digits)
+		return b.String()
+	}
+	if len(digits) <= scale {
+		digits = strings.Repeat("0", scale-len(digits)+1) + digits
+	}
+	b.WriteString(digits[:len(digits)-scale])
+	b.WriteByte('.')
+	b.WriteString(digits[len(digits)-scale:])
+	return b.String()
+}
+
+func (m Money) String() string {
+	return m.Decimal() + " " + m.Currency
+}
+
+func (m Money) IsZero() bool {
+	return m.Amount == 0
+}
+
+func (m Money) IsNegative() bool {
+	return m.Amount < 0
+}
+
+func (m Money) Add(other Money) (Money, error) {
+	if m.Currency != other.Currency {
+		return Money{}, ErrCurrencyMismatch
+	}
+	sum := m.Amount + other.Amount
+	if (other.Amount > 0 && sum < m.Amount) || (other.Amount < 0 && sum > m.Amount) {
+		return Money{}, ErrOverflow
+	}
+	return Money{Amount: sum, Currency: m.Currency}, nil
+}
+
+func (m Money) Sub(other Money) (Money, error) {
+	return m.Add(other.Neg())
+}
+
+func (m Money) Neg() Money {
+	return Money{Amount: -m.Amount, Currency: m.Currency}
+}
+
+// Convert returns the amount in another currency, where rate is the number
+// of target currency units per one unit of m. The result is rounded half to
+// even to the minor units of the target currency.
+func (m Money) Convert(rate *big.Rat, to string) (Money, error) {
+	toScale, err := Scale(to)
+	if err != nil {
+		return Money{}, err
+	}
+
+	v := new(big.Rat).SetFrac(big.NewInt(m.Amount), pow10(m.scale()))
+	v.Mul(v, rate)
+	v.Mul(v, new(big.Rat).SetInt(pow10(toScale)))
+
+	minor := roundHalfEven(v)
+	if !minor.IsInt64() {
+		return Money{}, ErrOverflow
+	}
+
+	return Money{Amount: minor.Int64(), Currency: to}, nil
+}
+
+func (m Money) scale() int32 {
+	scale, err := Scale(m.Currency)
+	if err != nil {
+		return 2
+	}
+	return scale
+}
+
+type moneyJSON struct {
+	Value    Number `json:"value"`
+	Currency string `json:"currency"`
+}
+
+func (m Money) MarshalJSON() ([]byte, error) {
+	return json.Marshal(moneyJSON{Value: Number(m.Decimal()), Currency: m.Currency})
+}
+
+func (m *Money) UnmarshalJSON(data []byte) error {
+	var v moneyJSON
+	if err := json.Unmarshal(data, &v); err != nil {
+		return err
+	}
+
+	parsed, err := Parse(string(v.Value), v.Currency)
+	if err != nil {
+		return err
+	}
+	*m = parsed
+	return nil
+}
+
+// Number is a decimal taken verbatim from JSON so that it never passes
+// through float64. Both 12.34 and "12.34" are accepted; it is written as a
+// string to keep JavaScript clients from rounding it.
+type Number string
+
+func (n Number) MarshalJSON() ([]byte, error) {
+	return json.Marshal(string(n))
+}
+
+func (n *Number) UnmarshalJSON(data []byte) error {
+	data = bytes.TrimSpace(data)
+	if len(data) > 0 && data[0] == '"' {
+		var s string
+		if err := json.Unmarshal(data, &s); err != nil {
+			return err
+		}
+		*n = Number(s)
+		return nil
+	}
+
+	var num json.Number
+	if err := json.Unmarshal(data, &num); err != nil {
+		return ErrInvalidAmount
+	}
+	*n = Number(num)
+	return nil
+}
+
+// parseDecimal returns the digits of s as an integer together with the
+// base-10 exponent, so that the value is n * 10^exp.
+func parseDecimal(s string) (*big.Int, int32, error) {
+	s = strings.TrimSpace(s)
+	intPart, fracPart, hasPoint := strings.Cut(s, ".")
+
+	sign := ""
+	if strings.HasPrefix(intPart, "-") || strings.HasPrefix(intPart, "+") {
+		sign, intPart = intPart[:1], intPart[1:]
+	}
+	if intPart == "" && fracPart == "" || hasPoint && fracPart == "" {
+		return nil, 0, ErrInvalidAmount
+	}
+	for _, r := range intPart + fracPart {
+		if r < '0' || r > '9' {
+			return nil, 0, ErrInvalidAmount
+		}
+	}
+
+	n, ok := new(big.Int).SetString(sign+intPart+fracPart, 10)
+	if !ok {
+		return nil, 0, ErrInvalidAmount
+	}
+
+	return n, -int32(len(fracPart)), nil
+}
+
+func roundHalfEven(v *big.Rat) *big.Int {
+	q, r := new(big.Int).QuoRem(v.Num(), v.Denom(), new(big.Int))
+
+	// compare the remainder with half of the denominator
+	twice := new(big.Int).Abs(r)
+	twice.Lsh(twice, 1)
+	switch twice.Cmp(v.Denom()) {
+	case 1:
+		q.Add(q, big.NewInt(int64(v.Sign())))
+	case 0:
+		if q.Bit(0) == 1 {
+			q.Add(q, big.NewInt(int64(v.Sign())))
+		}
+	}
+
+	return q
+}
+
+func pow10(exp int32) *big.Int {
+	return new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(exp)), nil)
+}
@@ -0,0 +1,170 @@
+package money
+
+import (
+	"errors"
+	"math/big"
+	"testing"
+
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		amount   string
+		currency string
+		want     int64
+		wantErr  error
+	}{
+		{"12.34", "USD", 1234, nil},
+		{"-12.34", "USD", -1234, nil},
+		{"+0.5", "USD", 50, nil},
+		{"12", "USD", 1200, nil},
+		{".5", "EUR", 50, nil},
+		{" 7.1 ", "EUR", 710, nil},
+		{"0.00", "USD", 0, nil},
+		{"1000", "JPY", 1000, nil},
+		{"1.234", "BHD", 1234, nil},
+		{"1.2345", "CLF", 12345, nil},
+		{"12.345", "USD", 0, ErrInvalidScale},
+		{"12.5", "JPY", 0, ErrInvalidScale},
+		{"12.", "USD", 0, ErrInvalidAmount},
+		{"", "USD", 0, ErrInvalidAmount},
+		{"-", "USD", 0, ErrInvalidAmount},
+		{"1,5", "USD", 0, ErrInvalidAmount},
+		{"1e3", "USD", 0, ErrInvalidAmount},
+		{"92233720368547758.08", "USD", 0, ErrOverflow},
+		{"10", "XXX", 0, ErrUnknownCurrency},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.amount+" "+tt.currency, func(t *testing.T) {
+			got, err := Parse(tt.amount, tt.currency)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("error = %v, want %v", err, tt.wantErr)
+			}
+			if tt.wantErr == nil && got != (Money{Amount: tt.want, Currency: tt.currency}) {
+				t.Fatalf("Parse(%q, %q) = %+v, want %d minor units", tt.amount, tt.currency, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDecimal(t *testing.T) {
+	tests := []struct {
+		m    Money
+		want string
+	}{
+		{Money{Amount: 1234, Currency: "USD"}, "12.34"},
+		{Money{Amount: -1234, Currency: "USD"}, "-12.34"},
+		{Money{Amount: 5, Currency: "USD"}, "0.05"},
+		{Money{Amount: -5, Currency: "USD"}, "-0.05"},
+		{Money{Amount: 0, Currency: "EUR"}, "0.00"},
+		{Money{Amount: 1000, Currency: "JPY"}, "1000"},
+		{Money{Amount: 1, Currency: "KWD"}, "0.001"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.want+" "+tt.m.Currency, func(t *testing.T) {
+			if got := tt.m.Decimal(); got != tt.want {
+				t.Fatalf("Decimal() = %q, want %q", got, tt.want)
+			}
+			back, err := Parse(tt.m.Decimal(), tt.m.Currency)
+			if err != nil || back != tt.m {
+				t.Fatalf("Parse(Decimal()) = %+v, %v, want %+v", back, err, tt.m)
+			}
+		})
+	}
+}
+
+func TestFromNumeric(t *testing.T) {
+	tests := []struct {
+		name     string
+		n        pgtype.Numeric
+		currency string
+		want     int64
+		wantErr  error
+	}{
+		{"column scale", pgtype.Numeric{Int: big.NewInt(123400), Exp: -4, Valid: true}, "USD", 1234, nil},
+		{"integer", pgtype.Numeric{Int: big.NewInt(12), Exp: 0, Valid: true}, "USD", 1200, nil},
+		{"positive exponent", pgtype.Numeric{Int: big.NewInt(5), Exp: 2, Valid: true}, "JPY", 500, nil},
+		{"digits beyond the currency", pgtype.Numeric{Int: big.NewInt(123456), Exp: -4, Valid: true}, "USD", 0, ErrInvalidScale},
+		{"null", pgtype.Numeric{}, "USD", 0, ErrInvalidAmount},
+		{"not a number", pgtype.Numeric{NaN: true, Valid: true}, "USD", 0, ErrInvalidAmount},
+		{"unknown currency", pgtype.Numeric{Int: big.NewInt(1), Valid: true}, "XXX", 0, ErrUnknownCurrency},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := FromNumeric(tt.n, tt.currency)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("error = %v, want %v", err, tt.wantErr)
+			}
+			if tt.wantErr == nil && got != (Money{Amount: tt.want, Currency: tt.currency}) {
+				t.Fatalf("FromNumeric() = %+v, want %d minor units", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestAddSub(t *testing.T) {
+	usd := func(minor int64) Money { return Money{Amount: minor, Currency: "USD"} }
+	const maxInt64 = 1<<63 - 1
+
+	tests := []struct {
+		name    string
+		a, b    Money
+		sum     Money
+		sumErr  error
+		diff    Money
+		diffErr error
+	}{
+		{"plain", usd(150), usd(75), usd(225), nil, usd(75), nil},
+		{"negative", usd(-150), usd(75), usd(-75), nil, usd(-225), nil},
+		{"currency mismatch", usd(1), Money{Amount: 1, Currency: "EUR"}, Money{}, ErrCurrencyMismatch, Money{}, ErrCurrencyMismatch},
+		{"overflow", usd(maxInt64), usd(1), Money{}, ErrOverflow, usd(maxInt64 - 1), nil},
+		{"underflow", usd(-maxInt64), usd(2), usd(-maxInt64 + 2), nil, Money{}, ErrOverflow},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sum, err := tt.a.Add(tt.b)
+			if !errors.Is(err, tt.sumErr) || sum != tt.sum {
+				t.Errorf("Add() = %+v, %v, want %+v, %v", sum, err, tt.sum, tt.sumErr)
+			}
+			diff, err := tt.a.Sub(tt.b)
+			if !errors.Is(err, tt.diffErr) || diff != tt.diff {
+				t.Errorf("Sub() = %+v, %v, want %+v, %v", diff, err, tt.diff, tt.diffErr)
+			}
+		})
+	}
+}
+
+func TestConvert(t *testing.T) {
+	tests := []struct {
+		name string
+		m    Money
+		rate *big.Rat
+		to   string
+		want int64
+	}{
+		{"same scale", Money{Amount: 1000, Currency: "USD"}, big.NewRat(9, 10), "EUR", 900},
+		{"half rounds to even down", Money{Amount: 1, Currency: "USD"}, big.NewRat(1, 2), "EUR", 0},
+		{"half rounds to even up", Money{Amount: 3, Currency: "USD"}, big.NewRat(1, 2), "EUR", 2},
+		{"negative half rounds to even", Money{Amount: -3, Currency: "USD"}, big.NewRat(1, 2), "EUR", -2},
+		{"above half rounds up", Money{Amount: 100, Currency: "USD"}, big.NewRat(1, 3), "EUR", 33},
+		{"to a currency without cents", Money{Amount: 150, Currency: "USD"}, big.NewRat(150, 1), "JPY", 225},
+		{"from a currency without cents", Money{Amount: 1000, Currency: "JPY"}, big.NewRat(1, 150), "USD", 667},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.m.Convert(tt.rate, tt.to)
+			if err != nil {
+				t.Fatalf("Convert() error = %v", err)
+			}
+			if got != (Money{Amount: tt.want, Currency: tt.to}) {
+				t.Fatalf("Convert() = %+v, want %d minor units", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,55 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+)
+
+const (
+	DriverLocal = "local"
+	DriverS3    = "s3"
+)
+
+var ErrNotFound = errors.New("object not found")
+
+// Storage keeps binary objects under slash separated keys.
+type Storage interface {
+	Put(ctx context.Context, key string, r io.Reader, size int64, contentType string) error
+	Get(ctx context.Context, key string) (io.ReadCloser, error)
+	Delete(ctx context.Context, key string) error
+}
+
+type Config struct {
+	Driver string
+	// Dir is the root directory of the local driver.
+	Dir string
+	S3  S3Config
+
+	// MaxFileSize and UserQuota are limits in bytes for a single upload and
+	// for everything a user has uploaded. Zero means unlimited.
+	MaxFileSize int64
+	UserQuota   int64
+}
+
+type S3Config struct {
+	Endpoint  string
+	AccessKey string
+	SecretKey string
+	Bucket    string
+	Region    string
+	UseSSL    bool
+}
+
+// New returns the storage selected by cfg.Driver.
+func New(ctx context.Context, cfg *Config) (Storage, error) {
+	switch cfg.Driver {
+	case DriverLocal, "":
+		return NewLocal(cfg.Dir)
+	case DriverS3:
+		return NewS3(ctx, cfg.S3)
+	default:
+		return nil, fmt.Errorf("unknown storage driver %q", cfg.Driver)
+	}
+}
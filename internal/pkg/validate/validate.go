@@ -0,0 +1,347 @@
+// Package validate checks request bodies against rules declared in their
+// struct tags, so that every handler reports bad input the same way: one
+// error listing what is wrong with each field.
+//
+// Rules are separated by commas, e.g. `validate:"required,max=100"`.
+// Fields are named after their json tags and nested structs and slices are
+// checked too, e.g. "participants[1].share". Every rule but required and
+// notblank passes on an empty value, and a nil pointer is an omitted field
+// that only required rejects.
+package validate
+
+import (
+	"fmt"
+	"math/big"
+	"net/mail"
+	"reflect"
+	"search-job/internal/pkg/apperr"
+	"search-job/internal/pkg/money"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/labstack/echo/v4"
+)
+
+// Bind reads the request into req and validates it.
+func Bind(c echo.Context, req any) error {
+	if err := c.Bind(req); err != nil {
+		return apperr.ErrInvalidParams
+	}
+	return Struct(req)
+}
+
+// Struct validates v, a struct or a pointer to one. The error is an
+// apperr validation error with a field error per invalid field.
+func Struct(v any) error {
+	var fields []apperr.FieldError
+	walk(reflect.ValueOf(v), "", &fields)
+	if len(fields) == 0 {
+		return nil
+	}
+	return Failed(fields...)
+}
+
+// Failed is the error Struct returns, for checks that need more than tags,
+// such as a lookup in the database.
+func Failed(fields ...apperr.FieldError) error {
+	return apperr.Validation("validation_failed", "request is invalid", fields...)
+}
+
+// rule returns why value breaks it, or "" if it does not. parent is the
+// struct holding the field, for rules that refer to another field.
+type rule func(value, parent reflect.Value, arg string) string
+
+var rules map[string]rule
+
+func init() {
+	rules = map[string]rule{
+		"email":       email,
+		"min":         minimum,
+		"max":         maximum,
+		"maxbytes":    maxBytes,
+		"oneof":       oneOf,
+		"currency":    currency,
+		"decimal":     decimal,
+		"positive":    positive,
+		"nonnegative": nonNegative,
+		"scale":       scale,
+		"datetime":    datetime,
+		"date":        date,
+		"timezone":    timezone,
+	}
+}
+
+var timeType = reflect.TypeOf(time.Time{})
+
+func walk(v reflect.Value, prefix string, fields *[]apperr.FieldError) {
+	for v.Kind() == reflect.Pointer || v.Kind() == reflect.Interface {
+		if v.IsNil() {
+			return
+		}
+		v = v.Elem()
+	}
+
+	switch {
+	case v.Kind() == reflect.Slice || v.Kind() == reflect.Array:
+		for i := 0; i < v.Len(); i++ {
+			walk(v.Index(i), fmt.Sprintf("%s[%d]", prefix, i), fields)
+		}
+	case v.Kind() == reflect.Struct && v.Type() != timeType:
+		t := v.Type()
+		for i := 0; i < t.NumField(); i++ {
+			f := t.Field(i)
+			if !f.IsExported() {
+				continue
+			}
+			name := fieldName(f)
+			if name == "-" {
+				continue
+			}
+			path := name
+			if prefix != "" {
+				path = prefix + "." + name
+			}
+			if tag := f.Tag.Get("validate"); tag != "" {
+				if msg := check(v.Field(i), v, tag); msg != "" {
+					*fields = append(*fields, apperr.FieldError{Field: path, Message: msg})
+					continue
+				}
+			}
+			walk(v.Field(i), path, fields)
+		}
+	}
+}
+
+func fieldName(f reflect.StructField) string {
+	name, _, _ := strings.Cut(f.Tag.Get("json"), ",")
+	if name == "" {
+		return f.Name
+	}
+	return name
+}
+
+func check(value, parent reflect.Value, tag string) string {
+	names := strings.Split(tag, ",")
+	required := contains(names, "required")
+	notBlank := contains(names, "notblank")
+
+	for value.Kind() == reflect.Pointer {
+		if value.IsNil() {
+			if required {
+				return "is required"
+			}
+			return ""
+		}
+		value = value.Elem()
+	}
+
+	if isEmpty(value) {
+		if required {
+			return "is required"
+		}
+		if notBlank {
+			return "must not be empty"
+		}
+		return ""
+	}
+
+	for _, r := range names {
+		name, arg, _ := strings.Cut(r, "=")
+		if name == "required" || name == "notblank" {
+			continue
+		}
+		fn, ok := rules[name]
+		if !ok {
+			panic("validate: unknown rule " + name)
+		}
+		if msg := fn(value, parent, arg); msg != "" {
+			return msg
+		}
+	}
+	return ""
+}
+
+func contains(names []string, name string) bool {
+	for _, n := range names {
+		if n == name {
+			return true
+		}
+	}
+	return false
+}
+
+// isEmpty treats a string of spaces as empty, like the handlers trimming
+// names do.
+func isEmpty(v reflect.Value) bool {
+	if v.Kind() == reflect.String {
+		return strings.TrimSpace(v.String()) == ""
+	}
+	if v.Kind() == reflect.Slice || v.Kind() == reflect.Map {
+		return v.Len() == 0
+	}
+	return v.IsZero()
+}
+
+func email(value, _ reflect.Value, _ string) string {
+	s := value.String()
+	addr, err := mail.ParseAddress(s)
+	if err != nil || addr.Address != s {
+		return "must be an email address"
+	}
+	return ""
+}
+
+func minimum(value, _ reflect.Value, arg string) string {
+	switch value.Kind() {
+	case reflect.String:
+		if utf8.RuneCountInString(value.String()) < atoi(arg) {
+			return "must be at least " + arg + " characters long"
+		}
+	case reflect.Slice, reflect.Map:
+		if value.Len() < atoi(arg) {
+			return "must have at least " + arg + " items"
+		}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		if value.Int() < int64(atoi(arg)) {
+			return "must be at least " + arg
+		}
+	}
+	return ""
+}
+
+func maximum(value, _ reflect.Value, arg string) string {
+	switch value.Kind() {
+	case reflect.String:
+		if utf8.RuneCountInString(value.String()) > atoi(arg) {
+			return "must be at most " + arg + " characters long"
+		}
+	case reflect.Slice, reflect.Map:
+		if value.Len() > atoi(arg) {
+			return "must have at most " + arg + " items"
+		}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		if value.Int() > int64(atoi(arg)) {
+			return "must be at most " + arg
+		}
+	}
+	return ""
+}
+
+// maxBytes limits the length of a string in UTF-8 bytes rather than
+// characters, for values passed on to something counting bytes.
+func maxBytes(value, _ reflect.Value, arg string) string {
+	if len(value.String()) > atoi(arg) {
+		return "must be at most " + arg + " bytes long"
+	}
+	return ""
+}
+
+func oneOf(value, _ reflect.Value, arg string) string {
+	options := strings.Fields(arg)
+	if !contains(options, value.String()) {
+		return "must be one of " + strings.Join(options, ", ")
+	}
+	return ""
+}
+
+func currency(value, _ reflect.Value, _ string) string {
+	if !money.IsValidCurrency(value.String()) {
+		return "must be an ISO 4217 currency code in upper case"
+	}
+	return ""
+}
+
+func decimal(value, _ reflect.Value, _ string) string {
+	if _, ok := parseDecimal(value); !ok {
+		return "must be a decimal number"
+	}
+	return ""
+}
+
+func positive(value, _ reflect.Value, _ string) string {
+	n, ok := parseDecimal(value)
+	if !ok {
+		return "must be a decimal number"
+	}
+	if n.Sign() <= 0 {
+		return "must be greater than zero"
+	}
+	return ""
+}
+
+func nonNegative(value, _ reflect.Value, _ string) string {
+	n, ok := parseDecimal(value)
+	if !ok {
+		return "must be a decimal number"
+	}
+	if n.Sign() < 0 {
+		return "must not be negative"
+	}
+	return ""
+}
+
+// scale checks that an amount has no more decimal places than the currency
+// in the field named by arg allows. An omitted or unknown currency is left
+// to the rules of that field.
+func scale(value, parent reflect.Value, arg string) string {
+	field := parent.FieldByName(arg)
+	for field.Kind() == reflect.Pointer {
+		if field.IsNil() {
+			return ""
+		}
+		field = field.Elem()
+	}
+	code := field.String()
+	if !money.IsValidCurrency(code) {
+		return ""
+	}
+	if _, err := money.Parse(value.String(), code); err != nil {
+		return "must be an amount in " + code
+	}
+	return ""
+}
+
+func datetime(value, _ reflect.Value, _ string) string {
+	if _, err := time.Parse(time.RFC3339, value.String()); err != nil {
+		return "must be a date and time in RFC 3339 format"
+	}
+	return ""
+}
+
+func date(value, _ reflect.Value, _ string) string {
+	if _, err := time.Parse(time.DateOnly, value.String()); err != nil {
+		return "must be a date in YYYY-MM-DD format"
+	}
+	return ""
+}
+
+func timezone(value, _ reflect.Value, _ string) string {
+	if _, err := time.LoadLocation(value.String()); err != nil {
+		return "must be an IANA time zone such as Europe/Berlin"
+	}
+	return ""
+}
+
+func parseDecimal(value reflect.Value) (*big.Int, bool) {
+	switch value.Kind() {
+	case reflect.String:
+		n, err := money.ParseNumeric(value.String())
+		if err != nil {
+			return nil, false
+		}
+		return n.Int, true
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return big.NewInt(value.Int()), true
+	}
+	return nil, false
+}
+
+func atoi(s string) int {
+	n, err := strconv.Atoi(s)
+	if err != nil {
+		panic("validate: bad rule argument " + s)
+	}
+	return n
+}
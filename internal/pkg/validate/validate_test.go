@@ -0,0 +1,153 @@
+package validate
+
+import (
+	"errors"
+	"search-job/internal/pkg/apperr"
+	"slices"
+	"testing"
+)
+
+type item struct {
+	Name  string `json:"name" validate:"required,max=5"`
+	Share string `json:"share" validate:"nonnegative"`
+}
+
+type request struct {
+	Email    string  `json:"email" validate:"email"`
+	Title    string  `json:"title" validate:"notblank,min=2,max=10"`
+	Note     *string `json:"note" validate:"max=3"`
+	Owner    *int64  `json:"owner_id" validate:"required"`
+	Limit    int     `json:"limit" validate:"min=1,max=100"`
+	Bytes    string  `json:"bytes" validate:"maxbytes=4"`
+	Mode     string  `json:"mode" validate:"oneof=equal percent"`
+	Currency string  `json:"currency" validate:"currency"`
+	Amount   string  `json:"amount" validate:"positive,scale=Currency"`
+	Rate     string  `json:"rate" validate:"decimal"`
+	At       string  `json:"at" validate:"datetime"`
+	Day      string  `json:"day" validate:"date"`
+	Zone     string  `json:"zone" validate:"timezone"`
+	Items    []item  `json:"items" validate:"max=2"`
+	Skipped  string  `json:"-" validate:"required"`
+}
+
+func valid() request {
+	owner := int64(1)
+	return request{
+		Email:    "ann@example.com",
+		Title:    "Lunch",
+		Owner:    &owner,
+		Limit:    10,
+		Mode:     "equal",
+		Currency: "USD",
+		Amount:   "12.34",
+		At:       "2026-01-31T10:00:00Z",
+		Day:      "2026-01-31",
+		Zone:     "Europe/Berlin",
+	}
+}
+
+func str(s string) *string {
+	return &s
+}
+
+func TestStruct(t *testing.T) {
+	tests := []struct {
+		name   string
+		change func(r *request)
+		want   []apperr.FieldError
+	}{
+		{"valid", func(r *request) {}, nil},
+		{"empty optional fields pass", func(r *request) {
+			r.Email, r.Limit, r.Mode, r.Currency, r.Amount, r.At, r.Day, r.Zone = "", 0, "", "", "", "", "", ""
+		}, nil},
+		{"required pointer", func(r *request) { r.Owner = nil }, []apperr.FieldError{
+			{Field: "owner_id", Message: "is required"},
+		}},
+		{"not blank", func(r *request) { r.Title = "   " }, []apperr.FieldError{
+			{Field: "title", Message: "must not be empty"},
+		}},
+		{"string length counts characters", func(r *request) { r.Title = "Café за 10" }, nil},
+		{"string too short and too long", func(r *request) { r.Title = "x"; r.Note = str("long") }, []apperr.FieldError{
+			{Field: "title", Message: "must be at least 2 characters long"},
+			{Field: "note", Message: "must be at most 3 characters long"},
+		}},
+		{"integer bounds", func(r *request) { r.Limit = 101 }, []apperr.FieldError{
+			{Field: "limit", Message: "must be at most 100"},
+		}},
+		{"bytes", func(r *request) { r.Bytes = "ééé" }, []apperr.FieldError{
+			{Field: "bytes", Message: "must be at most 4 bytes long"},
+		}},
+		{"email", func(r *request) { r.Email = "Ann <ann@example.com>" }, []apperr.FieldError{
+			{Field: "email", Message: "must be an email address"},
+		}},
+		{"one of", func(r *request) { r.Mode = "exact" }, []apperr.FieldError{
+			{Field: "mode", Message: "must be one of equal, percent"},
+		}},
+		{"currency", func(r *request) { r.Currency = "usd" }, []apperr.FieldError{
+			{Field: "currency", Message: "must be an ISO 4217 currency code in upper case"},
+		}},
+		{"positive", func(r *request) { r.Amount = "0" }, []apperr.FieldError{
+			{Field: "amount", Message: "must be greater than zero"},
+		}},
+		{"not a decimal", func(r *request) { r.Amount = "1e3"; r.Rate = "1,5" }, []apperr.FieldError{
+			{Field: "amount", Message: "must be a decimal number"},
+			{Field: "rate", Message: "must be a decimal number"},
+		}},
+		{"scale of the currency", func(r *request) { r.Amount = "12.345" }, []apperr.FieldError{
+			{Field: "amount", Message: "must be an amount in USD"},
+		}},
+		{"scale of a currency without cents", func(r *request) { r.Currency = "JPY"; r.Amount = "12.5" }, []apperr.FieldError{
+			{Field: "amount", Message: "must be an amount in JPY"},
+		}},
+		{"scale left to an unknown currency", func(r *request) { r.Currency = "XXX"; r.Amount = "12.345" }, []apperr.FieldError{
+			{Field: "currency", Message: "must be an ISO 4217 currency code in upper case"},
+		}},
+		{"dates and zone", func(r *request) { r.At = "2026-01-31"; r.Day = "31.01.2026"; r.Zone = "Mars/Olympus" }, []apperr.FieldError{
+			{Field: "at", Message: "must be a date and time in RFC 3339 format"},
+			{Field: "day", Message: "must be a date in YYYY-MM-DD format"},
+			{Field: "zone", Message: "must be an IANA time zone such as Europe/Berlin"},
+		}},
+		{"nested items", func(r *request) { r.Items = []item{{Name: "ok"}, {Name: "", Share: "-1"}} }, []apperr.FieldError{
+			{Field: "items[1].name", Message: "is required"},
+			{Field: "items[1].share", Message: "must not be negative"},
+		}},
+		{"too many items stops at the slice", func(r *request) { r.Items = []item{{}, {}, {}} }, []apperr.FieldError{
+			{Field: "items", Message: "must have at most 2 items"},
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := valid()
+			tt.change(&r)
+
+			err := Struct(&r)
+			if tt.want == nil {
+				if err != nil {
+					t.Fatalf("Struct() = %v, want nil", err)
+				}
+				return
+			}
+
+			var e *apperr.Error
+			if !errors.As(err, &e) {
+				t.Fatalf("Struct() = %v, want an apperr error", err)
+			}
+			if e.Code != "validation_failed" || !slices.Equal(e.Fields, tt.want) {
+				t.Fatalf("Struct() = %s %+v, want validation_failed %+v", e.Code, e.Fields, tt.want)
+			}
+		})
+	}
+}
+
+func TestUnknownRulePanics(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Fatal("Struct() did not panic on an unknown rule")
+		}
+	}()
+
+	_ = Struct(struct {
+		Name string `validate:"uppercase"`
+	}{Name: "x"})
+}
@@ -0,0 +1,96 @@
+package rates
+
+import (
+	"encoding/csv"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"search-job/internal/models"
+	"search-job/internal/pkg/money"
+	"strings"
+	"time"
+)
+
+// ParseCSV reads rows of "date,currency,rate" where rate is the number of
+// currency units per one EUR. A header row is skipped if present.
+func ParseCSV(r io.Reader) ([]models.ExchangeRate, error) {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = 3
+	reader.TrimLeadingSpace = true
+
+	var result []models.ExchangeRate
+	for line := 1; ; line++ {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		if line == 1 && strings.EqualFold(record[0], "date") {
+			continue
+		}
+
+		rate, err := newRate(record[0], record[1], record[2])
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", line, err)
+		}
+		result = append(result, rate)
+	}
+
+	return result, nil
+}
+
+type ecbEnvelope struct {
+	Days []struct {
+		Time  string `xml:"time,attr"`
+		Rates []struct {
+			Currency string `xml:"currency,attr"`
+			Rate     string `xml:"rate,attr"`
+		} `xml:"Cube"`
+	} `xml:"Cube>Cube"`
+}
+
+// ParseECB reads the euro foreign exchange reference rates XML published by
+// the ECB (eurofxref-daily.xml and the -hist variants).
+func ParseECB(r io.Reader) ([]models.ExchangeRate, error) {
+	var envelope ecbEnvelope
+	if err := xml.NewDecoder(r).Decode(&envelope); err != nil {
+		return nil, err
+	}
+
+	var result []models.ExchangeRate
+	for _, day := range envelope.Days {
+		for _, cube := range day.Rates {
+			rate, err := newRate(day.Time, cube.Currency, cube.Rate)
+			if err != nil {
+				return nil, fmt.Errorf("%s %s: %w", day.Time, cube.Currency, err)
+			}
+			result = append(result, rate)
+		}
+	}
+
+	return result, nil
+}
+
+func newRate(date, currency, rate string) (models.ExchangeRate, error) {
+	day, err := time.Parse(time.DateOnly, strings.TrimSpace(date))
+	if err != nil {
+		return models.ExchangeRate{}, err
+	}
+
+	currency = strings.ToUpper(strings.TrimSpace(currency))
+	if !money.IsValidCurrency(currency) {
+		return models.ExchangeRate{}, money.ErrUnknownCurrency
+	}
+
+	value, err := money.ParseNumeric(rate)
+	if err != nil {
+		return models.ExchangeRate{}, err
+	}
+	if value.Int.Sign() <= 0 {
+		return models.ExchangeRate{}, fmt.Errorf("rate must be positive")
+	}
+
+	return models.ExchangeRate{Date: day, Currency: currency, Rate: value}, nil
+}
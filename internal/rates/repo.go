@@ -0,0 +1,120 @@
+package rates
+
+import (
+	"context"
+	"math/big"
+	"search-job/internal/models"
+	"search-job/internal/pkg/apperr"
+	"search-job/internal/pkg/money"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// ReferenceCurrency is the currency all stored rates are quoted against.
+const ReferenceCurrency = "EUR"
+
+var ErrRateNotFound = apperr.NotFound("rate_not_found", "exchange rate not found")
+
+type Repo struct {
+	db *pgxpool.Pool
+}
+
+func NewRepo(db *pgxpool.Pool) *Repo {
+	return &Repo{db: db}
+}
+
+// Save inserts the rates, replacing the ones already stored for the same
+// currency and date.
+func (r *Repo) Save(ctx context.Context, rates []models.ExchangeRate) error {
+	query := `
+		INSERT INTO exchange_rates (rate_date, currency, rate)
+		VALUES ($1, $2, $3)
+		ON CONFLICT (currency, rate_date) DO UPDATE SET rate = EXCLUDED.rate
+	`
+
+	batch := &pgx.Batch{}
+	for _, rate := range rates {
+		batch.Queue(query, rate.Date, rate.Currency, rate.Rate)
+	}
+
+	return r.db.SendBatch(ctx, batch).Close()
+}
+
+// Convert converts m into the currency to at the rates valid on the given day.
+func (r *Repo) Convert(ctx context.Context, m money.Money, to string, on time.Time) (money.Money, error) {
+	if m.Currency == to {
+		return m, nil
+	}
+
+	query := `
+		SELECT (` + RateQuery("$1::varchar", "$3::timestamptz") + `),
+		       (` + RateQuery("$2::varchar", "$3::timestamptz") + `)
+	`
+
+	var fromRate, toRate pgtype.Numeric
+	if err := r.db.QueryRow(ctx, query, m.Currency, to, on).Scan(&fromRate, &toRate); err != nil {
+		return money.Money{}, err
+	}
+
+	rate, err := CrossRate(fromRate, toRate)
+	if err != nil {
+		return money.Money{}, err
+	}
+
+	return m.Convert(rate, to)
+}
+
+// RateQuery returns a scalar subquery selecting the latest rate of the
+// currency expression published on or before the timestamp expression.
+func RateQuery(currency, at string) string {
+	return `
+		SELECT CASE WHEN ` + currency + ` = '` + ReferenceCurrency + `' THEN 1 ELSE (
+			SELECT er.rate
+			FROM exchange_rates er
+			WHERE er.currency = ` + currency + ` AND er.rate_date <= (` + at + ` AT TIME ZONE 'UTC')::date
+			ORDER BY er.rate_date DESC
+			LIMIT 1
+		) END
+	`
+}
+
+// CrossRate returns how many units of the target currency one unit of the
+// source currency buys, given both rates against ReferenceCurrency.
+func CrossRate(fromRate, toRate pgtype.Numeric) (*big.Rat, error) {
+	from, ok := numericRat(fromRate)
+	if !ok {
+		return nil, ErrRateNotFound
+	}
+	to, ok := numericRat(toRate)
+	if !ok {
+		return nil, ErrRateNotFound
+	}
+
+	return new(big.Rat).Quo(to, from), nil
+}
+
+func numericRat(n pgtype.Numeric) (*big.Rat, bool) {
+	if !n.Valid || n.NaN || n.InfinityModifier != pgtype.Finite || n.Int == nil || n.Int.Sign() <= 0 {
+		return nil, false
+	}
+
+	v := new(big.Rat).SetInt(n.Int)
+	exp := new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(abs(n.Exp))), nil)
+	if n.Exp >= 0 {
+		v.Mul(v, new(big.Rat).SetInt(exp))
+	} else {
+		v.Quo(v, new(big.Rat).SetInt(exp))
+	}
+
+	return v, true
+}
+
+func abs(v int32) int32 {
+	if v < 0 {
+		return -v
+	}
+	return v
+}
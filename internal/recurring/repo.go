@@ -0,0 +1,457 @@
+package recurring
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"search-job/internal/audit"
+	"search-job/internal/category"
+	"search-job/internal/ledger"
+	"search-job/internal/models"
+	"search-job/internal/pkg/apperr"
+	"search-job/internal/pkg/money"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+type Repo struct {
+	db *pgxpool.Pool
+}
+
+func NewRepo(db *pgxpool.Pool) *Repo {
+	return &Repo{db: db}
+}
+
+const columns = `
+	id, ledger_id, user_id, kind, category_id, amount, currency, comment, rrule, start_at,
+	paused, next_index, next_occurrence_at, created_at, updated_at
+`
+
+// Create stores a template whose occurrences are added to the ledger of
+// rec. ledger.ErrForbidden is returned unless the user may write to it and
+// category.ErrNotInLedger or category.ErrWrongKind unless the category is
+// a live category of the ledger and of the template's kind.
+func (r *Repo) Create(ctx context.Context, rec *models.RecurringExpense) error {
+	tx, err := r.db.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	if rec.CategoryID != nil {
+		if err := checkCategory(ctx, tx, rec.LedgerID, *rec.CategoryID, rec.Kind); err != nil {
+			return err
+		}
+	}
+
+	query := fmt.Sprintf(`
+		INSERT INTO recurring_expenses (ledger_id, user_id, kind, category_id, amount, currency, comment, rrule, start_at,
+		                                paused, next_index, next_occurrence_at, created_at, updated_at)
+		SELECT $1, $2, $12, $3, $4, $5, $6, $7, $8, $9, $10, $11, NOW(), NOW()
+		WHERE %s
+		RETURNING id, created_at, updated_at
+	`, ledger.AccessCondition("$1", "$2", ledger.Write))
+
+	err = tx.QueryRow(ctx, query,
+		rec.LedgerID,
+		rec.UserID,
+		rec.CategoryID,
+		rec.Amount.Numeric(),
+		rec.Amount.Currency,
+		rec.Comment,
+		rec.RRule,
+		rec.StartAt,
+		rec.Paused,
+		rec.NextIndex,
+		rec.NextOccurrenceAt,
+		rec.Kind,
+	).Scan(&rec.ID, &rec.CreatedAt, &rec.UpdatedAt)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return ledger.ErrForbidden
+	}
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit(ctx)
+}
+
+// GetAll returns the live templates of the ledger, of every member, if
+// the user is a member of it.
+func (r *Repo) GetAll(ctx context.Context, ledgerID, userID int64, limit, offset int) ([]models.RecurringExpense, int, error) {
+	where := "ledger_id = $1 AND deleted_at IS NULL AND " +
+		ledger.AccessCondition("recurring_expenses.ledger_id", "$2", ledger.Read)
+
+	var total int
+	err := r.db.QueryRow(ctx, `
+		SELECT COUNT(*)
+		FROM recurring_expenses
+		WHERE `+where, ledgerID, userID).Scan(&total)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	query := `
+		SELECT ` + columns + `
+		FROM recurring_expenses
+		WHERE ` + where + `
+		ORDER BY id
+		LIMIT $3 OFFSET $4
+	`
+
+	rows, err := r.db.Query(ctx, query, ledgerID, userID, limit, offset)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+
+	var result []models.RecurringExpense
+	for rows.Next() {
+		var rec models.RecurringExpense
+		if err := scanRecurring(rows, &rec); err != nil {
+			return nil, 0, err
+		}
+		result = append(result, rec)
+	}
+
+	return result, total, rows.Err()
+}
+
+func (r *Repo) GetByID(ctx context.Context, id, userID int64) (*models.RecurringExpense, error) {
+	return getByID(ctx, r.db, id, userID, ledger.Read)
+}
+
+type querier interface {
+	QueryRow(ctx context.Context, sql string, args ...any) pgx.Row
+}
+
+// getByID reads a live template of a ledger the user is a member of and
+// returns ledger.ErrForbidden if the member lacks the access. Inside a
+// transaction the row stays locked until it ends.
+func getByID(ctx context.Context, q querier, id, userID int64, access ledger.Access) (*models.RecurringExpense, error) {
+	lock := ""
+	if _, ok := q.(pgx.Tx); ok {
+		lock = "FOR UPDATE"
+	}
+
+	query := fmt.Sprintf(`
+		SELECT `+columns+`, %s
+		FROM recurring_expenses
+		WHERE id = $1 AND deleted_at IS NULL AND %s
+		%s
+	`,
+		ledger.AccessCondition("recurring_expenses.ledger_id", "$2", access),
+		ledger.AccessCondition("recurring_expenses.ledger_id", "$2", ledger.Read),
+		lock)
+
+	var rec models.RecurringExpense
+	var allowed bool
+	if err := scanRecurring(q.QueryRow(ctx, query, id, userID), &rec, &allowed); err != nil {
+		return nil, err
+	}
+	if !allowed {
+		return nil, ledger.ErrForbidden
+	}
+
+	return &rec, nil
+}
+
+// Update stores the template and schedule. Occurrences that were already
+// turned into expenses are left untouched. A new category is checked as on
+// Create, while the template may keep one deleted since.
+// userID is the member making the change, not necessarily the author.
+func (r *Repo) Update(ctx context.Context, rec *models.RecurringExpense, userID int64) error {
+	tx, err := r.db.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	before, err := getByID(ctx, tx, rec.ID, userID, ledger.Write)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return sql.ErrNoRows
+	}
+	if err != nil {
+		return err
+	}
+	if rec.CategoryID != nil && (before.CategoryID == nil || *before.CategoryID != *rec.CategoryID) {
+		if err := checkCategory(ctx, tx, before.LedgerID, *rec.CategoryID, rec.Kind); err != nil {
+			return err
+		}
+	}
+
+	query := `
+		UPDATE recurring_expenses
+		SET category_id = $1,
+		    amount = $2,
+		    currency = $3,
+		    comment = $4,
+		    rrule = $5,
+		    start_at = $6,
+		    paused = $7,
+		    next_index = $8,
+		    next_occurrence_at = $9,
+		    updated_at = NOW()
+		WHERE id = $10
+		RETURNING updated_at
+	`
+
+	err = tx.QueryRow(ctx, query,
+		rec.CategoryID,
+		rec.Amount.Numeric(),
+		rec.Amount.Currency,
+		rec.Comment,
+		rec.RRule,
+		rec.StartAt,
+		rec.Paused,
+		rec.NextIndex,
+		rec.NextOccurrenceAt,
+		rec.ID,
+	).Scan(&rec.UpdatedAt)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit(ctx)
+}
+
+// checkCategory runs category.Check and points its errors at the
+// category_id field.
+func checkCategory(ctx context.Context, tx pgx.Tx, ledgerID, categoryID int64, kind string) error {
+	err := category.Check(ctx, tx, ledgerID, categoryID, kind)
+	var e *apperr.Error
+	if errors.As(err, &e) {
+		return e.At("category_id")
+	}
+	return err
+}
+
+// Delete removes the template; expenses it created are kept.
+// userID is the member deleting it, not necessarily the author.
+func (r *Repo) Delete(ctx context.Context, id, userID int64) error {
+	tx, err := r.db.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	if _, err := getByID(ctx, tx, id, userID, ledger.Write); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return sql.ErrNoRows
+		}
+		return err
+	}
+
+	query := `
+		UPDATE recurring_expenses
+		SET deleted_at = NOW(), updated_at = NOW()
+		WHERE id = $1
+	`
+
+	if _, err := tx.Exec(ctx, query, id); err != nil {
+		return err
+	}
+
+	return tx.Commit(ctx)
+}
+
+// Skip keeps the occurrence of the template at occurrenceAt from being
+// created. userID is the member skipping it.
+func (r *Repo) Skip(ctx context.Context, id, userID int64, occurrenceAt time.Time) error {
+	tx, err := r.db.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	if _, err := getByID(ctx, tx, id, userID, ledger.Write); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return sql.ErrNoRows
+		}
+		return err
+	}
+
+	query := `
+		INSERT INTO recurring_expense_skips (recurring_id, occurrence_at)
+		VALUES ($1, $2)
+		ON CONFLICT DO NOTHING
+	`
+
+	if _, err := tx.Exec(ctx, query, id, occurrenceAt); err != nil {
+		return err
+	}
+
+	return tx.Commit(ctx)
+}
+
+// MaterializeNext locks one due series, inserts every occurrence up to now
+// as an expense and moves the series forward. It returns the id of the
+// series, also along with an error once the series is known, or 0 when
+// nothing was due. Series in exclude, which must not be nil, are passed
+// over, so that a failing series does not hold up the others. Rows locked
+// by other replicas are skipped and the unique (recurring_id,
+// occurrence_at) index keeps the inserts idempotent. Series of users who
+// can no longer write to their ledger are left alone.
+func (r *Repo) MaterializeNext(ctx context.Context, now time.Time, exclude []int64) (int64, error) {
+	tx, err := r.db.Begin(ctx)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback(ctx)
+
+	query := `
+		SELECT ` + columns + `
+		FROM recurring_expenses
+		WHERE deleted_at IS NULL AND NOT paused AND next_occurrence_at <= $1 AND id <> ALL($2)
+		  AND ` + ledger.AccessCondition("recurring_expenses.ledger_id", "recurring_expenses.user_id", ledger.Write) + `
+		ORDER BY next_occurrence_at
+		LIMIT 1
+		FOR UPDATE SKIP LOCKED
+	`
+
+	var rec models.RecurringExpense
+	err = scanRecurring(tx.QueryRow(ctx, query, now, exclude), &rec)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return 0, nil
+	}
+	if err != nil {
+		// rec.ID is set when the row was read but its amount was not
+		return rec.ID, err
+	}
+
+	rule, err := ParseRule(rec.RRule)
+	if err != nil {
+		return rec.ID, fmt.Errorf("recurring expense %d: %w", rec.ID, err)
+	}
+
+	skipped, err := skippedOccurrences(ctx, tx, rec.ID)
+	if err != nil {
+		return rec.ID, err
+	}
+
+	insert := `
+		INSERT INTO expenses (ledger_id, user_id, kind, category_id, amount, currency, occurred_at, comment,
+		                      recurring_id, occurrence_at, created_at, updated_at)
+		VALUES ($1, $2, $9, $3, $4, $5, $6, $7, $8, $6, NOW(), NOW())
+		ON CONFLICT (recurring_id, occurrence_at) DO NOTHING
+		RETURNING id, created_at, updated_at
+	`
+
+	var events []audit.Event
+	n := rec.NextIndex
+	var next *time.Time
+	for {
+		occurrence, ok := rule.Occurrence(rec.StartAt, n)
+		if !ok {
+			break
+		}
+		if occurrence.After(now) {
+			next = &occurrence
+			break
+		}
+
+		if !skipped[occurrence.Unix()] {
+			e := models.Expense{
+				LedgerID:    rec.LedgerID,
+				UserID:      rec.UserID,
+				Kind:        rec.Kind,
+				CategoryID:  rec.CategoryID,
+				Amount:      rec.Amount,
+				OccurredAt:  occurrence,
+				Comment:     rec.Comment,
+				RecurringID: &rec.ID,
+				Tags:        []string{},
+			}
+			err := tx.QueryRow(ctx, insert,
+				rec.LedgerID,
+				rec.UserID,
+				rec.CategoryID,
+				rec.Amount.Numeric(),
+				rec.Amount.Currency,
+				occurrence,
+				rec.Comment,
+				rec.ID,
+				rec.Kind,
+			).Scan(&e.ID, &e.CreatedAt, &e.UpdatedAt)
+			switch {
+			case errors.Is(err, pgx.ErrNoRows):
+				// already materialized
+			case err != nil:
+				return rec.ID, err
+			default:
+				events = append(events, audit.Event{
+					LedgerID:   rec.LedgerID,
+					OwnerID:    rec.UserID,
+					EntityType: audit.EntityExpense,
+					EntityID:   e.ID,
+					Action:     audit.ActionCreate,
+					After:      e,
+				})
+			}
+		}
+		n++
+	}
+
+	_, err = tx.Exec(ctx, `
+		UPDATE recurring_expenses
+		SET next_index = $1, next_occurrence_at = $2, updated_at = NOW()
+		WHERE id = $3
+	`, n, next, rec.ID)
+	if err != nil {
+		return rec.ID, err
+	}
+
+	if err := audit.Record(ctx, tx, events...); err != nil {
+		return rec.ID, err
+	}
+
+	return rec.ID, tx.Commit(ctx)
+}
+
+func skippedOccurrences(ctx context.Context, tx pgx.Tx, id int64) (map[int64]bool, error) {
+	rows, err := tx.Query(ctx, `SELECT occurrence_at FROM recurring_expense_skips WHERE recurring_id = $1`, id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	skipped := make(map[int64]bool)
+	for rows.Next() {
+		var t time.Time
+		if err := rows.Scan(&t); err != nil {
+			return nil, err
+		}
+		skipped[t.Unix()] = true
+	}
+
+	return skipped, rows.Err()
+}
+
+// scanRecurring reads the columns followed by any extra ones.
+func scanRecurring(row pgx.Row, rec *models.RecurringExpense, extra ...any) error {
+	var amount pgtype.Numeric
+	var currency string
+	dest := []any{
+		&rec.ID, &rec.LedgerID, &rec.UserID, &rec.Kind, &rec.CategoryID, &amount, &currency, &rec.Comment, &rec.RRule, &rec.StartAt,
+		&rec.Paused, &rec.NextIndex, &rec.NextOccurrenceAt, &rec.CreatedAt, &rec.UpdatedAt,
+	}
+	err := row.Scan(append(dest, extra...)...)
+	if err != nil {
+		return err
+	}
+
+	// occurrences are computed in UTC so that they do not depend on the
+	// time zone of the server
+	rec.StartAt = rec.StartAt.UTC()
+
+	rec.Amount, err = money.FromNumeric(amount, currency)
+	if err != nil {
+		return fmt.Errorf("recurring expense %d: %w", rec.ID, err)
+	}
+
+	return nil
+}
@@ -0,0 +1,147 @@
+package recurring
+
+import (
+	"fmt"
+	"search-job/internal/pkg/apperr"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	FrequencyDaily   = "DAILY"
+	FrequencyWeekly  = "WEEKLY"
+	FrequencyMonthly = "MONTHLY"
+	FrequencyYearly  = "YEARLY"
+)
+
+const untilLayout = "20060102T150405Z"
+
+var ErrInvalidRule = apperr.Validation("recurring_invalid_rule", "invalid recurrence rule")
+
+// Rule is the subset of RFC 5545 RRULE supported for recurring expenses:
+// FREQ, INTERVAL, COUNT and UNTIL. Occurrences keep the day of month of the
+// start and fall on the last day of shorter months.
+type Rule struct {
+	Frequency string
+	Interval  int
+	Count     int
+	Until     *time.Time
+}
+
+func ParseRule(s string) (Rule, error) {
+	rule := Rule{Interval: 1}
+
+	for _, part := range strings.Split(strings.TrimPrefix(s, "RRULE:"), ";") {
+		key, value, ok := strings.Cut(strings.TrimSpace(part), "=")
+		if !ok {
+			return Rule{}, fmt.Errorf("%w: %q", ErrInvalidRule, part)
+		}
+
+		switch strings.ToUpper(key) {
+		case "FREQ":
+			switch freq := strings.ToUpper(value); freq {
+			case FrequencyDaily, FrequencyWeekly, FrequencyMonthly, FrequencyYearly:
+				rule.Frequency = freq
+			default:
+				return Rule{}, fmt.Errorf("%w: unsupported FREQ %q", ErrInvalidRule, value)
+			}
+		case "INTERVAL":
+			n, err := strconv.Atoi(value)
+			if err != nil || n < 1 {
+				return Rule{}, fmt.Errorf("%w: INTERVAL must be a positive number", ErrInvalidRule)
+			}
+			rule.Interval = n
+		case "COUNT":
+			n, err := strconv.Atoi(value)
+			if err != nil || n < 1 {
+				return Rule{}, fmt.Errorf("%w: COUNT must be a positive number", ErrInvalidRule)
+			}
+			rule.Count = n
+		case "UNTIL":
+			t, err := time.Parse(untilLayout, value)
+			if err != nil {
+				t, err = time.Parse("20060102", value)
+			}
+			if err != nil {
+				return Rule{}, fmt.Errorf("%w: UNTIL must look like 20261231T000000Z", ErrInvalidRule)
+			}
+			rule.Until = &t
+		default:
+			return Rule{}, fmt.Errorf("%w: unsupported part %q", ErrInvalidRule, key)
+		}
+	}
+
+	if rule.Frequency == "" {
+		return Rule{}, fmt.Errorf("%w: FREQ is required", ErrInvalidRule)
+	}
+	if rule.Count > 0 && rule.Until != nil {
+		return Rule{}, fmt.Errorf("%w: COUNT and UNTIL are mutually exclusive", ErrInvalidRule)
+	}
+
+	return rule, nil
+}
+
+func (r Rule) String() string {
+	parts := []string{"FREQ=" + r.Frequency}
+	if r.Interval > 1 {
+		parts = append(parts, "INTERVAL="+strconv.Itoa(r.Interval))
+	}
+	if r.Count > 0 {
+		parts = append(parts, "COUNT="+strconv.Itoa(r.Count))
+	}
+	if r.Until != nil {
+		parts = append(parts, "UNTIL="+r.Until.UTC().Format(untilLayout))
+	}
+	return strings.Join(parts, ";")
+}
+
+// Occurrence returns the n-th (zero based) occurrence of the series and
+// whether it is still within COUNT and UNTIL.
+func (r Rule) Occurrence(start time.Time, n int) (time.Time, bool) {
+	if r.Count > 0 && n >= r.Count {
+		return time.Time{}, false
+	}
+
+	step := n * r.Interval
+	var t time.Time
+	switch r.Frequency {
+	case FrequencyDaily:
+		t = start.AddDate(0, 0, step)
+	case FrequencyWeekly:
+		t = start.AddDate(0, 0, 7*step)
+	case FrequencyMonthly:
+		t = addMonths(start, step)
+	case FrequencyYearly:
+		t = addMonths(start, 12*step)
+	}
+
+	if r.Until != nil && t.After(*r.Until) {
+		return time.Time{}, false
+	}
+	return t, true
+}
+
+// Next returns the index and time of the first occurrence not before from,
+// searching from index n on. It returns nil when the series has ended.
+func (r Rule) Next(start time.Time, n int, from time.Time) (int, *time.Time) {
+	for ; ; n++ {
+		t, ok := r.Occurrence(start, n)
+		if !ok {
+			return n, nil
+		}
+		if !t.Before(from) {
+			return n, &t
+		}
+	}
+}
+
+func addMonths(t time.Time, months int) time.Time {
+	year, month, day := t.Date()
+	first := time.Date(year, month+time.Month(months), 1, t.Hour(), t.Minute(), t.Second(), t.Nanosecond(), t.Location())
+	lastDay := first.AddDate(0, 1, -1).Day()
+	if day > lastDay {
+		day = lastDay
+	}
+	return first.AddDate(0, 0, day-1)
+}
@@ -0,0 +1,131 @@
+package recurring
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func date(year int, month time.Month, day int) time.Time {
+	return time.Date(year, month, day, 9, 30, 0, 0, time.UTC)
+}
+
+func TestParseRule(t *testing.T) {
+	until := time.Date(2026, 12, 31, 0, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name    string
+		in      string
+		want    string
+		wantErr bool
+	}{
+		{name: "frequency only", in: "FREQ=MONTHLY", want: "FREQ=MONTHLY"},
+		{name: "prefix and lower case", in: "RRULE:freq=weekly;interval=2", want: "FREQ=WEEKLY;INTERVAL=2"},
+		{name: "interval of one is dropped", in: "FREQ=DAILY;INTERVAL=1", want: "FREQ=DAILY"},
+		{name: "count", in: "FREQ=YEARLY;COUNT=3", want: "FREQ=YEARLY;COUNT=3"},
+		{name: "until", in: "FREQ=MONTHLY;UNTIL=20261231T000000Z", want: "FREQ=MONTHLY;UNTIL=" + until.Format(untilLayout)},
+		{name: "until as a date", in: "FREQ=MONTHLY;UNTIL=20261231", want: "FREQ=MONTHLY;UNTIL=20261231T000000Z"},
+		{name: "no frequency", in: "COUNT=3", wantErr: true},
+		{name: "unsupported frequency", in: "FREQ=HOURLY", wantErr: true},
+		{name: "zero interval", in: "FREQ=DAILY;INTERVAL=0", wantErr: true},
+		{name: "zero count", in: "FREQ=DAILY;COUNT=0", wantErr: true},
+		{name: "count and until", in: "FREQ=DAILY;COUNT=2;UNTIL=20261231", wantErr: true},
+		{name: "unsupported part", in: "FREQ=MONTHLY;BYDAY=MO", wantErr: true},
+		{name: "malformed part", in: "FREQ=MONTHLY;COUNT", wantErr: true},
+		{name: "bad until", in: "FREQ=MONTHLY;UNTIL=2026-12-31", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rule, err := ParseRule(tt.in)
+			if tt.wantErr {
+				if !errors.Is(err, ErrInvalidRule) {
+					t.Fatalf("ParseRule(%q) error = %v, want ErrInvalidRule", tt.in, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ParseRule(%q) error = %v", tt.in, err)
+			}
+			if got := rule.String(); got != tt.want {
+				t.Fatalf("ParseRule(%q) = %q, want %q", tt.in, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestOccurrence(t *testing.T) {
+	until := date(2026, 3, 31)
+
+	tests := []struct {
+		name   string
+		rule   Rule
+		start  time.Time
+		n      int
+		want   time.Time
+		wantOK bool
+	}{
+		{"first is the start", Rule{Frequency: FrequencyMonthly, Interval: 1}, date(2026, 1, 15), 0, date(2026, 1, 15), true},
+		{"daily", Rule{Frequency: FrequencyDaily, Interval: 1}, date(2026, 1, 30), 3, date(2026, 2, 2), true},
+		{"weekly with interval", Rule{Frequency: FrequencyWeekly, Interval: 2}, date(2026, 1, 1), 2, date(2026, 1, 29), true},
+		{"month end clamps to February", Rule{Frequency: FrequencyMonthly, Interval: 1}, date(2026, 1, 31), 1, date(2026, 2, 28), true},
+		{"month end clamps to leap February", Rule{Frequency: FrequencyMonthly, Interval: 1}, date(2028, 1, 31), 1, date(2028, 2, 29), true},
+		{"day of month comes back after a short month", Rule{Frequency: FrequencyMonthly, Interval: 1}, date(2026, 1, 31), 2, date(2026, 3, 31), true},
+		{"thirty-first clamps to the end of April", Rule{Frequency: FrequencyMonthly, Interval: 1}, date(2026, 1, 31), 3, date(2026, 4, 30), true},
+		{"monthly across the year", Rule{Frequency: FrequencyMonthly, Interval: 5}, date(2026, 10, 31), 1, date(2027, 3, 31), true},
+		{"yearly from leap day", Rule{Frequency: FrequencyYearly, Interval: 1}, date(2028, 2, 29), 1, date(2029, 2, 28), true},
+		{"yearly back to leap day", Rule{Frequency: FrequencyYearly, Interval: 1}, date(2028, 2, 29), 4, date(2032, 2, 29), true},
+		{"last within count", Rule{Frequency: FrequencyMonthly, Interval: 1, Count: 3}, date(2026, 1, 1), 2, date(2026, 3, 1), true},
+		{"past count", Rule{Frequency: FrequencyMonthly, Interval: 1, Count: 3}, date(2026, 1, 1), 3, time.Time{}, false},
+		{"on until", Rule{Frequency: FrequencyMonthly, Interval: 1, Until: &until}, date(2026, 1, 31), 2, date(2026, 3, 31), true},
+		{"past until", Rule{Frequency: FrequencyMonthly, Interval: 1, Until: &until}, date(2026, 1, 31), 3, time.Time{}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := tt.rule.Occurrence(tt.start, tt.n)
+			if ok != tt.wantOK || !got.Equal(tt.want) {
+				t.Fatalf("Occurrence(%v, %d) = %v, %v, want %v, %v", tt.start, tt.n, got, ok, tt.want, tt.wantOK)
+			}
+		})
+	}
+}
+
+func TestNext(t *testing.T) {
+	monthly := Rule{Frequency: FrequencyMonthly, Interval: 1}
+	start := date(2026, 1, 31)
+
+	tests := []struct {
+		name      string
+		rule      Rule
+		n         int
+		from      time.Time
+		wantIndex int
+		want      *time.Time
+	}{
+		{"from the start", monthly, 0, start, 0, &start},
+		{"skips past occurrences", monthly, 0, date(2026, 3, 1), 2, ptr(date(2026, 3, 31))},
+		{"occurrence at from is kept", monthly, 0, date(2026, 2, 28), 1, ptr(date(2026, 2, 28))},
+		{"searches from n on", monthly, 4, start, 4, ptr(date(2026, 5, 31))},
+		{"count already produced", Rule{Frequency: FrequencyMonthly, Interval: 1, Count: 12}, 8, start, 8, ptr(date(2026, 9, 30))},
+		{"ended by count", Rule{Frequency: FrequencyMonthly, Interval: 1, Count: 3}, 0, date(2026, 4, 1), 3, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			index, got := tt.rule.Next(start, tt.n, tt.from)
+			if index != tt.wantIndex {
+				t.Errorf("index = %d, want %d", index, tt.wantIndex)
+			}
+			switch {
+			case got == nil && tt.want == nil:
+			case got == nil || tt.want == nil || !got.Equal(*tt.want):
+				t.Errorf("next = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func ptr(t time.Time) *time.Time {
+	return &t
+}
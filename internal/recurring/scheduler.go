@@ -0,0 +1,68 @@
+package recurring
+
+import (
+	"context"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/labstack/gommon/log"
+)
+
+const DefaultSchedulerInterval = time.Minute
+
+// Scheduler periodically turns due recurring expenses into expenses. Every
+// run catches up on all occurrences missed while the service was down.
+type Scheduler struct {
+	repo     *Repo
+	logger   *log.Logger
+	interval time.Duration
+}
+
+func NewScheduler(db *pgxpool.Pool, logger *log.Logger, interval time.Duration) *Scheduler {
+	if interval <= 0 {
+		interval = DefaultSchedulerInterval
+	}
+
+	return &Scheduler{
+		repo:     NewRepo(db),
+		logger:   logger,
+		interval: interval,
+	}
+}
+
+// Run blocks until ctx is cancelled.
+func (s *Scheduler) Run(ctx context.Context) {
+	ticker := time.NewTicker(s.interval)
+	defer ticker.Stop()
+
+	for {
+		s.runOnce(ctx)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// runOnce materializes every due series. A series that fails is logged and
+// passed over until the next run.
+func (s *Scheduler) runOnce(ctx context.Context) {
+	now := time.Now()
+	failed := []int64{}
+	for {
+		id, err := s.repo.MaterializeNext(ctx, now, failed)
+		if err != nil {
+			s.logger.Errorf("recurring expenses: %v", err)
+			if id == 0 {
+				return
+			}
+			failed = append(failed, id)
+			continue
+		}
+		if id == 0 {
+			return
+		}
+	}
+}
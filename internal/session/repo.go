@@ -0,0 +1,158 @@
+package session
+
+import (
+	"context"
+	"errors"
+	"search-job/internal/models"
+	"search-job/internal/pkg/apperr"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+var (
+	ErrTokenInvalid = apperr.Unauthorized("refresh_token_invalid", "invalid or expired refresh token")
+	ErrTokenReused  = apperr.Unauthorized("refresh_token_reused", "refresh token reuse detected, session revoked")
+)
+
+type Repo struct {
+	db *pgxpool.Pool
+}
+
+func NewRepo(db *pgxpool.Pool) *Repo {
+	return &Repo{db: db}
+}
+
+func (r *Repo) Create(ctx context.Context, token *models.RefreshToken) error {
+	query := `
+		INSERT INTO refresh_tokens (user_id, family_id, token_hash, expires_at, created_at)
+		VALUES ($1, $2, $3, $4, NOW())
+		RETURNING id, created_at
+	`
+
+	return r.db.QueryRow(ctx, query,
+		token.UserID,
+		token.FamilyID,
+		token.TokenHash,
+		token.ExpiresAt,
+	).Scan(&token.ID, &token.CreatedAt)
+}
+
+// Rotate exchanges the refresh token with the given hash for next, which
+// inherits the user and family of the old one. Presenting a token that was
+// already rotated or revoked revokes the whole family and returns ErrTokenReused.
+func (r *Repo) Rotate(ctx context.Context, oldHash string, next *models.RefreshToken) error {
+	tx, err := r.db.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	query := `
+		SELECT id, user_id, family_id, expires_at, used_at, revoked_at
+		FROM refresh_tokens
+		WHERE token_hash = $1
+		FOR UPDATE
+	`
+
+	var old models.RefreshToken
+	err = tx.QueryRow(ctx, query, oldHash).Scan(
+		&old.ID, &old.UserID, &old.FamilyID, &old.ExpiresAt, &old.UsedAt, &old.RevokedAt,
+	)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return ErrTokenInvalid
+	}
+	if err != nil {
+		return err
+	}
+
+	if old.UsedAt != nil || old.RevokedAt != nil {
+		if err := revokeFamily(ctx, tx, old.FamilyID); err != nil {
+			return err
+		}
+		if err := tx.Commit(ctx); err != nil {
+			return err
+		}
+		return ErrTokenReused
+	}
+
+	if time.Now().After(old.ExpiresAt) {
+		return ErrTokenInvalid
+	}
+
+	_, err = tx.Exec(ctx, `UPDATE refresh_tokens SET used_at = NOW() WHERE id = $1`, old.ID)
+	if err != nil {
+		return err
+	}
+
+	next.UserID = old.UserID
+	next.FamilyID = old.FamilyID
+
+	insert := `
+		INSERT INTO refresh_tokens (user_id, family_id, token_hash, expires_at, created_at)
+		VALUES ($1, $2, $3, $4, NOW())
+		RETURNING id, created_at
+	`
+
+	err = tx.QueryRow(ctx, insert,
+		next.UserID,
+		next.FamilyID,
+		next.TokenHash,
+		next.ExpiresAt,
+	).Scan(&next.ID, &next.CreatedAt)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit(ctx)
+}
+
+// RevokeByToken revokes the family the refresh token with the given hash belongs to.
+func (r *Repo) RevokeByToken(ctx context.Context, tokenHash string) error {
+	var familyID string
+	err := r.db.QueryRow(ctx, `SELECT family_id FROM refresh_tokens WHERE token_hash = $1`, tokenHash).Scan(&familyID)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return ErrTokenInvalid
+	}
+	if err != nil {
+		return err
+	}
+
+	return revokeFamily(ctx, r.db, familyID)
+}
+
+// IsActive reports whether the session identified by familyID still has a
+// usable refresh token, i.e. it was neither revoked nor has it expired.
+func (r *Repo) IsActive(ctx context.Context, familyID string) (bool, error) {
+	query := `
+		SELECT EXISTS (
+			SELECT 1
+			FROM refresh_tokens
+			WHERE family_id = $1 AND revoked_at IS NULL AND used_at IS NULL AND expires_at > NOW()
+		)
+	`
+
+	var active bool
+	if err := r.db.QueryRow(ctx, query, familyID).Scan(&active); err != nil {
+		return false, err
+	}
+
+	return active, nil
+}
+
+type execer interface {
+	Exec(ctx context.Context, sql string, args ...any) (pgconn.CommandTag, error)
+}
+
+func revokeFamily(ctx context.Context, db execer, familyID string) error {
+	query := `
+		UPDATE refresh_tokens
+		SET revoked_at = NOW()
+		WHERE family_id = $1 AND revoked_at IS NULL
+	`
+
+	_, err := db.Exec(ctx, query, familyID)
+	return err
+}
@@ -0,0 +1,256 @@
+package split
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"search-job/internal/ledger"
+	"search-job/internal/models"
+	"search-job/internal/pkg/money"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+type Repo struct {
+	db *pgxpool.Pool
+}
+
+func NewRepo(db *pgxpool.Pool) *Repo {
+	return &Repo{db: db}
+}
+
+// Assign replaces the participants of an expense within tx. ErrNotMember
+// is returned if any of them is not a member of the ledger, unless they
+// are in keep, the participants the expense had before, who may have left
+// the ledger since.
+func Assign(ctx context.Context, tx pgx.Tx, ledgerID, expenseID int64, participants []models.Participant, keep []int64) error {
+	if _, err := tx.Exec(ctx, `DELETE FROM expense_participants WHERE expense_id = $1`, expenseID); err != nil {
+		return err
+	}
+	if len(participants) == 0 {
+		return nil
+	}
+
+	userIDs := make([]int64, len(participants))
+	shares := make([]pgtype.Numeric, len(participants))
+	for i, p := range participants {
+		userIDs[i] = p.UserID
+		shares[i] = p.Share.Numeric()
+	}
+
+	result, err := tx.Exec(ctx, `
+		INSERT INTO expense_participants (expense_id, user_id, share)
+		SELECT $1, p.user_id, p.share
+		FROM unnest($2::bigint[], $3::numeric[]) AS p(user_id, share)
+		WHERE p.user_id = ANY($5::bigint[])
+		   OR EXISTS (SELECT 1 FROM ledger_members m WHERE m.ledger_id = $4 AND m.user_id = p.user_id)
+	`, expenseID, userIDs, shares, ledgerID, keep)
+	if err != nil {
+		return err
+	}
+	if result.RowsAffected() != int64(len(participants)) {
+		return ErrNotMember
+	}
+
+	return nil
+}
+
+// UserIDs returns the users of participants.
+func UserIDs(participants []models.Participant) []int64 {
+	ids := make([]int64, len(participants))
+	for i, p := range participants {
+		ids[i] = p.UserID
+	}
+	return ids
+}
+
+type querier interface {
+	Query(ctx context.Context, sql string, args ...any) (pgx.Rows, error)
+}
+
+// Participants loads the participants of an expense in the given currency,
+// which is the currency of the expense.
+func Participants(ctx context.Context, q querier, expenseID int64, currency string) ([]models.Participant, error) {
+	rows, err := q.Query(ctx, `
+		SELECT user_id, share FROM expense_participants
+		WHERE expense_id = $1
+		ORDER BY user_id
+	`, expenseID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var participants []models.Participant
+	for rows.Next() {
+		var p models.Participant
+		var share pgtype.Numeric
+		if err := rows.Scan(&p.UserID, &share); err != nil {
+			return nil, err
+		}
+		if p.Share, err = money.FromNumeric(share, currency); err != nil {
+			return nil, fmt.Errorf("expense %d: %w", expenseID, err)
+		}
+		participants = append(participants, p)
+	}
+
+	return participants, rows.Err()
+}
+
+// Balances returns what every member of the ledger is owed, per currency,
+// leaving out settled members. The author of a shared expense is owed its
+// amount and every participant owes their share; settlements move the
+// balance back. Incomes are never shared and do not count. Nothing is
+// returned unless the user is a member.
+func (r *Repo) Balances(ctx context.Context, ledgerID, userID int64) ([]models.Balance, error) {
+	query := fmt.Sprintf(`
+		SELECT b.user_id, b.currency, SUM(b.amount)
+		FROM (
+			SELECT e.user_id, e.currency, e.amount
+			FROM expenses e
+			WHERE e.ledger_id = $1 AND e.kind = '%[1]s' AND e.deleted_at IS NULL
+			  AND EXISTS (SELECT 1 FROM expense_participants p WHERE p.expense_id = e.id)
+			UNION ALL
+			SELECT p.user_id, e.currency, -p.share
+			FROM expense_participants p
+			JOIN expenses e ON e.id = p.expense_id
+			WHERE e.ledger_id = $1 AND e.kind = '%[1]s' AND e.deleted_at IS NULL
+			UNION ALL
+			SELECT s.from_user_id, s.currency, s.amount FROM settlements s WHERE s.ledger_id = $1
+			UNION ALL
+			SELECT s.to_user_id, s.currency, -s.amount FROM settlements s WHERE s.ledger_id = $1
+		) b
+		WHERE %[2]s
+		GROUP BY b.user_id, b.currency
+		HAVING SUM(b.amount) <> 0
+		ORDER BY b.currency, b.user_id
+	`, models.KindExpense, ledger.AccessCondition("$1", "$2", ledger.Read))
+
+	rows, err := r.db.Query(ctx, query, ledgerID, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	balances := []models.Balance{}
+	for rows.Next() {
+		var b models.Balance
+		var amount pgtype.Numeric
+		var currency string
+		if err := rows.Scan(&b.UserID, &currency, &amount); err != nil {
+			return nil, err
+		}
+		if b.Amount, err = money.FromNumeric(amount, currency); err != nil {
+			return nil, err
+		}
+		balances = append(balances, b)
+	}
+
+	return balances, rows.Err()
+}
+
+// CreateSettlement records a payment between two members of the ledger.
+// ledger.ErrForbidden is returned unless the creator may write to the
+// ledger and ErrNotMember if either side is not a member.
+func (r *Repo) CreateSettlement(ctx context.Context, s *models.Settlement) error {
+	var members int
+	err := r.db.QueryRow(ctx, `
+		SELECT COUNT(*) FROM ledger_members WHERE ledger_id = $1 AND user_id = ANY($2)
+	`, s.LedgerID, []int64{s.FromUserID, s.ToUserID}).Scan(&members)
+	if err != nil {
+		return err
+	}
+	if members != 2 {
+		return ErrNotMember
+	}
+
+	query := fmt.Sprintf(`
+		INSERT INTO settlements (ledger_id, from_user_id, to_user_id, amount, currency, settled_at, comment, created_by, created_at)
+		SELECT $1, $2, $3, $4, $5, $6, $7, $8, NOW()
+		WHERE %s
+		RETURNING id, created_at
+	`, ledger.AccessCondition("$1", "$8", ledger.Write))
+
+	err = r.db.QueryRow(ctx, query,
+		s.LedgerID,
+		s.FromUserID,
+		s.ToUserID,
+		s.Amount.Numeric(),
+		s.Amount.Currency,
+		s.SettledAt,
+		s.Comment,
+		s.CreatedBy,
+	).Scan(&s.ID, &s.CreatedAt)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return ledger.ErrForbidden
+	}
+
+	return err
+}
+
+// GetSettlements lists the settlements of a ledger the user is a member
+// of, latest first.
+func (r *Repo) GetSettlements(ctx context.Context, ledgerID, userID int64, limit, offset int) ([]models.Settlement, int, error) {
+	where := "s.ledger_id = $1 AND " + ledger.AccessCondition("s.ledger_id", "$2", ledger.Read)
+
+	var total int
+	err := r.db.QueryRow(ctx, "SELECT COUNT(*) FROM settlements s WHERE "+where, ledgerID, userID).Scan(&total)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	query := fmt.Sprintf(`
+		SELECT s.id, s.ledger_id, s.from_user_id, s.to_user_id, s.amount, s.currency,
+		       s.settled_at, s.comment, s.created_by, s.created_at
+		FROM settlements s
+		WHERE %s
+		ORDER BY s.settled_at DESC, s.id DESC
+		LIMIT $3 OFFSET $4
+	`, where)
+
+	rows, err := r.db.Query(ctx, query, ledgerID, userID, limit, offset)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+
+	settlements := []models.Settlement{}
+	for rows.Next() {
+		var s models.Settlement
+		var amount pgtype.Numeric
+		var currency string
+		err := rows.Scan(&s.ID, &s.LedgerID, &s.FromUserID, &s.ToUserID, &amount, &currency,
+			&s.SettledAt, &s.Comment, &s.CreatedBy, &s.CreatedAt)
+		if err != nil {
+			return nil, 0, err
+		}
+		if s.Amount, err = money.FromNumeric(amount, currency); err != nil {
+			return nil, 0, fmt.Errorf("settlement %d: %w", s.ID, err)
+		}
+		settlements = append(settlements, s)
+	}
+
+	return settlements, total, rows.Err()
+}
+
+// DeleteSettlement removes a settlement recorded by mistake. Any member who
+// may write to the ledger may delete it.
+func (r *Repo) DeleteSettlement(ctx context.Context, id, userID int64) error {
+	query := fmt.Sprintf(`
+		DELETE FROM settlements
+		WHERE id = $1 AND %s
+	`, ledger.AccessCondition("settlements.ledger_id", "$2", ledger.Write))
+
+	result, err := r.db.Exec(ctx, query, id, userID)
+	if err != nil {
+		return err
+	}
+	if result.RowsAffected() == 0 {
+		return sql.ErrNoRows
+	}
+
+	return nil
+}
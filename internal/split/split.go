@@ -0,0 +1,234 @@
+package split
+
+import (
+	"math/big"
+	"search-job/internal/models"
+	"search-job/internal/pkg/apperr"
+	"search-job/internal/pkg/money"
+	"sort"
+)
+
+// Ways to divide an expense between its participants.
+const (
+	ModeEqual   = "equal"
+	ModePercent = "percent"
+	ModeExact   = "exact"
+)
+
+var (
+	ErrUnknownMode          = apperr.Validation("split_unknown_mode", "unknown split mode")
+	ErrDuplicateParticipant = apperr.Validation("split_duplicate_participant", "participant is listed twice")
+	ErrInvalidShare         = apperr.Validation("split_invalid_share", "share must be a non-negative amount")
+	ErrPercentSum           = apperr.Validation("split_percent_sum", "percentages must add up to 100")
+	ErrShareSum             = apperr.Validation("split_share_sum", "shares must add up to the expense amount")
+	ErrNotMember            = apperr.Validation("split_not_member", "participant is not a member of the ledger")
+	ErrIncome               = apperr.Validation("split_income", "only expenses can be shared")
+)
+
+// Entry is a participant as given in a request. Percent is read in the
+// percent mode and Amount in the exact one.
+type Entry struct {
+	UserID  int64        `json:"user_id" validate:"required"`
+	Percent money.Number `json:"percent,omitempty" validate:"nonnegative"`
+	Amount  money.Number `json:"amount,omitempty" validate:"nonnegative"`
+}
+
+// Shares divides total between the entries. Cents that cannot be divided
+// evenly go to the participants with the largest remainders, earlier
+// entries first. No entries means the expense is not shared.
+func Shares(total money.Money, mode string, entries []Entry) ([]models.Participant, error) {
+	if len(entries) == 0 {
+		return nil, nil
+	}
+
+	seen := make(map[int64]bool, len(entries))
+	for _, e := range entries {
+		if seen[e.UserID] {
+			return nil, ErrDuplicateParticipant
+		}
+		seen[e.UserID] = true
+	}
+
+	var amounts []int64
+	switch mode {
+	case ModeEqual:
+		weights := make([]*big.Rat, len(entries))
+		for i := range weights {
+			weights[i] = big.NewRat(1, 1)
+		}
+		amounts = allocate(total.Amount, weights)
+	case ModePercent:
+		weights := make([]*big.Rat, len(entries))
+		sum := new(big.Rat)
+		for i, e := range entries {
+			w, ok := new(big.Rat).SetString(string(e.Percent))
+			if !ok || w.Sign() < 0 {
+				return nil, ErrInvalidShare
+			}
+			weights[i] = w
+			sum.Add(sum, w)
+		}
+		if sum.Cmp(big.NewRat(100, 1)) != 0 {
+			return nil, ErrPercentSum
+		}
+		amounts = allocate(total.Amount, weights)
+	case ModeExact:
+		amounts = make([]int64, len(entries))
+		var sum int64
+		for i, e := range entries {
+			share, err := money.Parse(string(e.Amount), total.Currency)
+			if err != nil || share.IsNegative() {
+				return nil, ErrInvalidShare
+			}
+			amounts[i] = share.Amount
+			sum += share.Amount
+		}
+		if sum != total.Amount {
+			return nil, ErrShareSum
+		}
+	default:
+		return nil, ErrUnknownMode
+	}
+
+	participants := make([]models.Participant, len(entries))
+	for i, e := range entries {
+		participants[i] = models.Participant{
+			UserID: e.UserID,
+			Share:  money.Money{Amount: amounts[i], Currency: total.Currency},
+		}
+	}
+
+	return participants, nil
+}
+
+// Rescale keeps the proportions of the shares when the amount or the
+// currency of the expense changes. Shares that are all zero are replaced
+// with equal ones.
+func Rescale(participants []models.Participant, total money.Money) []models.Participant {
+	if len(participants) == 0 {
+		return participants
+	}
+
+	weights := make([]*big.Rat, len(participants))
+	var sum int64
+	for i, p := range participants {
+		weights[i] = new(big.Rat).SetInt64(p.Share.Amount)
+		sum += p.Share.Amount
+	}
+	if sum == 0 {
+		for i := range weights {
+			weights[i] = big.NewRat(1, 1)
+		}
+	}
+
+	amounts := allocate(total.Amount, weights)
+	result := make([]models.Participant, len(participants))
+	for i, p := range participants {
+		result[i] = models.Participant{
+			UserID: p.UserID,
+			Share:  money.Money{Amount: amounts[i], Currency: total.Currency},
+		}
+	}
+
+	return result
+}
+
+// allocate divides total in proportion to the weights by the largest
+// remainder method, so that the parts always add up to total.
+func allocate(total int64, weights []*big.Rat) []int64 {
+	sum := new(big.Rat)
+	for _, w := range weights {
+		sum.Add(sum, w)
+	}
+
+	parts := make([]int64, len(weights))
+	remainders := make([]*big.Rat, len(weights))
+	left := total
+	for i, w := range weights {
+		exact := new(big.Rat).SetInt64(total)
+		exact.Mul(exact, w)
+		exact.Quo(exact, sum)
+
+		// floor, so that every remainder is in [0, 1)
+		floor := new(big.Int).Div(exact.Num(), exact.Denom())
+		parts[i] = floor.Int64()
+		remainders[i] = exact.Sub(exact, new(big.Rat).SetInt(floor))
+		left -= parts[i]
+	}
+
+	order := make([]int, len(weights))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(a, b int) bool {
+		return remainders[order[a]].Cmp(remainders[order[b]]) > 0
+	})
+	for i := 0; left > 0; i++ {
+		parts[order[i]]++
+		left--
+	}
+
+	return parts
+}
+
+// Simplify returns the transfers that settle all balances, at most one less
+// than the number of members with a non-zero balance in each currency.
+// The largest debt is always paid to the largest creditor first.
+func Simplify(balances []models.Balance) []models.Transfer {
+	byCurrency := make(map[string][]models.Balance)
+	var currencies []string
+	for _, b := range balances {
+		if b.Amount.IsZero() {
+			continue
+		}
+		if _, ok := byCurrency[b.Amount.Currency]; !ok {
+			currencies = append(currencies, b.Amount.Currency)
+		}
+		byCurrency[b.Amount.Currency] = append(byCurrency[b.Amount.Currency], b)
+	}
+	sort.Strings(currencies)
+
+	transfers := []models.Transfer{}
+	for _, currency := range currencies {
+		var creditors, debtors []models.Balance
+		for _, b := range byCurrency[currency] {
+			if b.Amount.IsNegative() {
+				debtors = append(debtors, models.Balance{UserID: b.UserID, Amount: b.Amount.Neg()})
+			} else {
+				creditors = append(creditors, b)
+			}
+		}
+		sortBalances(creditors)
+		sortBalances(debtors)
+
+		for i, j := 0, 0; i < len(debtors) && j < len(creditors); {
+			amount := min(debtors[i].Amount.Amount, creditors[j].Amount.Amount)
+			transfers = append(transfers, models.Transfer{
+				FromUserID: debtors[i].UserID,
+				ToUserID:   creditors[j].UserID,
+				Amount:     money.Money{Amount: amount, Currency: currency},
+			})
+
+			debtors[i].Amount.Amount -= amount
+			creditors[j].Amount.Amount -= amount
+			if debtors[i].Amount.IsZero() {
+				i++
+			}
+			if creditors[j].Amount.IsZero() {
+				j++
+			}
+		}
+	}
+
+	return transfers
+}
+
+// sortBalances orders balances from the largest amount down.
+func sortBalances(balances []models.Balance) {
+	sort.Slice(balances, func(a, b int) bool {
+		if balances[a].Amount.Amount != balances[b].Amount.Amount {
+			return balances[a].Amount.Amount > balances[b].Amount.Amount
+		}
+		return balances[a].UserID < balances[b].UserID
+	})
+}
@@ -0,0 +1,299 @@
+package split
+
+import (
+	"errors"
+	"math/big"
+	"search-job/internal/models"
+	"search-job/internal/pkg/money"
+	"slices"
+	"testing"
+)
+
+func TestAllocate(t *testing.T) {
+	tests := []struct {
+		name    string
+		total   int64
+		weights []int64
+		want    []int64
+	}{
+		{"even", 900, []int64{1, 1, 1}, []int64{300, 300, 300}},
+		{"one cent left goes to the first", 100, []int64{1, 1, 1}, []int64{34, 33, 33}},
+		{"two cents left go to the first two", 200, []int64{1, 1, 1}, []int64{67, 67, 66}},
+		{"largest remainder wins", 100, []int64{1, 2, 4}, []int64{14, 29, 57}},
+		{"zero weight gets nothing", 1001, []int64{0, 1, 1}, []int64{0, 501, 500}},
+		{"single part", 12345, []int64{7}, []int64{12345}},
+		{"nothing to divide", 0, []int64{1, 1}, []int64{0, 0}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			weights := make([]*big.Rat, len(tt.weights))
+			for i, w := range tt.weights {
+				weights[i] = big.NewRat(w, 1)
+			}
+
+			got := allocate(tt.total, weights)
+			if !slices.Equal(got, tt.want) {
+				t.Fatalf("allocate(%d, %v) = %v, want %v", tt.total, tt.weights, got, tt.want)
+			}
+
+			var sum int64
+			for _, part := range got {
+				sum += part
+			}
+			if sum != tt.total {
+				t.Fatalf("parts add up to %d, want %d", sum, tt.total)
+			}
+		})
+	}
+}
+
+func TestShares(t *testing.T) {
+	usd := func(minor int64) money.Money { return money.Money{Amount: minor, Currency: "USD"} }
+
+	tests := []struct {
+		name    string
+		total   money.Money
+		mode    string
+		entries []Entry
+		want    []int64
+		wantErr error
+	}{
+		{
+			name:    "no entries",
+			total:   usd(1000),
+			mode:    ModeEqual,
+			entries: nil,
+			want:    nil,
+		},
+		{
+			name:    "equal with remainder",
+			total:   usd(1000),
+			mode:    ModeEqual,
+			entries: []Entry{{UserID: 1}, {UserID: 2}, {UserID: 3}},
+			want:    []int64{334, 333, 333},
+		},
+		{
+			name:    "equal in a currency without cents",
+			total:   money.Money{Amount: 1000, Currency: "JPY"},
+			mode:    ModeEqual,
+			entries: []Entry{{UserID: 1}, {UserID: 2}, {UserID: 3}},
+			want:    []int64{334, 333, 333},
+		},
+		{
+			name:    "percent",
+			total:   usd(1000),
+			mode:    ModePercent,
+			entries: []Entry{{UserID: 1, Percent: "50"}, {UserID: 2, Percent: "30"}, {UserID: 3, Percent: "20"}},
+			want:    []int64{500, 300, 200},
+		},
+		{
+			name:    "fractional percent with remainder",
+			total:   usd(100),
+			mode:    ModePercent,
+			entries: []Entry{{UserID: 1, Percent: "33.33"}, {UserID: 2, Percent: "33.33"}, {UserID: 3, Percent: "33.34"}},
+			want:    []int64{33, 33, 34},
+		},
+		{
+			name:    "percent below 100",
+			total:   usd(1000),
+			mode:    ModePercent,
+			entries: []Entry{{UserID: 1, Percent: "50"}, {UserID: 2, Percent: "49.99"}},
+			wantErr: ErrPercentSum,
+		},
+		{
+			name:    "percent above 100",
+			total:   usd(1000),
+			mode:    ModePercent,
+			entries: []Entry{{UserID: 1, Percent: "60"}, {UserID: 2, Percent: "40.01"}},
+			wantErr: ErrPercentSum,
+		},
+		{
+			name:    "negative percent",
+			total:   usd(1000),
+			mode:    ModePercent,
+			entries: []Entry{{UserID: 1, Percent: "110"}, {UserID: 2, Percent: "-10"}},
+			wantErr: ErrInvalidShare,
+		},
+		{
+			name:    "exact",
+			total:   usd(1000),
+			mode:    ModeExact,
+			entries: []Entry{{UserID: 1, Amount: "7.50"}, {UserID: 2, Amount: "2.5"}},
+			want:    []int64{750, 250},
+		},
+		{
+			name:    "exact not adding up",
+			total:   usd(1000),
+			mode:    ModeExact,
+			entries: []Entry{{UserID: 1, Amount: "7.50"}, {UserID: 2, Amount: "2.49"}},
+			wantErr: ErrShareSum,
+		},
+		{
+			name:    "exact with too many decimals",
+			total:   usd(1000),
+			mode:    ModeExact,
+			entries: []Entry{{UserID: 1, Amount: "7.505"}, {UserID: 2, Amount: "2.495"}},
+			wantErr: ErrInvalidShare,
+		},
+		{
+			name:    "duplicate participant",
+			total:   usd(1000),
+			mode:    ModeEqual,
+			entries: []Entry{{UserID: 1}, {UserID: 1}},
+			wantErr: ErrDuplicateParticipant,
+		},
+		{
+			name:    "unknown mode",
+			total:   usd(1000),
+			mode:    "weighted",
+			entries: []Entry{{UserID: 1}},
+			wantErr: ErrUnknownMode,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Shares(tt.total, tt.mode, tt.entries)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("error = %v, want %v", err, tt.wantErr)
+			}
+			if tt.wantErr != nil {
+				return
+			}
+
+			if len(got) != len(tt.want) {
+				t.Fatalf("got %d participants, want %d", len(got), len(tt.want))
+			}
+			for i, p := range got {
+				if p.UserID != tt.entries[i].UserID {
+					t.Errorf("participant %d is user %d, want %d", i, p.UserID, tt.entries[i].UserID)
+				}
+				if p.Share != (money.Money{Amount: tt.want[i], Currency: tt.total.Currency}) {
+					t.Errorf("participant %d share = %v, want %d minor units", i, p.Share, tt.want[i])
+				}
+			}
+		})
+	}
+}
+
+func TestRescale(t *testing.T) {
+	share := func(userID, minor int64) models.Participant {
+		return models.Participant{UserID: userID, Share: money.Money{Amount: minor, Currency: "USD"}}
+	}
+
+	tests := []struct {
+		name         string
+		participants []models.Participant
+		total        money.Money
+		want         []int64
+	}{
+		{
+			name:         "keeps proportions",
+			participants: []models.Participant{share(1, 300), share(2, 100)},
+			total:        money.Money{Amount: 1000, Currency: "USD"},
+			want:         []int64{750, 250},
+		},
+		{
+			name:         "distributes the remainder",
+			participants: []models.Participant{share(1, 100), share(2, 100), share(3, 100)},
+			total:        money.Money{Amount: 100, Currency: "USD"},
+			want:         []int64{34, 33, 33},
+		},
+		{
+			name:         "zero shares become equal",
+			participants: []models.Participant{share(1, 0), share(2, 0)},
+			total:        money.Money{Amount: 501, Currency: "EUR"},
+			want:         []int64{251, 250},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := Rescale(tt.participants, tt.total)
+			for i, p := range got {
+				if p.UserID != tt.participants[i].UserID || p.Share != (money.Money{Amount: tt.want[i], Currency: tt.total.Currency}) {
+					t.Errorf("participant %d = %+v, want user %d with %d minor units", i, p, tt.participants[i].UserID, tt.want[i])
+				}
+			}
+		})
+	}
+}
+
+func TestSimplify(t *testing.T) {
+	balance := func(userID, minor int64, currency string) models.Balance {
+		return models.Balance{UserID: userID, Amount: money.Money{Amount: minor, Currency: currency}}
+	}
+	transfer := func(from, to, minor int64, currency string) models.Transfer {
+		return models.Transfer{FromUserID: from, ToUserID: to, Amount: money.Money{Amount: minor, Currency: currency}}
+	}
+
+	tests := []struct {
+		name     string
+		balances []models.Balance
+		want     []models.Transfer
+	}{
+		{
+			name:     "nothing owed",
+			balances: []models.Balance{balance(1, 0, "USD"), balance(2, 0, "USD")},
+			want:     []models.Transfer{},
+		},
+		{
+			name:     "one debt",
+			balances: []models.Balance{balance(1, 500, "USD"), balance(2, -500, "USD")},
+			want:     []models.Transfer{transfer(2, 1, 500, "USD")},
+		},
+		{
+			name: "two debtors pay one creditor",
+			balances: []models.Balance{
+				balance(1, 900, "USD"), balance(2, -300, "USD"), balance(3, -600, "USD"),
+			},
+			want: []models.Transfer{transfer(3, 1, 600, "USD"), transfer(2, 1, 300, "USD")},
+		},
+		{
+			name: "largest debt to largest creditor first",
+			balances: []models.Balance{
+				balance(1, 700, "USD"), balance(2, 300, "USD"),
+				balance(3, -600, "USD"), balance(4, -400, "USD"),
+			},
+			want: []models.Transfer{
+				transfer(3, 1, 600, "USD"),
+				transfer(4, 1, 100, "USD"),
+				transfer(4, 2, 300, "USD"),
+			},
+		},
+		{
+			name: "currencies are settled separately",
+			balances: []models.Balance{
+				balance(1, 100, "USD"), balance(2, -100, "USD"),
+				balance(1, -50, "EUR"), balance(2, 50, "EUR"),
+			},
+			want: []models.Transfer{transfer(1, 2, 50, "EUR"), transfer(2, 1, 100, "USD")},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := Simplify(tt.balances)
+			if !slices.Equal(got, tt.want) {
+				t.Fatalf("Simplify() = %+v, want %+v", got, tt.want)
+			}
+
+			nonZero := map[string]int{}
+			for _, b := range tt.balances {
+				if !b.Amount.IsZero() {
+					nonZero[b.Amount.Currency]++
+				}
+			}
+			perCurrency := map[string]int{}
+			for _, tr := range got {
+				perCurrency[tr.Amount.Currency]++
+			}
+			for currency, n := range perCurrency {
+				if n > nonZero[currency]-1 {
+					t.Errorf("%d transfers in %s for %d members with a balance", n, currency, nonZero[currency])
+				}
+			}
+		})
+	}
+}
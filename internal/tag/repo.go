@@ -0,0 +1,253 @@
+package tag
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"search-job/internal/ledger"
+	"search-job/internal/models"
+	"search-job/internal/pkg/apperr"
+	"strings"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// MaxNameLength is the longest tag name in characters.
+const MaxNameLength = 50
+
+var (
+	ErrInvalidName   = apperr.Validation("tag_invalid_name", "invalid tag name")
+	ErrDuplicateName = apperr.Conflict("tag_name_taken", "tag with this name already exists")
+)
+
+type Repo struct {
+	db *pgxpool.Pool
+}
+
+func NewRepo(db *pgxpool.Pool) *Repo {
+	return &Repo{db: db}
+}
+
+// Create adds the tag to its ledger. ledger.ErrForbidden is returned
+// unless the user may write to it.
+func (r *Repo) Create(ctx context.Context, tag *models.Tag) error {
+	query := fmt.Sprintf(`
+		INSERT INTO tags (ledger_id, user_id, name, created_at, updated_at)
+		SELECT $1, $2, $3, NOW(), NOW()
+		WHERE %s
+		RETURNING id, created_at, updated_at
+	`, ledger.AccessCondition("$1", "$2", ledger.Write))
+
+	err := r.db.QueryRow(ctx, query, tag.LedgerID, tag.UserID, tag.Name).Scan(&tag.ID, &tag.CreatedAt, &tag.UpdatedAt)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return ledger.ErrForbidden
+	}
+	return duplicateName(err)
+}
+
+// GetAll returns the tags of the ledger with the number of its live
+// expenses that carry them, if the user is a member of it.
+func (r *Repo) GetAll(ctx context.Context, ledgerID, userID int64) ([]models.Tag, error) {
+	query := fmt.Sprintf(`
+		SELECT t.id, t.ledger_id, t.user_id, t.name, t.created_at, t.updated_at,
+		       COUNT(e.id)
+		FROM tags t
+		LEFT JOIN expense_tags et ON et.tag_id = t.id
+		LEFT JOIN expenses e ON e.id = et.expense_id AND e.deleted_at IS NULL
+		WHERE t.ledger_id = $1 AND %s
+		GROUP BY t.id
+		ORDER BY lower(t.name)
+	`, ledger.AccessCondition("t.ledger_id", "$2", ledger.Read))
+
+	rows, err := r.db.Query(ctx, query, ledgerID, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var tags []models.Tag
+	for rows.Next() {
+		var t models.Tag
+		if err := rows.Scan(&t.ID, &t.LedgerID, &t.UserID, &t.Name, &t.CreatedAt, &t.UpdatedAt, &t.Expenses); err != nil {
+			return nil, err
+		}
+		tags = append(tags, t)
+	}
+
+	return tags, rows.Err()
+}
+
+func (r *Repo) GetByID(ctx context.Context, id, userID int64) (*models.Tag, error) {
+	return getByID(ctx, r.db, id, userID, ledger.Read)
+}
+
+type querier interface {
+	QueryRow(ctx context.Context, sql string, args ...any) pgx.Row
+}
+
+// getByID reads a tag of a ledger the user is a member of and returns
+// ledger.ErrForbidden if the member lacks the access. Inside a transaction
+// the row stays locked until it ends.
+func getByID(ctx context.Context, q querier, id, userID int64, access ledger.Access) (*models.Tag, error) {
+	lock := ""
+	if _, ok := q.(pgx.Tx); ok {
+		lock = "FOR UPDATE"
+	}
+
+	query := fmt.Sprintf(`
+		SELECT id, ledger_id, user_id, name, created_at, updated_at, %s
+		FROM tags
+		WHERE id = $1 AND %s
+		%s
+	`,
+		ledger.AccessCondition("tags.ledger_id", "$2", access),
+		ledger.AccessCondition("tags.ledger_id", "$2", ledger.Read),
+		lock)
+
+	var t models.Tag
+	var allowed bool
+	err := q.QueryRow(ctx, query, id, userID).Scan(&t.ID, &t.LedgerID, &t.UserID, &t.Name, &t.CreatedAt, &t.UpdatedAt, &allowed)
+	if err != nil {
+		return nil, err
+	}
+	if !allowed {
+		return nil, ledger.ErrForbidden
+	}
+
+	return &t, nil
+}
+
+// Update renames the tag. userID is the member renaming it, not
+// necessarily the author.
+func (r *Repo) Update(ctx context.Context, tag *models.Tag, userID int64) error {
+	tx, err := r.db.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	if _, err := getByID(ctx, tx, tag.ID, userID, ledger.Write); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return sql.ErrNoRows
+		}
+		return err
+	}
+
+	query := `
+		UPDATE tags
+		SET name = $1, updated_at = NOW()
+		WHERE id = $2
+		RETURNING updated_at
+	`
+
+	if err := tx.QueryRow(ctx, query, tag.Name, tag.ID).Scan(&tag.UpdatedAt); err != nil {
+		return duplicateName(err)
+	}
+
+	return tx.Commit(ctx)
+}
+
+// Delete removes the tag from all expenses. Unlike categories tags are not
+// kept around after deletion.
+func (r *Repo) Delete(ctx context.Context, id, userID int64) error {
+	tx, err := r.db.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	if _, err := getByID(ctx, tx, id, userID, ledger.Write); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return sql.ErrNoRows
+		}
+		return err
+	}
+
+	if _, err := tx.Exec(ctx, `DELETE FROM tags WHERE id = $1`, id); err != nil {
+		return err
+	}
+
+	return tx.Commit(ctx)
+}
+
+// Assign replaces the tags of an expense with names, creating the tags the
+// ledger does not have yet. It is meant to run in the transaction that
+// writes the expense; ledger.ErrForbidden is returned unless userID may
+// write to the ledger.
+func Assign(ctx context.Context, tx pgx.Tx, ledgerID, userID, expenseID int64, names []string) error {
+	var allowed bool
+	err := tx.QueryRow(ctx, `SELECT `+ledger.AccessCondition("$1", "$2", ledger.Write), ledgerID, userID).Scan(&allowed)
+	if err != nil {
+		return err
+	}
+	if !allowed {
+		return ledger.ErrForbidden
+	}
+
+	if _, err := tx.Exec(ctx, `DELETE FROM expense_tags WHERE expense_id = $1`, expenseID); err != nil {
+		return err
+	}
+	if len(names) == 0 {
+		return nil
+	}
+
+	_, err = tx.Exec(ctx, `
+		INSERT INTO tags (ledger_id, user_id, name, created_at, updated_at)
+		SELECT $1, $2, name, NOW(), NOW() FROM unnest($3::text[]) AS name
+		ON CONFLICT (ledger_id, lower(name)) DO NOTHING
+	`, ledgerID, userID, names)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(ctx, `
+		INSERT INTO expense_tags (expense_id, tag_id)
+		SELECT $1, id FROM tags
+		WHERE ledger_id = $2 AND lower(name) = ANY($3::text[])
+	`, expenseID, ledgerID, Keys(names))
+
+	return err
+}
+
+// Normalize trims names and drops empty and case insensitive duplicate
+// ones, keeping the first spelling.
+func Normalize(names []string) ([]string, error) {
+	seen := make(map[string]bool, len(names))
+	result := make([]string, 0, len(names))
+	for _, name := range names {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			continue
+		}
+		if len([]rune(name)) > MaxNameLength {
+			return nil, ErrInvalidName
+		}
+		key := strings.ToLower(name)
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+		result = append(result, name)
+	}
+	return result, nil
+}
+
+// Keys returns the lowercased names used for case insensitive matching.
+func Keys(names []string) []string {
+	keys := make([]string, len(names))
+	for i, name := range names {
+		keys[i] = strings.ToLower(strings.TrimSpace(name))
+	}
+	return keys
+}
+
+func duplicateName(err error) error {
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) && pgErr.Code == "23505" {
+		return ErrDuplicateName
+	}
+	return err
+}
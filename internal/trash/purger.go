@@ -0,0 +1,71 @@
+package trash
+
+import (
+	"context"
+	"errors"
+	"search-job/internal/pkg/storage"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/labstack/gommon/log"
+)
+
+const DefaultPurgeInterval = time.Hour
+
+// Purger periodically empties the trash of items older than the retention
+// period.
+type Purger struct {
+	repo      *Repo
+	blobs     storage.Storage
+	logger    *log.Logger
+	retention time.Duration
+	interval  time.Duration
+}
+
+func NewPurger(db *pgxpool.Pool, blobs storage.Storage, logger *log.Logger, retention, interval time.Duration) *Purger {
+	if interval <= 0 {
+		interval = DefaultPurgeInterval
+	}
+
+	return &Purger{
+		repo:      NewRepo(db),
+		blobs:     blobs,
+		logger:    logger,
+		retention: retention,
+		interval:  interval,
+	}
+}
+
+// Run blocks until ctx is cancelled.
+func (p *Purger) Run(ctx context.Context) {
+	ticker := time.NewTicker(p.interval)
+	defer ticker.Stop()
+
+	for {
+		p.runOnce(ctx)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (p *Purger) runOnce(ctx context.Context) {
+	expenses, categories, keys, err := p.repo.Purge(ctx, time.Now().Add(-p.retention))
+	if err != nil {
+		p.logger.Errorf("trash: %v", err)
+		return
+	}
+
+	for _, key := range keys {
+		if err := p.blobs.Delete(ctx, key); err != nil && !errors.Is(err, storage.ErrNotFound) {
+			p.logger.Errorf("trash: deleting attachment %s: %v", key, err)
+		}
+	}
+
+	if expenses > 0 || categories > 0 {
+		p.logger.Infof("trash: purged %d expenses, %d categories", expenses, categories)
+	}
+}
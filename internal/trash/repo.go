@@ -0,0 +1,155 @@
+package trash
+
+import (
+	"context"
+	"fmt"
+	"search-job/internal/ledger"
+	"search-job/internal/models"
+	"search-job/internal/pkg/money"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+const (
+	TypeExpense  = "expense"
+	TypeCategory = "category"
+)
+
+type Repo struct {
+	db *pgxpool.Pool
+}
+
+func NewRepo(db *pgxpool.Pool) *Repo {
+	return &Repo{db: db}
+}
+
+// List returns the deleted expenses and categories of a ledger the user is
+// a member of, most recently deleted first. itemType limits the result to
+// one kind when not empty. Categories deleted together with their parent
+// are not listed, since restoring the parent brings them back.
+func (r *Repo) List(ctx context.Context, ledgerID, userID int64, itemType string, limit, offset int) ([]models.TrashItem, int, error) {
+	parts := map[string]string{
+		TypeExpense: `
+			SELECT 'expense' AS type, e.id, e.comment AS name, e.amount, e.currency, e.deleted_at
+			FROM expenses e
+			WHERE e.ledger_id = $1 AND e.deleted_at IS NOT NULL`,
+		TypeCategory: `
+			SELECT 'category', c.id, c.name, NULL::numeric, NULL::varchar, c.deleted_at
+			FROM categories c
+			LEFT JOIN categories p ON p.id = c.parent_id
+			WHERE c.ledger_id = $1 AND c.deleted_at IS NOT NULL
+			  AND (p.deleted_at IS NULL OR p.deleted_at <> c.deleted_at)`,
+	}
+
+	var union string
+	switch itemType {
+	case TypeExpense, TypeCategory:
+		union = parts[itemType]
+	default:
+		union = parts[TypeExpense] + " UNION ALL " + parts[TypeCategory]
+	}
+	access := ledger.AccessCondition("$1", "$2", ledger.Read)
+
+	var total int
+	err := r.db.QueryRow(ctx, fmt.Sprintf("SELECT COUNT(*) FROM (%s) t WHERE %s", union, access), ledgerID, userID).Scan(&total)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	query := fmt.Sprintf(`
+		SELECT * FROM (%s) t
+		WHERE %s
+		ORDER BY deleted_at DESC, type, id DESC
+		LIMIT $3 OFFSET $4
+	`, union, access)
+
+	rows, err := r.db.Query(ctx, query, ledgerID, userID, limit, offset)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+
+	items := []models.TrashItem{}
+	for rows.Next() {
+		var item models.TrashItem
+		var amount pgtype.Numeric
+		var currency *string
+		if err := rows.Scan(&item.Type, &item.ID, &item.Name, &amount, &currency, &item.DeletedAt); err != nil {
+			return nil, 0, err
+		}
+		if currency != nil {
+			m, err := money.FromNumeric(amount, *currency)
+			if err != nil {
+				return nil, 0, fmt.Errorf("expense %d: %w", item.ID, err)
+			}
+			item.Amount = &m
+		}
+		items = append(items, item)
+	}
+
+	return items, total, rows.Err()
+}
+
+// Purge permanently deletes expenses and categories that have been in the
+// trash since before cutoff. It returns the storage keys of the
+// attachments removed with the expenses; the objects themselves are left
+// to the caller.
+func (r *Repo) Purge(ctx context.Context, cutoff time.Time) (expenses, categories int64, keys []string, err error) {
+	tx, err := r.db.Begin(ctx)
+	if err != nil {
+		return 0, 0, nil, err
+	}
+	defer tx.Rollback(ctx)
+
+	rows, err := tx.Query(ctx, `
+		DELETE FROM attachments
+		WHERE expense_id IN (SELECT id FROM expenses WHERE deleted_at < $1)
+		RETURNING storage_key
+	`, cutoff)
+	if err != nil {
+		return 0, 0, nil, err
+	}
+	for rows.Next() {
+		var key string
+		if err := rows.Scan(&key); err != nil {
+			rows.Close()
+			return 0, 0, nil, err
+		}
+		keys = append(keys, key)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, 0, nil, err
+	}
+
+	result, err := tx.Exec(ctx, `DELETE FROM expenses WHERE deleted_at < $1`, cutoff)
+	if err != nil {
+		return 0, 0, nil, err
+	}
+	expenses = result.RowsAffected()
+
+	// children that are kept (live, or deleted later) must not reference a
+	// purged parent
+	_, err = tx.Exec(ctx, `
+		UPDATE categories SET parent_id = NULL
+		WHERE parent_id IN (SELECT id FROM categories WHERE deleted_at < $1)
+		  AND (deleted_at IS NULL OR deleted_at >= $1)
+	`, cutoff)
+	if err != nil {
+		return 0, 0, nil, err
+	}
+
+	result, err = tx.Exec(ctx, `DELETE FROM categories WHERE deleted_at < $1`, cutoff)
+	if err != nil {
+		return 0, 0, nil, err
+	}
+	categories = result.RowsAffected()
+
+	if err := tx.Commit(ctx); err != nil {
+		return 0, 0, nil, err
+	}
+
+	return expenses, categories, keys, nil
+}
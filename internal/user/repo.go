@@ -2,11 +2,19 @@ package user
 
 import (
 	"context"
+	"database/sql"
+	"errors"
+	"search-job/internal/ledger"
 	"search-job/internal/models"
+	"search-job/internal/pkg/apperr"
+	"time"
 
+	"github.com/jackc/pgx/v5/pgconn"
 	"github.com/jackc/pgx/v5/pgxpool"
 )
 
+var ErrEmailTaken = apperr.Conflict("email_taken", "user with this email already exists")
+
 type Repo struct {
 	db *pgxpool.Pool
 }
@@ -15,28 +23,49 @@ func NewRepo(db *pgxpool.Pool) *Repo {
 	return &Repo{db: db}
 }
 
+// Create stores a new user together with their personal ledger.
+// ErrEmailTaken is returned if the email is registered already.
 func (r *Repo) Create(ctx context.Context, user *models.User) error {
+	tx, err := r.db.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
 	query := `
 		INSERT INTO users (email, password_hash, created_at, updated_at)
 		VALUES ($1, $2, NOW(), NOW())
-		RETURNING id, created_at, updated_at
+		RETURNING id, base_currency, timezone, created_at, updated_at
 	`
 
-	return r.db.QueryRow(ctx, query, user.Email, user.PasswordHash).Scan(
-		&user.ID, &user.CreatedAt, &user.UpdatedAt,
+	err = tx.QueryRow(ctx, query, user.Email, user.PasswordHash).Scan(
+		&user.ID, &user.BaseCurrency, &user.Timezone, &user.CreatedAt, &user.UpdatedAt,
 	)
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) && pgErr.Code == "23505" {
+		return ErrEmailTaken
+	}
+	if err != nil {
+		return err
+	}
+
+	if err := ledger.CreateDefault(ctx, tx, user.ID); err != nil {
+		return err
+	}
+
+	return tx.Commit(ctx)
 }
 
 func (r *Repo) GetByEmail(ctx context.Context, email string) (*models.User, error) {
 	query := `
-		SELECT id, email, password_hash, created_at, updated_at
+		SELECT id, email, password_hash, base_currency, timezone, created_at, updated_at
 		FROM users
 		WHERE email = $1
 	`
 
 	var user models.User
 	err := r.db.QueryRow(ctx, query, email).Scan(
-		&user.ID, &user.Email, &user.PasswordHash, &user.CreatedAt, &user.UpdatedAt,
+		&user.ID, &user.Email, &user.PasswordHash, &user.BaseCurrency, &user.Timezone, &user.CreatedAt, &user.UpdatedAt,
 	)
 	if err != nil {
 		return nil, err
@@ -44,3 +73,51 @@ func (r *Repo) GetByEmail(ctx context.Context, email string) (*models.User, erro
 
 	return &user, nil
 }
+
+func (r *Repo) GetByID(ctx context.Context, id int64) (*models.User, error) {
+	query := `
+		SELECT id, email, password_hash, base_currency, timezone, created_at, updated_at
+		FROM users
+		WHERE id = $1
+	`
+
+	var user models.User
+	err := r.db.QueryRow(ctx, query, id).Scan(
+		&user.ID, &user.Email, &user.PasswordHash, &user.BaseCurrency, &user.Timezone, &user.CreatedAt, &user.UpdatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return &user, nil
+}
+
+func (r *Repo) UpdateSettings(ctx context.Context, user *models.User) error {
+	query := `
+		UPDATE users
+		SET base_currency = $1, timezone = $2, updated_at = NOW()
+		WHERE id = $3
+	`
+
+	result, err := r.db.Exec(ctx, query, user.BaseCurrency, user.Timezone, user.ID)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected := result.RowsAffected()
+	if rowsAffected == 0 {
+		return sql.ErrNoRows
+	}
+
+	return nil
+}
+
+// Location returns the time zone of the user, falling back to UTC for
+// names the server does not know.
+func Location(user *models.User) *time.Location {
+	loc, err := time.LoadLocation(user.Timezone)
+	if err != nil {
+		return time.UTC
+	}
+	return loc
+}
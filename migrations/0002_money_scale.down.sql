@@ -0,0 +1 @@
+ALTER TABLE expenses ALTER COLUMN amount TYPE DECIMAL(10,2);
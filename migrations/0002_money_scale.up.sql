@@ -0,0 +1,2 @@
+-- Суммы хранятся с точностью до 4 знаков, чтобы вместить валюты вроде BHD и CLF
+ALTER TABLE expenses ALTER COLUMN amount TYPE NUMERIC(18,4);
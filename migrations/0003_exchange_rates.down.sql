@@ -0,0 +1,2 @@
+ALTER TABLE users DROP COLUMN IF EXISTS base_currency;
+DROP TABLE IF EXISTS exchange_rates;
@@ -0,0 +1,9 @@
+-- Курсы валют относительно EUR (как в справочнике ЕЦБ)
+CREATE TABLE IF NOT EXISTS exchange_rates (
+    rate_date DATE NOT NULL,
+    currency VARCHAR(3) NOT NULL,
+    rate NUMERIC(20,10) NOT NULL CHECK (rate > 0),
+    PRIMARY KEY (currency, rate_date)
+);
+
+ALTER TABLE users ADD COLUMN IF NOT EXISTS base_currency VARCHAR(3) NOT NULL DEFAULT 'EUR';
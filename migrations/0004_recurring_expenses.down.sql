@@ -0,0 +1,5 @@
+DROP INDEX IF EXISTS idx_expenses_recurring_occurrence;
+ALTER TABLE expenses DROP COLUMN IF EXISTS occurrence_at;
+ALTER TABLE expenses DROP COLUMN IF EXISTS recurring_id;
+DROP TABLE IF EXISTS recurring_expense_skips;
+DROP TABLE IF EXISTS recurring_expenses;
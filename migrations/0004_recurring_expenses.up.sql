@@ -0,0 +1,32 @@
+-- Шаблоны повторяющихся расходов
+CREATE TABLE IF NOT EXISTS recurring_expenses (
+    id BIGSERIAL PRIMARY KEY,
+    user_id BIGINT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    category_id BIGINT REFERENCES categories(id) ON DELETE SET NULL,
+    amount NUMERIC(18,4) NOT NULL,
+    currency VARCHAR(3) NOT NULL,
+    comment TEXT,
+    rrule VARCHAR(255) NOT NULL,
+    start_at TIMESTAMPTZ NOT NULL,
+    paused BOOLEAN NOT NULL DEFAULT FALSE,
+    next_index INT NOT NULL DEFAULT 0,
+    next_occurrence_at TIMESTAMPTZ,
+    created_at TIMESTAMPTZ DEFAULT NOW(),
+    updated_at TIMESTAMPTZ DEFAULT NOW(),
+    deleted_at TIMESTAMPTZ
+);
+
+-- Пропущенные пользователем повторения
+CREATE TABLE IF NOT EXISTS recurring_expense_skips (
+    recurring_id BIGINT NOT NULL REFERENCES recurring_expenses(id) ON DELETE CASCADE,
+    occurrence_at TIMESTAMPTZ NOT NULL,
+    PRIMARY KEY (recurring_id, occurrence_at)
+);
+
+ALTER TABLE expenses ADD COLUMN IF NOT EXISTS recurring_id BIGINT REFERENCES recurring_expenses(id) ON DELETE SET NULL;
+ALTER TABLE expenses ADD COLUMN IF NOT EXISTS occurrence_at TIMESTAMPTZ;
+
+CREATE INDEX IF NOT EXISTS idx_recurring_expenses_user_id ON recurring_expenses(user_id);
+CREATE INDEX IF NOT EXISTS idx_recurring_expenses_due ON recurring_expenses(next_occurrence_at)
+    WHERE deleted_at IS NULL AND NOT paused;
+CREATE UNIQUE INDEX IF NOT EXISTS idx_expenses_recurring_occurrence ON expenses(recurring_id, occurrence_at);
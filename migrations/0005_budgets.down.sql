@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS budgets;
+ALTER TABLE users DROP COLUMN IF EXISTS timezone;
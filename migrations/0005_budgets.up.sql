@@ -0,0 +1,18 @@
+ALTER TABLE users ADD COLUMN IF NOT EXISTS timezone VARCHAR(64) NOT NULL DEFAULT 'UTC';
+
+-- Бюджеты: по категории или общий (category_id IS NULL)
+CREATE TABLE IF NOT EXISTS budgets (
+    id BIGSERIAL PRIMARY KEY,
+    user_id BIGINT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    category_id BIGINT REFERENCES categories(id) ON DELETE CASCADE,
+    amount NUMERIC(18,4) NOT NULL CHECK (amount > 0),
+    currency VARCHAR(3) NOT NULL,
+    period VARCHAR(10) NOT NULL CHECK (period IN ('week', 'month', 'year')),
+    rollover BOOLEAN NOT NULL DEFAULT FALSE,
+    created_at TIMESTAMPTZ DEFAULT NOW(),
+    updated_at TIMESTAMPTZ DEFAULT NOW(),
+    deleted_at TIMESTAMPTZ
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_budgets_scope ON budgets(user_id, COALESCE(category_id, 0), period)
+    WHERE deleted_at IS NULL;
@@ -0,0 +1,9 @@
+-- Вложенные категории
+ALTER TABLE categories ADD COLUMN IF NOT EXISTS parent_id BIGINT REFERENCES categories(id);
+
+CREATE INDEX IF NOT EXISTS idx_categories_parent_id ON categories(parent_id);
+
+-- Имя уникально среди соседей, удалённые категории не мешают создать новую
+ALTER TABLE categories DROP CONSTRAINT IF EXISTS categories_user_id_name_key;
+CREATE UNIQUE INDEX IF NOT EXISTS idx_categories_sibling_name ON categories(user_id, COALESCE(parent_id, 0), name)
+    WHERE deleted_at IS NULL;
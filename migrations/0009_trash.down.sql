@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS idx_categories_trash;
+DROP INDEX IF EXISTS idx_expenses_trash;
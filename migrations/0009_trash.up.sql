@@ -0,0 +1,3 @@
+-- Корзина: выборка удалённых записей и их очистка по сроку хранения
+CREATE INDEX IF NOT EXISTS idx_expenses_trash ON expenses(user_id, deleted_at) WHERE deleted_at IS NOT NULL;
+CREATE INDEX IF NOT EXISTS idx_categories_trash ON categories(user_id, deleted_at) WHERE deleted_at IS NOT NULL;
@@ -0,0 +1,30 @@
+DROP INDEX IF EXISTS idx_categories_purge;
+DROP INDEX IF EXISTS idx_expenses_purge;
+DROP INDEX IF EXISTS idx_categories_trash;
+DROP INDEX IF EXISTS idx_expenses_trash;
+CREATE INDEX IF NOT EXISTS idx_expenses_trash ON expenses(user_id, deleted_at) WHERE deleted_at IS NOT NULL;
+CREATE INDEX IF NOT EXISTS idx_categories_trash ON categories(user_id, deleted_at) WHERE deleted_at IS NOT NULL;
+
+DROP INDEX IF EXISTS idx_categories_sibling_name;
+CREATE UNIQUE INDEX IF NOT EXISTS idx_categories_sibling_name ON categories(user_id, COALESCE(parent_id, 0), name)
+    WHERE deleted_at IS NULL;
+DROP INDEX IF EXISTS idx_tags_ledger_name;
+CREATE UNIQUE INDEX IF NOT EXISTS idx_tags_user_name ON tags(user_id, lower(name));
+DROP INDEX IF EXISTS idx_budgets_scope;
+CREATE UNIQUE INDEX IF NOT EXISTS idx_budgets_scope ON budgets(user_id, COALESCE(category_id, 0), period)
+    WHERE deleted_at IS NULL;
+
+DROP INDEX IF EXISTS idx_audit_events_ledger_id;
+DROP INDEX IF EXISTS idx_expenses_ledger_id;
+DROP INDEX IF EXISTS idx_categories_ledger_id;
+
+ALTER TABLE audit_events DROP COLUMN IF EXISTS ledger_id;
+ALTER TABLE tags DROP COLUMN IF EXISTS ledger_id;
+ALTER TABLE budgets DROP COLUMN IF EXISTS ledger_id;
+ALTER TABLE recurring_expenses DROP COLUMN IF EXISTS ledger_id;
+ALTER TABLE expenses DROP COLUMN IF EXISTS ledger_id;
+ALTER TABLE categories DROP COLUMN IF EXISTS ledger_id;
+
+DROP TABLE IF EXISTS ledger_invitations;
+DROP TABLE IF EXISTS ledger_members;
+DROP TABLE IF EXISTS ledgers;
@@ -0,0 +1,94 @@
+-- Общие книги учёта: категории и расходы принадлежат книге, а не пользователю
+CREATE TABLE IF NOT EXISTS ledgers (
+    id BIGSERIAL PRIMARY KEY,
+    name VARCHAR(100) NOT NULL,
+    created_by BIGINT REFERENCES users(id) ON DELETE SET NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE TABLE IF NOT EXISTS ledger_members (
+    ledger_id BIGINT NOT NULL REFERENCES ledgers(id) ON DELETE CASCADE,
+    user_id BIGINT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    role VARCHAR(10) NOT NULL CHECK (role IN ('owner', 'editor', 'viewer')),
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (ledger_id, user_id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_ledger_members_user_id ON ledger_members(user_id);
+
+-- Приглашения хранят только хэш токена
+CREATE TABLE IF NOT EXISTS ledger_invitations (
+    id BIGSERIAL PRIMARY KEY,
+    ledger_id BIGINT NOT NULL REFERENCES ledgers(id) ON DELETE CASCADE,
+    email VARCHAR(255) NOT NULL,
+    role VARCHAR(10) NOT NULL CHECK (role IN ('owner', 'editor', 'viewer')),
+    token_hash VARCHAR(64) UNIQUE NOT NULL,
+    invited_by BIGINT REFERENCES users(id) ON DELETE SET NULL,
+    expires_at TIMESTAMPTZ NOT NULL,
+    accepted_at TIMESTAMPTZ,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_ledger_invitations_ledger_id ON ledger_invitations(ledger_id);
+
+-- Каждый существующий пользователь получает личную книгу со своими данными
+INSERT INTO ledgers (name, created_by, created_at, updated_at)
+SELECT 'Personal', u.id, NOW(), NOW()
+FROM users u
+WHERE NOT EXISTS (SELECT 1 FROM ledger_members m WHERE m.user_id = u.id);
+
+INSERT INTO ledger_members (ledger_id, user_id, role, created_at)
+SELECT l.id, l.created_by, 'owner', NOW()
+FROM ledgers l
+WHERE NOT EXISTS (SELECT 1 FROM ledger_members m WHERE m.ledger_id = l.id);
+
+ALTER TABLE categories ADD COLUMN IF NOT EXISTS ledger_id BIGINT REFERENCES ledgers(id) ON DELETE CASCADE;
+ALTER TABLE expenses ADD COLUMN IF NOT EXISTS ledger_id BIGINT REFERENCES ledgers(id) ON DELETE CASCADE;
+ALTER TABLE recurring_expenses ADD COLUMN IF NOT EXISTS ledger_id BIGINT REFERENCES ledgers(id) ON DELETE CASCADE;
+ALTER TABLE budgets ADD COLUMN IF NOT EXISTS ledger_id BIGINT REFERENCES ledgers(id) ON DELETE CASCADE;
+ALTER TABLE tags ADD COLUMN IF NOT EXISTS ledger_id BIGINT REFERENCES ledgers(id) ON DELETE CASCADE;
+ALTER TABLE audit_events ADD COLUMN IF NOT EXISTS ledger_id BIGINT;
+
+UPDATE categories c SET ledger_id = l.id FROM ledgers l WHERE l.created_by = c.user_id AND c.ledger_id IS NULL;
+UPDATE expenses e SET ledger_id = l.id FROM ledgers l WHERE l.created_by = e.user_id AND e.ledger_id IS NULL;
+UPDATE recurring_expenses r SET ledger_id = l.id FROM ledgers l WHERE l.created_by = r.user_id AND r.ledger_id IS NULL;
+UPDATE budgets b SET ledger_id = l.id FROM ledgers l WHERE l.created_by = b.user_id AND b.ledger_id IS NULL;
+UPDATE tags t SET ledger_id = l.id FROM ledgers l WHERE l.created_by = t.user_id AND t.ledger_id IS NULL;
+
+-- журнал защищён от изменений, поэтому триггер отключается на время заполнения
+ALTER TABLE audit_events DISABLE TRIGGER audit_events_append_only;
+UPDATE audit_events a SET ledger_id = l.id FROM ledgers l WHERE l.created_by = a.user_id AND a.ledger_id IS NULL;
+ALTER TABLE audit_events ENABLE TRIGGER audit_events_append_only;
+
+ALTER TABLE categories ALTER COLUMN ledger_id SET NOT NULL;
+ALTER TABLE expenses ALTER COLUMN ledger_id SET NOT NULL;
+ALTER TABLE recurring_expenses ALTER COLUMN ledger_id SET NOT NULL;
+ALTER TABLE budgets ALTER COLUMN ledger_id SET NOT NULL;
+ALTER TABLE tags ALTER COLUMN ledger_id SET NOT NULL;
+
+CREATE INDEX IF NOT EXISTS idx_categories_ledger_id ON categories(ledger_id);
+CREATE INDEX IF NOT EXISTS idx_expenses_ledger_id ON expenses(ledger_id);
+CREATE INDEX IF NOT EXISTS idx_audit_events_ledger_id ON audit_events(ledger_id);
+
+-- Имена категорий уникальны среди соседей внутри книги
+DROP INDEX IF EXISTS idx_categories_sibling_name;
+CREATE UNIQUE INDEX IF NOT EXISTS idx_categories_sibling_name ON categories(ledger_id, COALESCE(parent_id, 0), name)
+    WHERE deleted_at IS NULL;
+
+-- Бюджеты общие для участников книги
+DROP INDEX IF EXISTS idx_budgets_scope;
+CREATE UNIQUE INDEX IF NOT EXISTS idx_budgets_scope ON budgets(ledger_id, COALESCE(category_id, 0), period)
+    WHERE deleted_at IS NULL;
+
+-- Теги общие для участников книги
+DROP INDEX IF EXISTS idx_tags_user_name;
+CREATE UNIQUE INDEX IF NOT EXISTS idx_tags_ledger_name ON tags(ledger_id, lower(name));
+
+-- Корзина выбирается по книге, а очистка идёт только по сроку хранения
+DROP INDEX IF EXISTS idx_expenses_trash;
+DROP INDEX IF EXISTS idx_categories_trash;
+CREATE INDEX IF NOT EXISTS idx_expenses_trash ON expenses(ledger_id, deleted_at) WHERE deleted_at IS NOT NULL;
+CREATE INDEX IF NOT EXISTS idx_categories_trash ON categories(ledger_id, deleted_at) WHERE deleted_at IS NOT NULL;
+CREATE INDEX IF NOT EXISTS idx_expenses_purge ON expenses(deleted_at) WHERE deleted_at IS NOT NULL;
+CREATE INDEX IF NOT EXISTS idx_categories_purge ON categories(deleted_at) WHERE deleted_at IS NOT NULL;
@@ -0,0 +1,26 @@
+-- Участники общего расхода и их доли. Платит автор расхода
+CREATE TABLE IF NOT EXISTS expense_participants (
+    expense_id BIGINT NOT NULL REFERENCES expenses(id) ON DELETE CASCADE,
+    user_id BIGINT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    share NUMERIC(18,4) NOT NULL,
+    PRIMARY KEY (expense_id, user_id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_expense_participants_user_id ON expense_participants(user_id);
+
+-- Погашения долгов: from_user_id перевёл сумму to_user_id
+CREATE TABLE IF NOT EXISTS settlements (
+    id BIGSERIAL PRIMARY KEY,
+    ledger_id BIGINT NOT NULL REFERENCES ledgers(id) ON DELETE CASCADE,
+    from_user_id BIGINT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    to_user_id BIGINT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    amount NUMERIC(18,4) NOT NULL CHECK (amount > 0),
+    currency VARCHAR(3) NOT NULL,
+    settled_at TIMESTAMPTZ NOT NULL,
+    comment TEXT,
+    created_by BIGINT REFERENCES users(id) ON DELETE SET NULL,
+    created_at TIMESTAMPTZ DEFAULT NOW(),
+    CHECK (from_user_id <> to_user_id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_settlements_ledger_id ON settlements(ledger_id, settled_at);
@@ -0,0 +1,12 @@
+-- Разбивка одного расхода по нескольким категориям. У расхода с разбивкой
+-- собственная категория не задана, а суммы строк в сумме дают сумму расхода
+CREATE TABLE IF NOT EXISTS expense_allocations (
+    id BIGSERIAL PRIMARY KEY,
+    expense_id BIGINT NOT NULL REFERENCES expenses(id) ON DELETE CASCADE,
+    category_id BIGINT REFERENCES categories(id) ON DELETE SET NULL,
+    amount NUMERIC(18,4) NOT NULL,
+    comment TEXT
+);
+
+CREATE INDEX IF NOT EXISTS idx_expense_allocations_expense_id ON expense_allocations(expense_id);
+CREATE INDEX IF NOT EXISTS idx_expense_allocations_category_id ON expense_allocations(category_id);
@@ -0,0 +1,9 @@
+DROP INDEX IF EXISTS idx_categories_sibling_name;
+DROP INDEX IF EXISTS idx_expenses_ledger_kind;
+
+ALTER TABLE categories DROP COLUMN IF EXISTS kind;
+ALTER TABLE recurring_expenses DROP COLUMN IF EXISTS kind;
+ALTER TABLE expenses DROP COLUMN IF EXISTS kind;
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_categories_sibling_name ON categories(ledger_id, COALESCE(parent_id, 0), name)
+    WHERE deleted_at IS NULL;
@@ -0,0 +1,15 @@
+-- Доходы хранятся вместе с расходами и отличаются видом операции
+ALTER TABLE expenses ADD COLUMN IF NOT EXISTS kind VARCHAR(10) NOT NULL DEFAULT 'expense'
+    CONSTRAINT expenses_kind_check CHECK (kind IN ('expense', 'income'));
+ALTER TABLE recurring_expenses ADD COLUMN IF NOT EXISTS kind VARCHAR(10) NOT NULL DEFAULT 'expense'
+    CONSTRAINT recurring_expenses_kind_check CHECK (kind IN ('expense', 'income'));
+
+-- Категории доходов и расходов живут в отдельных деревьях
+ALTER TABLE categories ADD COLUMN IF NOT EXISTS kind VARCHAR(10) NOT NULL DEFAULT 'expense'
+    CONSTRAINT categories_kind_check CHECK (kind IN ('expense', 'income'));
+
+CREATE INDEX IF NOT EXISTS idx_expenses_ledger_kind ON expenses(ledger_id, kind, occurred_at);
+
+DROP INDEX IF EXISTS idx_categories_sibling_name;
+CREATE UNIQUE INDEX IF NOT EXISTS idx_categories_sibling_name ON categories(ledger_id, kind, COALESCE(parent_id, 0), name)
+    WHERE deleted_at IS NULL;
@@ -0,0 +1,6 @@
+DROP TABLE IF EXISTS transfers;
+
+DROP INDEX IF EXISTS idx_expenses_account_id;
+ALTER TABLE expenses DROP COLUMN IF EXISTS account_id;
+
+DROP TABLE IF EXISTS accounts;
@@ -0,0 +1,38 @@
+-- Счета книги: карты, наличные, вклады. Начальный остаток задаётся в валюте счёта
+CREATE TABLE IF NOT EXISTS accounts (
+    id BIGSERIAL PRIMARY KEY,
+    ledger_id BIGINT NOT NULL REFERENCES ledgers(id) ON DELETE CASCADE,
+    user_id BIGINT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    name VARCHAR(100) NOT NULL,
+    type VARCHAR(20) NOT NULL CHECK (type IN ('cash', 'card', 'bank', 'savings', 'credit', 'other')),
+    currency VARCHAR(3) NOT NULL,
+    opening_balance NUMERIC(18,4) NOT NULL DEFAULT 0,
+    archived_at TIMESTAMPTZ,
+    created_at TIMESTAMPTZ DEFAULT NOW(),
+    updated_at TIMESTAMPTZ DEFAULT NOW()
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_accounts_ledger_name ON accounts(ledger_id, lower(name));
+
+ALTER TABLE expenses ADD COLUMN IF NOT EXISTS account_id BIGINT REFERENCES accounts(id) ON DELETE SET NULL;
+CREATE INDEX IF NOT EXISTS idx_expenses_account_id ON expenses(account_id, occurred_at);
+
+-- Переводы между счетами не считаются ни расходом, ни доходом. to_amount
+-- отличается от amount, только если валюты счетов разные
+CREATE TABLE IF NOT EXISTS transfers (
+    id BIGSERIAL PRIMARY KEY,
+    ledger_id BIGINT NOT NULL REFERENCES ledgers(id) ON DELETE CASCADE,
+    user_id BIGINT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    from_account_id BIGINT NOT NULL REFERENCES accounts(id) ON DELETE CASCADE,
+    to_account_id BIGINT NOT NULL REFERENCES accounts(id) ON DELETE CASCADE,
+    amount NUMERIC(18,4) NOT NULL CHECK (amount > 0),
+    to_amount NUMERIC(18,4) NOT NULL CHECK (to_amount > 0),
+    occurred_at TIMESTAMPTZ NOT NULL,
+    comment TEXT,
+    created_at TIMESTAMPTZ DEFAULT NOW(),
+    CHECK (from_account_id <> to_account_id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_transfers_ledger_id ON transfers(ledger_id, occurred_at);
+CREATE INDEX IF NOT EXISTS idx_transfers_from_account_id ON transfers(from_account_id, occurred_at);
+CREATE INDEX IF NOT EXISTS idx_transfers_to_account_id ON transfers(to_account_id, occurred_at);
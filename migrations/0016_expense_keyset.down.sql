@@ -0,0 +1,5 @@
+CREATE INDEX IF NOT EXISTS idx_expenses_ledger_kind ON expenses(ledger_id, kind, occurred_at);
+
+DROP INDEX IF EXISTS idx_expenses_ledger_occurred;
+DROP INDEX IF EXISTS idx_expenses_ledger_kind_amount;
+DROP INDEX IF EXISTS idx_expenses_ledger_kind_occurred;
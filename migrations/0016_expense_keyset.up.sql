@@ -0,0 +1,13 @@
+-- Индексы для постраничного вывода по курсору: сортировка по времени или
+-- сумме, id различает расходы с одинаковым ключом. Удалённые расходы в
+-- списки не попадают
+CREATE INDEX IF NOT EXISTS idx_expenses_ledger_kind_occurred ON expenses(ledger_id, kind, occurred_at, id)
+    WHERE deleted_at IS NULL;
+CREATE INDEX IF NOT EXISTS idx_expenses_ledger_kind_amount ON expenses(ledger_id, kind, amount, id)
+    WHERE deleted_at IS NULL;
+-- kind=all
+CREATE INDEX IF NOT EXISTS idx_expenses_ledger_occurred ON expenses(ledger_id, occurred_at, id)
+    WHERE deleted_at IS NULL;
+
+-- Заменён idx_expenses_ledger_kind_occurred
+DROP INDEX IF EXISTS idx_expenses_ledger_kind;
@@ -0,0 +1,7 @@
+DROP INDEX IF EXISTS idx_categories_name_trgm;
+DROP INDEX IF EXISTS idx_expenses_search_text;
+DROP INDEX IF EXISTS idx_expenses_search_vector;
+
+ALTER TABLE expenses DROP COLUMN IF EXISTS search_text;
+ALTER TABLE expenses DROP COLUMN IF EXISTS search_vector;
+ALTER TABLE expenses DROP COLUMN IF EXISTS merchant;
@@ -0,0 +1,22 @@
+CREATE EXTENSION IF NOT EXISTS pg_trgm;
+
+-- Получатель платежа: магазин, сервис и т.п.
+ALTER TABLE expenses ADD COLUMN IF NOT EXISTS merchant VARCHAR(255);
+
+-- Комментарии пишут вперемешку по-русски и по-английски, поэтому текст
+-- разбирается обеими конфигурациями. Получатель весит больше комментария
+ALTER TABLE expenses ADD COLUMN IF NOT EXISTS search_vector tsvector GENERATED ALWAYS AS (
+    setweight(to_tsvector('russian', coalesce(merchant, '')), 'A') ||
+    setweight(to_tsvector('english', coalesce(merchant, '')), 'A') ||
+    setweight(to_tsvector('russian', coalesce(comment, '')), 'B') ||
+    setweight(to_tsvector('english', coalesce(comment, '')), 'B')
+) STORED;
+
+-- Текст для нечёткого поиска по триграммам, находит слова с опечатками
+ALTER TABLE expenses ADD COLUMN IF NOT EXISTS search_text TEXT GENERATED ALWAYS AS (
+    coalesce(merchant, '') || ' ' || coalesce(comment, '')
+) STORED;
+
+CREATE INDEX IF NOT EXISTS idx_expenses_search_vector ON expenses USING gin (search_vector);
+CREATE INDEX IF NOT EXISTS idx_expenses_search_text ON expenses USING gin (search_text gin_trgm_ops);
+CREATE INDEX IF NOT EXISTS idx_categories_name_trgm ON categories USING gin (name gin_trgm_ops);